@@ -0,0 +1,283 @@
+// Package auth implements API keys that carry caveats, in the style of
+// macaroons. A key is a root key ID, a list of caveats and a signature
+// chained over them: the signature starts as the HMAC of the ID under the
+// root secret and every caveat is folded in with another HMAC. Anyone holding
+// a key can add caveats and so derive a narrower key without asking the
+// server, but nobody can remove one without the root secret.
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"dfs/types"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformedKey     = errors.New("malformed api key")
+	ErrUnknownRootKey   = errors.New("unknown root key")
+	ErrInvalidSignature = errors.New("invalid api key signature")
+	ErrKeyExpired       = errors.New("api key expired")
+	ErrForbidden        = errors.New("api key does not allow the request")
+)
+
+// keyPrefix marks encoded keys, telling them apart from static API keys.
+const keyPrefix = "dfs1_"
+
+// Operations a key can be restricted to.
+type Op string
+
+const (
+	OpRead   Op = "read"
+	OpWrite  Op = "write"
+	OpList   Op = "list"
+	OpDelete Op = "delete"
+
+	// OpAdmin covers managing the network rather than data: registering
+	// nodes and share keys. Keys restricted to prefixes or buckets are
+	// never allowed it, admin requests name no objects to check.
+	OpAdmin Op = "admin"
+)
+
+// Caveat is a condition every request made with a key has to meet, written
+// as "name=value".
+type Caveat string
+
+const (
+	caveatOps     = "ops"
+	caveatPrefix  = "prefix"
+	caveatBucket  = "bucket"
+	caveatExpires = "expires"
+)
+
+// AllowOps restricts a key to the operations.
+func AllowOps(ops ...Op) Caveat {
+	values := make([]string, len(ops))
+
+	for i, op := range ops {
+		values[i] = string(op)
+	}
+
+	return Caveat(caveatOps + "=" + strings.Join(values, ","))
+}
+
+// AllowPrefixes restricts a key to objects whose name has one of the
+// prefixes.
+func AllowPrefixes(prefixes ...string) Caveat {
+	return Caveat(caveatPrefix + "=" + strings.Join(prefixes, ","))
+}
+
+// AllowBuckets restricts a key to the buckets, the bucket of an object being
+// the first element of its name.
+func AllowBuckets(buckets ...string) Caveat {
+	return Caveat(caveatBucket + "=" + strings.Join(buckets, ","))
+}
+
+// ExpiresAt makes a key invalid after t.
+func ExpiresAt(t time.Time) Caveat {
+	return Caveat(caveatExpires + "=" + strconv.FormatInt(t.Unix(), 10))
+}
+
+type Key struct {
+	ID        string   `json:"id"`
+	Caveats   []Caveat `json:"caveats,omitempty"`
+	Signature []byte   `json:"sig"`
+}
+
+func mac(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// NewKey returns a key of the root key id, signed with its secret.
+func NewKey(id string, secret []byte, caveats ...Caveat) *Key {
+	k := &Key{ID: id, Signature: mac(secret, id)}
+	return k.Attenuate(caveats...)
+}
+
+// Attenuate returns a copy of the key restricted further by the caveats.
+func (k *Key) Attenuate(caveats ...Caveat) *Key {
+	n := &Key{
+		ID:        k.ID,
+		Caveats:   append(append([]Caveat{}, k.Caveats...), caveats...),
+		Signature: k.Signature,
+	}
+
+	for _, caveat := range caveats {
+		n.Signature = mac(n.Signature, string(caveat))
+	}
+
+	return n
+}
+
+func (k *Key) Encode() string {
+	data, _ := json.Marshal(k)
+	return keyPrefix + base64.RawURLEncoding.EncodeToString(data)
+}
+
+// IsKey reports whether s looks like an encoded key.
+func IsKey(s string) bool {
+	return strings.HasPrefix(s, keyPrefix)
+}
+
+func Parse(s string) (*Key, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(s, keyPrefix))
+
+	if !IsKey(s) || err != nil {
+		return nil, ErrMalformedKey
+	}
+
+	var k Key
+
+	if err := json.Unmarshal(data, &k); err != nil || k.ID == "" {
+		return nil, ErrMalformedKey
+	}
+
+	return &k, nil
+}
+
+// Verify checks the signature chain of the key against the root secrets by
+// root key ID.
+func (k *Key) Verify(secrets map[string][]byte) error {
+	secret, ok := secrets[k.ID]
+
+	if !ok {
+		return ErrUnknownRootKey
+	}
+
+	if !hmac.Equal(NewKey(k.ID, secret, k.Caveats...).Signature, k.Signature) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// Request describes what a request does, for checking it against caveats.
+type Request struct {
+	// Op is empty for requests every operation depends on, such as checking
+	// a bucket exists, which ops caveats don't restrict.
+	Op Op
+
+	// Names are the objects the request touches.
+	Names []string
+
+	// Buckets are the buckets the request touches besides those of Names.
+	Buckets []string
+}
+
+func hasPrefix(name string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// inBucket reports whether any of the prefixes can match names in the bucket.
+func inBucket(bucket string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(prefix, bucket+"/") || strings.HasPrefix(bucket+"/", prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func contains[T comparable](values []T, v T) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Authorize checks the request meets every caveat of the key at now. The
+// signature must have been verified before.
+func (k *Key) Authorize(req Request, now time.Time) error {
+	for _, caveat := range k.Caveats {
+		name, value, ok := strings.Cut(string(caveat), "=")
+
+		if !ok {
+			return fmt.Errorf("%w: malformed caveat %q", ErrForbidden, caveat)
+		}
+
+		values := strings.Split(value, ",")
+
+		switch name {
+		case caveatOps:
+			if req.Op != "" && !contains(values, string(req.Op)) {
+				return fmt.Errorf("%w: %s is not allowed", ErrForbidden, req.Op)
+			}
+		case caveatPrefix:
+			if req.Op == OpAdmin {
+				return fmt.Errorf("%w: keys restricted to prefixes can't administer", ErrForbidden)
+			}
+
+			for _, n := range req.Names {
+				if !hasPrefix(n, values) {
+					return fmt.Errorf("%w: %s is outside the allowed prefixes", ErrForbidden, n)
+				}
+			}
+
+			for _, b := range req.Buckets {
+				if !inBucket(b, values) {
+					return fmt.Errorf("%w: bucket %s is outside the allowed prefixes", ErrForbidden, b)
+				}
+			}
+		case caveatBucket:
+			if req.Op == OpAdmin {
+				return fmt.Errorf("%w: keys restricted to buckets can't administer", ErrForbidden)
+			}
+
+			for _, n := range req.Names {
+				if !contains(values, types.BucketOf(n)) {
+					return fmt.Errorf("%w: %s is outside the allowed buckets", ErrForbidden, n)
+				}
+			}
+
+			for _, b := range req.Buckets {
+				if !contains(values, b) {
+					return fmt.Errorf("%w: bucket %s is not allowed", ErrForbidden, b)
+				}
+			}
+		case caveatExpires:
+			expires, err := strconv.ParseInt(value, 10, 64)
+
+			if err != nil {
+				return fmt.Errorf("%w: malformed caveat %q", ErrForbidden, caveat)
+			}
+
+			if now.After(time.Unix(expires, 0)) {
+				return ErrKeyExpired
+			}
+		default:
+			// a caveat that is not understood can't be known to be met
+			return fmt.Errorf("%w: unknown caveat %q", ErrForbidden, caveat)
+		}
+	}
+
+	return nil
+}
+
+// Allows reports whether the key may list the object name, used to filter
+// listings.
+func (k *Key) Allows(name string) bool {
+	return k.Authorize(Request{Op: OpList, Names: []string{name}}, time.Now()) == nil
+}
+
+// AllowsBucket reports whether the key may list the bucket.
+func (k *Key) AllowsBucket(bucket string) bool {
+	return k.Authorize(Request{Op: OpList, Buckets: []string{bucket}}, time.Now()) == nil
+}
@@ -0,0 +1,89 @@
+package auth_test
+
+import (
+	"dfs/auth"
+	"errors"
+	"testing"
+	"time"
+)
+
+var secrets = map[string][]byte{"root": []byte("root secret")}
+
+func TestKey(t *testing.T) {
+	t.Run("attenuated keys verify and survive encoding", func(t *testing.T) {
+		key := auth.NewKey("root", secrets["root"]).Attenuate(auth.AllowOps(auth.OpRead))
+
+		parsed, err := auth.Parse(key.Encode())
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := parsed.Verify(secrets); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("dropping a caveat breaks the signature", func(t *testing.T) {
+		key := auth.NewKey("root", secrets["root"], auth.AllowOps(auth.OpRead), auth.AllowPrefixes("docs/"))
+		key.Caveats = key.Caveats[:1]
+
+		if err := key.Verify(secrets); !errors.Is(err, auth.ErrInvalidSignature) {
+			t.Fatalf("expected %v, got %v", auth.ErrInvalidSignature, err)
+		}
+	})
+
+	t.Run("rejects keys of unknown roots", func(t *testing.T) {
+		key := auth.NewKey("other", []byte("secret"))
+
+		if err := key.Verify(secrets); !errors.Is(err, auth.ErrUnknownRootKey) {
+			t.Fatalf("expected %v, got %v", auth.ErrUnknownRootKey, err)
+		}
+	})
+}
+
+func TestAuthorize(t *testing.T) {
+	now := time.Now()
+	key := auth.NewKey("root", secrets["root"],
+		auth.AllowOps(auth.OpRead, auth.OpList),
+		auth.AllowBuckets("photos", "docs"),
+	).Attenuate(auth.AllowPrefixes("photos/2024/"), auth.ExpiresAt(now.Add(time.Hour)))
+
+	tests := []struct {
+		name string
+		req  auth.Request
+		err  error
+	}{
+		{"allowed read", auth.Request{Op: auth.OpRead, Names: []string{"photos/2024/cat.jpg"}}, nil},
+		{"operation not allowed", auth.Request{Op: auth.OpWrite, Names: []string{"photos/2024/cat.jpg"}}, auth.ErrForbidden},
+		{"outside the narrowed prefix", auth.Request{Op: auth.OpRead, Names: []string{"docs/report.pdf"}}, auth.ErrForbidden},
+		{"bucket not allowed", auth.Request{Op: auth.OpList, Buckets: []string{"music"}}, auth.ErrForbidden},
+		{"no operation is only checked for buckets", auth.Request{Buckets: []string{"photos"}}, nil},
+		{"bucket outside the narrowed prefix", auth.Request{Buckets: []string{"docs"}}, auth.ErrForbidden},
+	}
+
+	// admin requests name no objects, prefix and bucket caveats deny them
+	for _, caveat := range []auth.Caveat{auth.AllowPrefixes("photos/"), auth.AllowBuckets("photos")} {
+		restricted := auth.NewKey("root", secrets["root"], caveat)
+
+		if err := restricted.Authorize(auth.Request{Op: auth.OpAdmin}, now); !errors.Is(err, auth.ErrForbidden) {
+			t.Fatalf("expected %v for a key with %s, got %v", auth.ErrForbidden, caveat, err)
+		}
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := key.Authorize(tt.req, now); !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+
+	t.Run("expired keys allow nothing", func(t *testing.T) {
+		req := auth.Request{Op: auth.OpRead, Names: []string{"photos/2024/cat.jpg"}}
+
+		if err := key.Authorize(req, now.Add(2*time.Hour)); !errors.Is(err, auth.ErrKeyExpired) {
+			t.Fatalf("expected %v, got %v", auth.ErrKeyExpired, err)
+		}
+	})
+}
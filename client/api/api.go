@@ -2,11 +2,15 @@ package api
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"dfs/share"
 	"dfs/types"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
 )
 
 type Client struct {
@@ -31,6 +35,29 @@ func NewClient(baseURL string, key string) *Client {
 	}
 }
 
+// do sends the request, turning rejected keys into errors.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		resp.Body.Close()
+		return nil, types.ErrUnauthorized
+	case http.StatusForbidden:
+		resp.Body.Close()
+		return nil, types.ErrForbidden
+	case http.StatusTooManyRequests:
+		resp.Body.Close()
+		return nil, types.ErrLimitExceeded
+	}
+
+	return resp, nil
+}
+
 func (c *Client) GetObject(name string) (*types.Object, error) {
 
 	var objReq types.GetObjectRequest
@@ -46,9 +73,7 @@ func (c *Client) GetObject(name string) (*types.Object, error) {
 		return nil, err
 	}
 
-	client := &http.Client{}
-
-	resp, err := client.Do(req)
+	resp, err := c.do(req)
 
 	if err != nil {
 		return nil, err
@@ -56,6 +81,10 @@ func (c *Client) GetObject(name string) (*types.Object, error) {
 
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, types.ErrObjectNotFound
+	}
+
 	var objResp types.GetObjectResponse
 
 	if err := json.NewDecoder(resp.Body).Decode(&objResp); err != nil {
@@ -80,9 +109,7 @@ func (c *Client) PutObject(obj *types.Object) error {
 		return err
 	}
 
-	client := &http.Client{}
-
-	resp, err := client.Do(req)
+	resp, err := c.do(req)
 
 	if err != nil {
 		return err
@@ -90,6 +117,10 @@ func (c *Client) PutObject(obj *types.Object) error {
 
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusConflict {
+		return types.ErrObjectExists
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		return types.ErrCouldNotPutObjectToAPI
 	}
@@ -110,9 +141,7 @@ func (c *Client) CreateSegment(segment *types.Segment) error {
 		return err
 	}
 
-	client := &http.Client{}
-
-	resp, err := client.Do(req)
+	resp, err := c.do(req)
 
 	if err != nil {
 		return err
@@ -124,5 +153,768 @@ func (c *Client) CreateSegment(segment *types.Segment) error {
 		return types.ErrCouldNotPutObjectToAPI
 	}
 
+	var segResp types.SegmentResponse
+
+	// the server answers with the stored segment, which for content
+	// addressed segments may reference pieces of an earlier upload
+	if err := json.NewDecoder(resp.Body).Decode(&segResp); err == nil && segResp.Segment != nil {
+		*segment = *segResp.Segment
+	}
+
+	return nil
+}
+
+func (c *Client) post(endpoint string, body any) (*http.Response, error) {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := newRequest("POST", c.baseURL+endpoint, bytes.NewBuffer(encoded), c.key)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.do(req)
+}
+
+// DeleteObject removes the object and returns the pieces that are no longer
+// referenced and should be deleted from the storage nodes.
+func (c *Client) DeleteObject(name string) ([]*types.Piece, error) {
+	resp, err := c.post("/object/delete", types.DeleteObjectRequest{Name: name})
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, types.ErrObjectNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, types.ErrCouldNotDeleteObjectFromAPI
+	}
+
+	var delResp types.DeleteObjectResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&delResp); err != nil {
+		return nil, err
+	}
+
+	return delResp.Pieces, nil
+}
+
+// LookupSegment returns the segment already stored under the content key in
+// the bucket of the object, or types.ErrSegmentNotFound.
+func (c *Client) LookupSegment(objectID types.ObjectID, contentKey []byte) (*types.Segment, error) {
+	resp, err := c.post("/segments/lookup", types.LookupSegmentRequest{ObjectID: objectID, ContentKey: contentKey})
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, types.ErrSegmentNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, types.ErrCouldNotGetObjectFromAPI
+	}
+
+	var segResp types.SegmentResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&segResp); err != nil {
+		return nil, err
+	}
+
+	if segResp.Segment == nil {
+		return nil, types.ErrSegmentNotFound
+	}
+
+	return segResp.Segment, nil
+}
+
+// CreateOrders returns the pieces of the object with orders for the action of
+// the request set, see types.OrderRequest.
+func (c *Client) CreateOrders(objectID types.ObjectID, req *types.OrderRequest) ([]*types.Piece, error) {
+	resp, err := c.post("/objects/"+objectID.String()+"/orders", req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, types.ErrCouldNotCreateOrders
+	}
+
+	var ordersResp types.OrderResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&ordersResp); err != nil {
+		return nil, err
+	}
+
+	if len(ordersResp.Pieces) != len(req.Pieces) {
+		return nil, types.ErrCouldNotCreateOrders
+	}
+
+	return ordersResp.Pieces, nil
+}
+
+// OrderKey returns the public key orders are signed with, or
+// types.ErrOrdersDisabled if the server signs none.
+func (c *Client) OrderKey() (ed25519.PublicKey, error) {
+	resp, err := c.get("/orders/key")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, types.ErrOrdersDisabled
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, types.ErrCouldNotCreateOrders
+	}
+
+	var keyResp types.OrderKeyResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&keyResp); err != nil {
+		return nil, err
+	}
+
+	if len(keyResp.PublicKey) != ed25519.PublicKeySize {
+		return nil, types.ErrCouldNotCreateOrders
+	}
+
+	return keyResp.PublicKey, nil
+}
+
+func (c *Client) copyObject(endpoint, src, dst string) (*types.Object, error) {
+	resp, err := c.post(endpoint, types.CopyObjectRequest{Source: src, Destination: dst})
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, types.ErrObjectNotFound
+	case http.StatusConflict:
+		return nil, types.ErrObjectExists
+	default:
+		return nil, types.ErrCouldNotCopyObject
+	}
+
+	var objResp types.GetObjectResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&objResp); err != nil {
+		return nil, err
+	}
+
+	return &objResp.Object, nil
+}
+
+// CopyObject creates dst as a copy of src. Only metadata is copied, both
+// objects share the pieces on the storage nodes.
+func (c *Client) CopyObject(src, dst string) (*types.Object, error) {
+	return c.copyObject("/object/copy", src, dst)
+}
+
+// MoveObject renames src to dst.
+func (c *Client) MoveObject(src, dst string) (*types.Object, error) {
+	return c.copyObject("/object/move", src, dst)
+}
+
+// ReplaceObject moves src to dst, replacing dst if it exists, and returns
+// the pieces of the replaced object that should be deleted from the storage
+// nodes.
+func (c *Client) ReplaceObject(src, dst string) (*types.Object, []*types.Piece, error) {
+	resp, err := c.post("/object/replace", types.CopyObjectRequest{Source: src, Destination: dst})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil, types.ErrObjectNotFound
+	case http.StatusBadRequest:
+		return nil, nil, types.ErrSameObject
+	default:
+		return nil, nil, types.ErrCouldNotCopyObject
+	}
+
+	var replaceResp types.ReplaceObjectResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&replaceResp); err != nil {
+		return nil, nil, err
+	}
+
+	return &replaceResp.Object, replaceResp.Pieces, nil
+}
+
+// ComposeObject creates dst by concatenating the sources. Like CopyObject it
+// only writes metadata.
+func (c *Client) ComposeObject(dst string, srcs []string) (*types.Object, error) {
+	resp, err := c.post("/object/compose", types.ComposeObjectRequest{Sources: srcs, Destination: dst})
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, types.ErrObjectNotFound
+	case http.StatusConflict:
+		return nil, types.ErrObjectExists
+	default:
+		return nil, types.ErrCouldNotCopyObject
+	}
+
+	var objResp types.GetObjectResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&objResp); err != nil {
+		return nil, err
+	}
+
+	return &objResp.Object, nil
+}
+
+// UpdateObject changes the metadata of an object without rewriting its data.
+func (c *Client) UpdateObject(req *types.UpdateObjectRequest) (*types.Object, error) {
+	resp, err := c.post("/object/update", req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, types.ErrObjectNotFound
+	default:
+		return nil, types.ErrCouldNotUpdateObject
+	}
+
+	var objResp types.GetObjectResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&objResp); err != nil {
+		return nil, err
+	}
+
+	return &objResp.Object, nil
+}
+
+// ListObjects returns the objects whose name starts with prefix. The listed
+// objects do not include their segments.
+func (c *Client) ListObjects(prefix string) ([]*types.Object, error) {
+	resp, err := c.post("/objects/list", types.ListObjectsRequest{Prefix: prefix})
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, types.ErrCouldNotListObjects
+	}
+
+	var listResp types.ListObjectsResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&listResp); err != nil {
+		return nil, err
+	}
+
+	return listResp.Objects, nil
+}
+
+func (c *Client) RegisterNode(node *types.Node) error {
+	resp, err := c.post("/nodes", node)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusConflict:
+		return types.ErrNodeKeyMismatch
+	default:
+		return types.ErrCouldNotRegisterNode
+	}
+}
+
+// ReportCapacity tells the metadata server how much room the node has left,
+// so that clients stop choosing it for new pieces once it is full.
+func (c *Client) ReportCapacity(id types.NodeID, capacity, free uint64) error {
+	resp, err := c.post("/nodes/"+id.String()+"/capacity", types.ReportCapacityRequest{Capacity: capacity, Free: free})
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return nil
+	case http.StatusNotFound:
+		return types.ErrNodeNotFound
+	default:
+		return types.ErrCouldNotReportCapacity
+	}
+}
+
+// SettleUsage submits a signed usage report of a node. Settlements the server
+// rejects are not worth submitting again.
+func (c *Client) SettleUsage(report *types.UsageReport) (*types.SettleResponse, error) {
+	resp, err := c.post("/nodes/"+report.NodeID.String()+"/usage", report)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusBadRequest:
+		return nil, types.ErrInvalidReport
+	default:
+		return nil, types.ErrCouldNotSettleUsage
+	}
+
+	var settleResp types.SettleResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&settleResp); err != nil {
+		return nil, err
+	}
+
+	return &settleResp, nil
+}
+
+// ReportLostPieces tells the metadata server that the node lost the pieces,
+// so that their segments get repaired.
+func (c *Client) ReportLostPieces(id types.NodeID, pieces []types.PieceID) error {
+	resp, err := c.post("/nodes/"+id.String()+"/lost", types.LostPiecesRequest{Pieces: pieces})
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return nil
+	case http.StatusNotFound:
+		return types.ErrNodeNotFound
+	default:
+		return types.ErrCouldNotReportLostPieces
+	}
+}
+
+// DegradedSegments returns the segments that lost pieces and need repair.
+func (c *Client) DegradedSegments() ([]*types.DegradedSegment, error) {
+	resp, err := c.get("/repair/segments")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, types.ErrCouldNotListRepairs
+	}
+
+	var repairResp types.RepairResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&repairResp); err != nil {
+		return nil, err
+	}
+
+	return repairResp.Segments, nil
+}
+
+// StartExit announces that the node leaves the network. The node then gets no
+// new pieces and is handed its pieces to transfer to other nodes.
+func (c *Client) StartExit(id types.NodeID) (*types.ExitStatus, error) {
+	resp, err := c.post("/nodes/"+id.String()+"/exit", nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeExitStatus(resp, types.ErrNodeNotFound, types.ErrCouldNotStartExit)
+}
+
+func (c *Client) ExitStatus(id types.NodeID) (*types.ExitStatus, error) {
+	resp, err := c.get("/nodes/" + id.String() + "/exit")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeExitStatus(resp, types.ErrNodeNotExiting, types.ErrCouldNotGetExitStatus)
+}
+
+// ExitTransfers returns up to limit pieces the exiting node should transfer
+// next, zero leaves the number to the server.
+func (c *Client) ExitTransfers(id types.NodeID, limit int) ([]*types.ExitTransfer, error) {
+	resp, err := c.post("/nodes/"+id.String()+"/exit/transfers", types.ExitTransfersRequest{Limit: limit})
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, types.ErrNodeNotExiting
+	default:
+		return nil, types.ErrCouldNotGetTransfers
+	}
+
+	var transfersResp types.ExitTransfersResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&transfersResp); err != nil {
+		return nil, err
+	}
+
+	return transfersResp.Transfers, nil
+}
+
+// ReportExit reports the results of transfers of the exiting node.
+func (c *Client) ReportExit(id types.NodeID, results []*types.ExitResult) (*types.ExitStatus, error) {
+	resp, err := c.post("/nodes/"+id.String()+"/exit/report", types.ExitReport{Results: results})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeExitStatus(resp, types.ErrNodeNotExiting, types.ErrCouldNotReportTransfers)
+}
+
+func decodeExitStatus(resp *http.Response, notFound, failed error) (*types.ExitStatus, error) {
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, notFound
+	default:
+		return nil, failed
+	}
+
+	var status types.ExitStatus
+
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+// Bandwidth returns the daily bandwidth rollups matching the request.
+func (c *Client) Bandwidth(req *types.BandwidthRequest) ([]*types.BandwidthRollup, error) {
+	resp, err := c.post("/usage/bandwidth", req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, types.ErrCouldNotGetBandwidth
+	}
+
+	var bandwidthResp types.BandwidthResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&bandwidthResp); err != nil {
+		return nil, err
+	}
+
+	return bandwidthResp.Rollups, nil
+}
+
+// StorageUsage returns the storage tally of the bucket, or of all buckets if
+// bucket is empty.
+func (c *Client) StorageUsage(bucket string) ([]*types.StorageTally, error) {
+	resp, err := c.post("/usage/storage", types.StorageUsageRequest{Bucket: bucket})
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, types.ErrCouldNotGetStorageUsage
+	}
+
+	var usageResp types.StorageUsageResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&usageResp); err != nil {
+		return nil, err
+	}
+
+	return usageResp.Tallies, nil
+}
+
+// Limits returns the limits that apply to the bucket.
+func (c *Client) Limits(bucket string) (*types.Limits, error) {
+	resp, err := c.get("/buckets/" + url.PathEscape(bucket) + "/limits")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, types.ErrCouldNotGetLimits
+	}
+
+	var limits types.Limits
+
+	if err := json.NewDecoder(resp.Body).Decode(&limits); err != nil {
+		return nil, err
+	}
+
+	return &limits, nil
+}
+
+// SetLimits gives the bucket limits of its own instead of the default ones.
+func (c *Client) SetLimits(bucket string, limits types.Limits) error {
+	resp, err := c.post("/buckets/"+url.PathEscape(bucket)+"/limits", limits)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return types.ErrCouldNotSetLimits
+	}
+
 	return nil
 }
+
+func (c *Client) ListNodes() ([]*types.Node, error) {
+	resp, err := c.get("/nodes")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, types.ErrCouldNotListNodes
+	}
+
+	var nodesResp types.ListNodesResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&nodesResp); err != nil {
+		return nil, err
+	}
+
+	return nodesResp.Nodes, nil
+}
+
+func (c *Client) CreateBucket(name string) (*types.Bucket, error) {
+	resp, err := c.post("/buckets", types.CreateBucketRequest{Name: name})
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusConflict:
+		return nil, types.ErrBucketExists
+	case http.StatusBadRequest:
+		return nil, types.ErrInvalidBucketName
+	default:
+		return nil, types.ErrCouldNotCreateBucket
+	}
+
+	var bucket types.Bucket
+
+	if err := json.NewDecoder(resp.Body).Decode(&bucket); err != nil {
+		return nil, err
+	}
+
+	return &bucket, nil
+}
+
+func (c *Client) get(endpoint string) (*http.Response, error) {
+	req, err := newRequest("GET", c.baseURL+endpoint, nil, c.key)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.do(req)
+}
+
+func (c *Client) GetBucket(name string) (*types.Bucket, error) {
+	resp, err := c.get("/buckets/" + url.PathEscape(name))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, types.ErrBucketNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, types.ErrCouldNotListBuckets
+	}
+
+	var bucket types.Bucket
+
+	if err := json.NewDecoder(resp.Body).Decode(&bucket); err != nil {
+		return nil, err
+	}
+
+	return &bucket, nil
+}
+
+func (c *Client) ListBuckets() ([]*types.Bucket, error) {
+	resp, err := c.get("/buckets")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, types.ErrCouldNotListBuckets
+	}
+
+	var bucketsResp types.ListBucketsResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&bucketsResp); err != nil {
+		return nil, err
+	}
+
+	return bucketsResp.Buckets, nil
+}
+
+// RegisterShareKey registers the public key of a key pair that signs share
+// links. The returned ID goes into every link signed with the key.
+func (c *Client) RegisterShareKey(publicKey ed25519.PublicKey) (*types.ShareKey, error) {
+	resp, err := c.post("/sharekeys", types.RegisterShareKeyRequest{PublicKey: publicKey})
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, types.ErrCouldNotRegisterShareKey
+	}
+
+	var key types.ShareKey
+
+	if err := json.NewDecoder(resp.Body).Decode(&key); err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+func (c *Client) GetShareKey(id string) (*types.ShareKey, error) {
+	resp, err := c.get("/sharekeys/" + url.PathEscape(id))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, types.ErrShareKeyNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, types.ErrCouldNotGetShareKey
+	}
+
+	var key types.ShareKey
+
+	if err := json.NewDecoder(resp.Body).Decode(&key); err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+// RevokeShareKey invalidates every link signed with the key.
+func (c *Client) RevokeShareKey(id string) error {
+	resp, err := c.post("/sharekeys/"+url.PathEscape(id)+"/revoke", nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return types.ErrShareKeyNotFound
+	}
+
+	if resp.StatusCode != http.StatusNoContent {
+		return types.ErrCouldNotRevokeShareKey
+	}
+
+	return nil
+}
+
+// ShareURL returns a link to the object of the grant on the HTTP gateway at
+// gatewayURL, signed with the private key registered as grant.KeyID.
+func (c *Client) ShareURL(gatewayURL string, grant *share.Grant, key ed25519.PrivateKey) string {
+	segments := strings.Split(grant.Object, "/")
+
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	return strings.TrimSuffix(gatewayURL, "/") + "/" + strings.Join(segments, "/") + "?" + share.Sign(grant, key).Encode()
+}
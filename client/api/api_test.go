@@ -3,6 +3,7 @@ package api_test
 import (
 	"dfs/client/api"
 	"dfs/types"
+	"errors"
 	"testing"
 
 	"github.com/h2non/gock"
@@ -120,6 +121,25 @@ func TestPutObject(t *testing.T) {
 			t.Fatalf("expected error, got nil")
 		}
 	})
+
+	t.Run("can handle exceeded limits", func(t *testing.T) {
+		defer gock.Off()
+
+		mockObj := types.NewObject("photos/cat.jpg")
+
+		gock.New("http://localhost:8080").
+			JSON(mockObj).
+			Post("/object/put").
+			Reply(429).
+			JSON(`{"error":"bucket is over its limits"}`)
+
+		api := api.NewClient("http://localhost:8080", "123")
+
+		err := api.PutObject(&mockObj)
+		if !errors.Is(err, types.ErrLimitExceeded) {
+			t.Fatalf("expected %v, got %v", types.ErrLimitExceeded, err)
+		}
+	})
 }
 
 func TestCreateSegment(t *testing.T) {
@@ -163,3 +183,128 @@ func TestCreateSegment(t *testing.T) {
 		}
 	})
 }
+
+func TestDeleteObject(t *testing.T) {
+	t.Run("can delete object", func(t *testing.T) {
+		defer gock.Off()
+
+		piece := &types.Piece{ID: types.NewPieceID()}
+
+		gock.New("http://localhost:8080").
+			JSON(`{"name":"/home/john/file.txt"}`).
+			Post("/object/delete").
+			Reply(200).
+			JSON(types.DeleteObjectResponse{Pieces: []*types.Piece{piece}})
+
+		api := api.NewClient("http://localhost:8080", "123")
+
+		pieces, err := api.DeleteObject("/home/john/file.txt")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(pieces) != 1 || pieces[0].ID != piece.ID {
+			t.Errorf("expected freed piece %v, got %v", piece.ID, pieces)
+		}
+	})
+
+	t.Run("can handle not found", func(t *testing.T) {
+		defer gock.Off()
+
+		gock.New("http://localhost:8080").
+			Post("/object/delete").
+			Reply(404).
+			JSON(`{"error":"not found"}`)
+
+		api := api.NewClient("http://localhost:8080", "123")
+
+		_, err := api.DeleteObject("/home/john/file.txt")
+		if !errors.Is(err, types.ErrObjectNotFound) {
+			t.Fatalf("expected %v, got %v", types.ErrObjectNotFound, err)
+		}
+	})
+}
+
+func TestLookupSegment(t *testing.T) {
+	t.Run("can look up segment", func(t *testing.T) {
+		defer gock.Off()
+
+		mockSeg := types.NewSegment(types.NewObjectID(), types.ONE_MEGABYTE, 0)
+		mockSeg.ContentKey = []byte("key")
+
+		gock.New("http://localhost:8080").
+			Post("/segments/lookup").
+			Reply(200).
+			JSON(types.SegmentResponse{Segment: &mockSeg})
+
+		api := api.NewClient("http://localhost:8080", "123")
+
+		segment, err := api.LookupSegment(mockSeg.ObjectID, mockSeg.ContentKey)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if segment.ID != mockSeg.ID {
+			t.Errorf("expected %v, got %v", mockSeg.ID, segment.ID)
+		}
+	})
+
+	t.Run("can handle missing segment", func(t *testing.T) {
+		defer gock.Off()
+
+		gock.New("http://localhost:8080").
+			Post("/segments/lookup").
+			Reply(404).
+			JSON(`{"error":"segment not found"}`)
+
+		api := api.NewClient("http://localhost:8080", "123")
+
+		_, err := api.LookupSegment(types.NewObjectID(), []byte("key"))
+		if !errors.Is(err, types.ErrSegmentNotFound) {
+			t.Fatalf("expected %v, got %v", types.ErrSegmentNotFound, err)
+		}
+	})
+}
+
+func TestCopyObject(t *testing.T) {
+	t.Run("can copy object", func(t *testing.T) {
+		defer gock.Off()
+
+		mockRes := types.GetObjectResponse{
+			Object: types.NewObject("/home/john/copy.txt"),
+		}
+
+		gock.New("http://localhost:8080").
+			JSON(`{"source":"/home/john/file.txt","destination":"/home/john/copy.txt"}`).
+			Post("/object/copy").
+			Reply(200).
+			JSON(mockRes)
+
+		api := api.NewClient("http://localhost:8080", "123")
+
+		obj, err := api.CopyObject("/home/john/file.txt", "/home/john/copy.txt")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if obj.ID != mockRes.Object.ID {
+			t.Errorf("expected %v, got %v", mockRes.Object.ID, obj.ID)
+		}
+	})
+
+	t.Run("can handle existing destination", func(t *testing.T) {
+		defer gock.Off()
+
+		gock.New("http://localhost:8080").
+			Post("/object/move").
+			Reply(409).
+			JSON(`{"error":"object already exists"}`)
+
+		api := api.NewClient("http://localhost:8080", "123")
+
+		_, err := api.MoveObject("/home/john/file.txt", "/home/john/copy.txt")
+		if !errors.Is(err, types.ErrObjectExists) {
+			t.Fatalf("expected %v, got %v", types.ErrObjectExists, err)
+		}
+	})
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"dfs/compression"
+	dfs "dfs/fs"
+	"dfs/types"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const scheme = "dfs://"
+
+// remote strips the dfs:// scheme from arg and reports whether it was there.
+func remote(arg string) (string, bool) {
+	if strings.HasPrefix(arg, scheme) {
+		return strings.TrimPrefix(arg, scheme), true
+	}
+
+	return arg, false
+}
+
+// remoteOnly is for commands that only take remote paths, where the scheme
+// may be left out.
+func remoteOnly(arg string) string {
+	name, _ := remote(arg)
+	return name
+}
+
+func joinRemote(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+
+	return strings.TrimSuffix(prefix, "/") + "/" + name
+}
+
+// parseFlags parses the -r flag and the flags defined by define, which may
+// be used by only some commands.
+func parseFlags(name string, args []string, nargs int, usage string, define ...func(*flag.FlagSet)) (*flag.FlagSet, *bool, error) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	recursive := flags.Bool("r", false, "operate on all files below the path")
+
+	for _, d := range define {
+		d(flags)
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if flags.NArg() != nargs {
+		return nil, nil, errors.New("usage: dfs " + usage)
+	}
+
+	return flags, recursive, nil
+}
+
+func (c *cli) cp(args []string) error {
+	var ttl time.Duration
+	var compress bool
+
+	flags, recursive, err := parseFlags("cp", args, 2, "cp [-r] [-ttl duration] [-compress] <src> <dst>", func(flags *flag.FlagSet) {
+		flags.DurationVar(&ttl, "ttl", 0, "expire uploaded files after the duration")
+		flags.BoolVar(&compress, "compress", false, "compress uploaded files with zstd")
+	})
+
+	if err != nil {
+		return err
+	}
+
+	var opts []func(*types.Object)
+
+	if ttl > 0 {
+		opts = append(opts, dfs.WithExpiresAt(time.Now().Add(ttl)))
+	}
+
+	if compress {
+		opts = append(opts, dfs.WithCompression(compression.Zstd))
+	}
+
+	src, srcRemote := remote(flags.Arg(0))
+	dst, dstRemote := remote(flags.Arg(1))
+
+	switch {
+	case !srcRemote && dstRemote:
+		return c.upload(src, dst, *recursive, opts...)
+	case srcRemote && !dstRemote:
+		return c.download(src, dst, *recursive)
+	case srcRemote && dstRemote:
+		return c.remoteOp(src, dst, *recursive, c.copyFile)
+	default:
+		return errors.New("one of src and dst must be a " + scheme + " path")
+	}
+}
+
+func (c *cli) upload(src, dst string, recursive bool, opts ...func(*types.Object)) error {
+	fi, err := os.Stat(src)
+
+	if err != nil {
+		return err
+	}
+
+	if !fi.IsDir() {
+		if dst == "" || strings.HasSuffix(dst, "/") {
+			dst += filepath.Base(src)
+		}
+
+		return c.uploadFile(src, dst, opts...)
+	}
+
+	if !recursive {
+		return fmt.Errorf("%s is a directory, use -r", src)
+	}
+
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// directories are implied by the file names, links are skipped
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(src, p)
+
+		if err != nil {
+			return err
+		}
+
+		return c.uploadFile(p, joinRemote(dst, filepath.ToSlash(rel)), opts...)
+	})
+}
+
+func (c *cli) uploadFile(src, dst string, opts ...func(*types.Object)) error {
+	f, err := os.Open(src)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	fi, err := f.Stat()
+
+	if err != nil {
+		return err
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(src))
+
+	opts = append([]func(*types.Object){dfs.WithContentType(contentType)}, opts...)
+
+	_, err = c.fs.WriteFile(dst, f, uint64(fi.Size()), c.progress(dst), opts...)
+
+	return err
+}
+
+func (c *cli) download(src, dst string, recursive bool) error {
+	if !recursive {
+		if fi, err := os.Stat(dst); err == nil && fi.IsDir() {
+			dst = filepath.Join(dst, path.Base(src))
+		}
+
+		return c.downloadFile(src, dst)
+	}
+
+	prefix := types.DirPrefix(src)
+
+	objs, err := c.fs.List(prefix)
+
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objs {
+		rel := filepath.FromSlash(strings.TrimPrefix(obj.Name, prefix))
+
+		if !filepath.IsLocal(rel) {
+			return fmt.Errorf("refusing to write %s outside of %s", obj.Name, dst)
+		}
+
+		local := filepath.Join(dst, rel)
+
+		if err := os.MkdirAll(filepath.Dir(local), 0o755); err != nil {
+			return err
+		}
+
+		if err := c.downloadFile(obj.Name, local); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// downloadFile writes src to a temporary file next to dst and only renames
+// it into place once complete, so a failed download leaves dst as it was.
+func (c *cli) downloadFile(src, dst string) error {
+	if _, err := c.fs.StatObject(src); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.tmp")
+
+	if err != nil {
+		return err
+	}
+
+	// don't leave the temporary file behind on failure
+	fail := func(err error) error {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Chmod(0o644); err != nil {
+		return fail(err)
+	}
+
+	if _, err := c.fs.ReadFileTo(src, f, c.progress(src)); err != nil {
+		return fail(err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fail(err)
+	}
+
+	if err := os.Rename(f.Name(), dst); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return nil
+}
+
+// remoteOp applies a metadata only operation such as copy or move to src, or
+// to every file below it when recursive.
+func (c *cli) remoteOp(src, dst string, recursive bool, op func(src, dst string) error) error {
+	if !recursive {
+		if strings.HasSuffix(dst, "/") {
+			dst += path.Base(src)
+		}
+
+		return op(src, dst)
+	}
+
+	prefix := types.DirPrefix(src)
+
+	objs, err := c.fs.List(prefix)
+
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objs {
+		if err := op(obj.Name, joinRemote(dst, strings.TrimPrefix(obj.Name, prefix))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *cli) copyFile(src, dst string) error {
+	_, err := c.fs.CopyFile(src, dst)
+	return err
+}
+
+func (c *cli) moveFile(src, dst string) error {
+	_, err := c.fs.MoveFile(src, dst)
+	return err
+}
+
+func (c *cli) mv(args []string) error {
+	flags, recursive, err := parseFlags("mv", args, 2, "mv [-r] <src> <dst>")
+
+	if err != nil {
+		return err
+	}
+
+	return c.remoteOp(remoteOnly(flags.Arg(0)), remoteOnly(flags.Arg(1)), *recursive, c.moveFile)
+}
+
+func (c *cli) cat(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: dfs cat <path>...")
+	}
+
+	for _, arg := range args {
+		if _, err := c.fs.ReadFileTo(remoteOnly(arg), c.stdout, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *cli) ls(args []string) error {
+	if len(args) > 1 {
+		return errors.New("usage: dfs ls [path]")
+	}
+
+	prefix := ""
+	if len(args) == 1 {
+		prefix = remoteOnly(args[0])
+	}
+
+	objs, err := c.fs.List(prefix)
+
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objs {
+		fmt.Fprintf(c.stdout, "%12d  %s\n", obj.Size, obj.Name)
+	}
+
+	return nil
+}
+
+func (c *cli) rm(args []string) error {
+	flags, recursive, err := parseFlags("rm", args, 1, "rm [-r] <path>")
+
+	if err != nil {
+		return err
+	}
+
+	name := remoteOnly(flags.Arg(0))
+
+	if !*recursive {
+		return c.fs.DeleteFile(name)
+	}
+
+	objs, err := c.fs.List(types.DirPrefix(name))
+
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objs {
+		if err := c.fs.DeleteFile(obj.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *cli) stat(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: dfs stat <path>")
+	}
+
+	obj, err := c.fs.StatObject(remoteOnly(args[0]))
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.stdout, "name:     %s\n", obj.Name)
+	fmt.Fprintf(c.stdout, "id:       %s\n", obj.ID)
+	fmt.Fprintf(c.stdout, "size:     %d\n", obj.Size)
+
+	if obj.ContentType != "" {
+		fmt.Fprintf(c.stdout, "type:     %s\n", obj.ContentType)
+	}
+
+	if obj.ContentHash != nil {
+		fmt.Fprintf(c.stdout, "blake3:   %x\n", obj.ContentHash)
+	}
+
+	fmt.Fprintf(c.stdout, "created:  %s\n", obj.CreatedAt.Format(time.RFC3339))
+	fmt.Fprintf(c.stdout, "modified: %s\n", obj.ModifiedAt.Format(time.RFC3339))
+
+	if !obj.ExpiresAt.IsZero() {
+		fmt.Fprintf(c.stdout, "expires:  %s\n", obj.ExpiresAt.Format(time.RFC3339))
+	}
+
+	keys := make([]string, 0, len(obj.Metadata))
+
+	for key := range obj.Metadata {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fmt.Fprintf(c.stdout, "meta:     %s=%s\n", key, obj.Metadata[key])
+	}
+
+	fmt.Fprintf(c.stdout, "segments: %d\n", len(obj.Segments))
+
+	for _, segment := range obj.Segments {
+		compression := segment.Compression
+		if compression == "" {
+			compression = "none"
+		}
+
+		fmt.Fprintf(c.stdout, "  %d: %s size=%d pieces=%d compression=%s\n",
+			segment.Position, segment.ID, segment.Size, len(segment.Pieces), compression)
+	}
+
+	return nil
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"dfs/localnet"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func newTestCLI(t *testing.T) *cli {
+	t.Helper()
+
+	net, err := localnet.Start(t.TempDir())
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	t.Cleanup(func() { net.Close() })
+
+	return &cli{fs: net.FS(), quiet: true, stdout: io.Discard, stderr: io.Discard}
+}
+
+// writeLocal creates the files below dir, keyed by slash separated names.
+func writeLocal(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := os.WriteFile(p, []byte(data), 0o644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func remoteNames(t *testing.T, c *cli) []string {
+	t.Helper()
+
+	objs, err := c.fs.List("")
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var names []string
+
+	for _, obj := range objs {
+		names = append(names, obj.Name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+func readRemote(t *testing.T, c *cli, name string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	if _, err := c.fs.ReadFileTo(name, &buf, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return buf.String()
+}
+
+func TestUpload(t *testing.T) {
+	files := map[string]string{
+		"dir/a.txt":     "a",
+		"dir/sub/b.txt": "b",
+	}
+
+	for _, tc := range []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"a file into a directory", []string{"dir/a.txt", "dfs://docs/"}, []string{"docs/a.txt"}},
+		{"a file to a name", []string{"dir/a.txt", "dfs://docs/c.txt"}, []string{"docs/c.txt"}},
+		{"a directory", []string{"-r", "dir", "dfs://docs"}, []string{"docs/a.txt", "docs/sub/b.txt"}},
+		{"a directory into a directory", []string{"-r", "dir", "dfs://docs/"}, []string{"docs/a.txt", "docs/sub/b.txt"}},
+		{"a directory with a trailing slash", []string{"-r", "dir/", "dfs://docs"}, []string{"docs/a.txt", "docs/sub/b.txt"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestCLI(t)
+			local := t.TempDir()
+
+			writeLocal(t, local, files)
+
+			args := slices.Clone(tc.args)
+
+			for i, arg := range args {
+				if strings.HasPrefix(arg, "dir") {
+					args[i] = local + string(filepath.Separator) + filepath.FromSlash(arg)
+				}
+			}
+
+			if err := c.cp(args); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := remoteNames(t, c); !slices.Equal(got, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+
+	t.Run("overwrites remote files", func(t *testing.T) {
+		c := newTestCLI(t)
+		local := t.TempDir()
+
+		for _, data := range []string{"old", "new"} {
+			writeLocal(t, local, map[string]string{"a.txt": data})
+
+			if err := c.cp([]string{filepath.Join(local, "a.txt"), "dfs://docs/a.txt"}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		if got := remoteNames(t, c); !slices.Equal(got, []string{"docs/a.txt"}) {
+			t.Fatalf("expected only docs/a.txt, got %v", got)
+		}
+
+		if got := readRemote(t, c, "docs/a.txt"); got != "new" {
+			t.Fatalf("expected %q, got %q", "new", got)
+		}
+	})
+}
+
+func TestDownload(t *testing.T) {
+	files := map[string]string{
+		"docs/a.txt":     "a",
+		"docs/sub/b.txt": "b",
+		"docsextra.txt":  "not below docs/",
+	}
+
+	for _, tc := range []struct {
+		name string
+		args []string
+		want map[string]string
+	}{
+		{"a file into a directory", []string{"dfs://docs/a.txt", "."}, map[string]string{"a.txt": "a"}},
+		{"a file to a name", []string{"dfs://docs/a.txt", "c.txt"}, map[string]string{"c.txt": "a"}},
+		{"a directory", []string{"-r", "dfs://docs", "out"}, map[string]string{"out/a.txt": "a", "out/sub/b.txt": "b"}},
+		{"a directory with a trailing slash", []string{"-r", "dfs://docs/", "out"}, map[string]string{"out/a.txt": "a", "out/sub/b.txt": "b"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestCLI(t)
+			src, local := t.TempDir(), t.TempDir()
+
+			writeLocal(t, src, files)
+
+			if err := c.cp([]string{"-r", src, "dfs://"}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			args := slices.Clone(tc.args)
+			args[len(args)-1] = filepath.Join(local, args[len(args)-1])
+
+			if err := c.cp(args); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got := make(map[string]string)
+
+			err := filepath.WalkDir(local, func(p string, d os.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+
+				data, err := os.ReadFile(p)
+
+				if err != nil {
+					return err
+				}
+
+				rel, err := filepath.Rel(local, p)
+				got[filepath.ToSlash(rel)] = string(data)
+
+				return err
+			})
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(got) != len(tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+
+			for name, data := range tc.want {
+				if got[name] != data {
+					t.Fatalf("expected %v, got %v", tc.want, got)
+				}
+			}
+		})
+	}
+
+	t.Run("overwrites local files only once the download succeeds", func(t *testing.T) {
+		c := newTestCLI(t)
+		local := t.TempDir()
+		dst := filepath.Join(local, "a.txt")
+
+		writeLocal(t, local, map[string]string{"a.txt": "remote", "b.txt": "local"})
+
+		if err := c.cp([]string{dst, "dfs://docs/a.txt"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		dst = filepath.Join(local, "b.txt")
+
+		if err := c.cp([]string{"dfs://docs/missing.txt", dst}); err == nil {
+			t.Fatalf("expected downloading a missing file to fail")
+		}
+
+		if data, _ := os.ReadFile(dst); string(data) != "local" {
+			t.Fatalf("expected the local file to be kept, got %q", data)
+		}
+
+		if err := c.cp([]string{"dfs://docs/a.txt", dst}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if data, _ := os.ReadFile(dst); string(data) != "remote" {
+			t.Fatalf("expected the local file to be replaced, got %q", data)
+		}
+
+		entries, err := os.ReadDir(local)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(entries) != 2 {
+			t.Fatalf("expected no temporary files to be left, got %v", entries)
+		}
+	})
+}
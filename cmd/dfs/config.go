@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+type config struct {
+	URL    string `json:"url"`
+	APIKey string `json:"api_key"`
+}
+
+func defaultConfigPath() string {
+	if path := os.Getenv("DFS_CONFIG"); path != "" {
+		return path
+	}
+
+	dir, err := os.UserConfigDir()
+
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "dfs", "config.json")
+}
+
+// loadConfig resolves the settings from, in order of precedence, the command
+// line flags, the environment and the config file.
+func loadConfig(path, url, key string) (*config, error) {
+	cfg := &config{}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+
+		if err == nil {
+			if err := json.Unmarshal(data, cfg); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if env := os.Getenv("DFS_URL"); env != "" {
+		cfg.URL = env
+	}
+
+	if env := os.Getenv("DFS_API_KEY"); env != "" {
+		cfg.APIKey = env
+	}
+
+	if url != "" {
+		cfg.URL = url
+	}
+
+	if key != "" {
+		cfg.APIKey = key
+	}
+
+	if cfg.URL == "" {
+		return nil, errors.New("no metadata server URL, set -url, DFS_URL or url in " + path)
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"dfs/fs"
+	"dfs/progress"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `usage: dfs [flags] <command> [args]
+
+Remote paths are written as dfs://name.
+
+commands:
+  cp [-r] [-ttl duration] [-compress] <src> <dst>
+                        copy files between the local disk and the store,
+                        uploads expire after the -ttl and are compressed
+                        with -compress
+  mv [-r] <src> <dst>   rename remote files
+  cat <path>            write a remote file to stdout
+  ls [path]             list remote files below a prefix
+  rm [-r] <path>        delete remote files
+  stat <path>           show details of a remote file
+  sync [-delete] [-n] <dir> <dst>
+                        upload new and changed files of a directory
+  restrict [flags]      print a narrower copy of the API key
+
+flags:
+`
+
+type cli struct {
+	fs     *fs.FS
+	key    string
+	quiet  bool
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func (c *cli) progress(label string) progress.BytesReadWithTotal {
+	if c.quiet {
+		return nil
+	}
+
+	return newProgressBar(c.stderr, label)
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+
+	url := flag.String("url", "", "metadata server URL (env DFS_URL)")
+	key := flag.String("key", "", "API key (env DFS_API_KEY)")
+	configPath := flag.String("config", defaultConfigPath(), "config file (env DFS_CONFIG)")
+	quiet := flag.Bool("q", false, "do not show progress")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := loadConfig(*configPath, *url, *key)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "dfs:", err)
+		os.Exit(1)
+	}
+
+	c := &cli{
+		fs:     fs.NewFS(cfg.URL, cfg.APIKey),
+		key:    cfg.APIKey,
+		quiet:  *quiet,
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+	}
+
+	commands := map[string]func([]string) error{
+		"cp":       c.cp,
+		"mv":       c.mv,
+		"cat":      c.cat,
+		"ls":       c.ls,
+		"rm":       c.rm,
+		"stat":     c.stat,
+		"sync":     c.sync,
+		"restrict": c.restrict,
+	}
+
+	cmd, ok := commands[flag.Arg(0)]
+
+	if !ok {
+		fmt.Fprintf(os.Stderr, "dfs: unknown command %q\n", flag.Arg(0))
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := cmd(flag.Args()[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "dfs:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"dfs/progress"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const barWidth = 30
+
+func formatBytes(n float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
+
+// newProgressBar returns a callback that renders a progress bar with the
+// current throughput for the transfer of label to w.
+func newProgressBar(w io.Writer, label string) progress.BytesReadWithTotal {
+	start := time.Now()
+	var last time.Time
+
+	return func(read, total uint64) error {
+		now := time.Now()
+		done := read >= total
+
+		// redraw at most ten times a second
+		if !done && now.Sub(last) < 100*time.Millisecond {
+			return nil
+		}
+		last = now
+
+		ratio := 1.0
+		if total > 0 {
+			ratio = float64(read) / float64(total)
+		}
+
+		filled := int(ratio * barWidth)
+		bar := strings.Repeat("=", filled)
+		if filled < barWidth {
+			bar += ">" + strings.Repeat(" ", barWidth-filled-1)
+		}
+
+		elapsed := now.Sub(start).Seconds()
+		rate := 0.0
+		if elapsed > 0 {
+			rate = float64(read) / elapsed
+		}
+
+		fmt.Fprintf(w, "\r%s [%s] %3.0f%% %s/%s %s/s ",
+			label, bar, ratio*100, formatBytes(float64(read)), formatBytes(float64(total)), formatBytes(rate))
+
+		if done {
+			fmt.Fprintln(w)
+		}
+
+		return nil
+	}
+}
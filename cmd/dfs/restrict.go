@@ -0,0 +1,62 @@
+package main
+
+import (
+	"dfs/auth"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// restrict derives a narrower auth key from the configured one. It works
+// offline, the metadata server checks the added caveats when the key is used.
+func (c *cli) restrict(args []string) error {
+	flags := flag.NewFlagSet("restrict", flag.ContinueOnError)
+	ops := flags.String("ops", "", "comma separated operations to allow: read, write, list, delete, admin")
+	prefixes := flags.String("prefix", "", "comma separated name prefixes to allow")
+	buckets := flags.String("bucket", "", "comma separated buckets to allow")
+	expires := flags.Duration("expires", 0, "how long the key stays valid")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 0 {
+		return errors.New("usage: dfs restrict [-ops ops] [-prefix prefixes] [-bucket buckets] [-expires duration]")
+	}
+
+	key, err := auth.Parse(c.key)
+
+	if err != nil {
+		return errors.New("the configured API key is not an auth key and can't be restricted")
+	}
+
+	var caveats []auth.Caveat
+
+	if *ops != "" {
+		var allowed []auth.Op
+
+		for _, op := range strings.Split(*ops, ",") {
+			allowed = append(allowed, auth.Op(op))
+		}
+
+		caveats = append(caveats, auth.AllowOps(allowed...))
+	}
+
+	if *prefixes != "" {
+		caveats = append(caveats, auth.AllowPrefixes(strings.Split(*prefixes, ",")...))
+	}
+
+	if *buckets != "" {
+		caveats = append(caveats, auth.AllowBuckets(strings.Split(*buckets, ",")...))
+	}
+
+	if *expires > 0 {
+		caveats = append(caveats, auth.ExpiresAt(time.Now().Add(*expires)))
+	}
+
+	fmt.Fprintln(c.stdout, key.Attenuate(caveats...).Encode())
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"dfs/dirsync"
+	"errors"
+	"flag"
+	"fmt"
+)
+
+// sync uploads the files of a local directory that are new or changed since
+// the last sync to a remote prefix.
+func (c *cli) sync(args []string) error {
+	flags := flag.NewFlagSet("sync", flag.ContinueOnError)
+	del := flags.Bool("delete", false, "delete remote files that don't exist locally")
+	dryRun := flags.Bool("n", false, "only print what would change")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	dst, ok := remote(flags.Arg(1))
+
+	if flags.NArg() != 2 || !ok {
+		return errors.New("usage: dfs sync [-delete] [-n] <dir> dfs://<prefix>")
+	}
+
+	opts := []func(*dirsync.Syncer){
+		dirsync.WithOnChange(func(change dirsync.Change) {
+			switch change.Action {
+			case dirsync.ActionUpload:
+				fmt.Fprintf(c.stdout, "upload %s (%s, %d bytes)\n", joinRemote(dst, change.Name), change.Reason, change.Size)
+			case dirsync.ActionDelete:
+				fmt.Fprintf(c.stdout, "delete %s\n", joinRemote(dst, change.Name))
+			}
+		}),
+	}
+
+	if *del {
+		opts = append(opts, dirsync.WithDelete())
+	}
+
+	if *dryRun {
+		opts = append(opts, dirsync.WithDryRun())
+	}
+
+	changes, err := dirsync.NewSyncer(c.fs, opts...).Sync(flags.Arg(0), dst)
+
+	if err != nil {
+		return err
+	}
+
+	if !c.quiet {
+		fmt.Fprintf(c.stderr, "%d changes\n", len(changes))
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"dfs/auth"
+	"dfs/metadata"
+	"dfs/types"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// parseLimit parses the size of a limit flag, zero if it is empty.
+func parseLimit(s string) int64 {
+	if s == "" {
+		return 0
+	}
+
+	n, err := types.ParseSize(s)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return n
+}
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to serve the metadata API on")
+	keys := flag.String("keys", "", "comma separated list of accepted API keys, empty accepts all requests")
+	rootKeyID := flag.String("root-key-id", "root", "ID of the root key auth keys are derived from")
+	rootSecret := flag.String("root-secret", os.Getenv("DFS_ROOT_SECRET"), "hex encoded secret of the root key, enables auth keys (env DFS_ROOT_SECRET)")
+	mint := flag.Bool("mint", false, "print an unrestricted auth key for the root key and exit")
+	orderSeed := flag.String("order-seed", os.Getenv("DFS_ORDER_SEED"), "hex encoded 32 byte seed of the key orders for storage nodes are signed with, empty to sign none (env DFS_ORDER_SEED)")
+	purgeInterval := flag.Duration("purge-interval", time.Hour, "how often to purge expired objects")
+	storageLimit := flag.String("storage-limit", "", "bytes every bucket may store unless given limits of its own, such as 100G, empty for no limit")
+	bandwidthLimit := flag.String("bandwidth-limit", "", "bytes every bucket may upload and download per month unless given limits of its own, empty for no limit")
+	flag.Parse()
+
+	store := metadata.NewStore(metadata.WithDefaultLimits(types.Limits{
+		Storage:   parseLimit(*storageLimit),
+		Bandwidth: parseLimit(*bandwidthLimit),
+	}))
+	opts := []func(*metadata.Server){metadata.WithStore(store)}
+
+	if *keys != "" {
+		opts = append(opts, metadata.WithAPIKeys(strings.Split(*keys, ",")...))
+	}
+
+	if *rootSecret != "" {
+		secret, err := hex.DecodeString(*rootSecret)
+
+		if err != nil {
+			log.Fatal("invalid root secret: ", err)
+		}
+
+		if *mint {
+			fmt.Println(auth.NewKey(*rootKeyID, secret).Encode())
+			return
+		}
+
+		opts = append(opts, metadata.WithRootKey(*rootKeyID, secret))
+	} else if *mint {
+		log.Fatal("-mint needs -root-secret")
+	}
+
+	if *orderSeed != "" {
+		seed, err := hex.DecodeString(*orderSeed)
+
+		if err != nil || len(seed) != ed25519.SeedSize {
+			log.Fatal("invalid order seed, expected 32 hex encoded bytes")
+		}
+
+		opts = append(opts, metadata.WithOrderKey(ed25519.NewKeyFromSeed(seed)))
+	}
+
+	srv := metadata.NewServer(opts...)
+
+	go func() {
+		for now := range time.Tick(*purgeInterval) {
+			if n := store.PurgeExpired(now); n > 0 {
+				log.Printf("purged %d expired objects", n)
+			}
+		}
+	}()
+
+	log.Fatal(http.ListenAndServe(*addr, srv.Handler()))
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"dfs/fs"
+	"dfs/localnet"
+	"dfs/s3gw"
+	"flag"
+	"log"
+	"net/http"
+)
+
+func main() {
+	addr := flag.String("addr", ":9090", "address to serve the S3 API on")
+	metadataURL := flag.String("metadata", "http://localhost:8080", "metadata server to use")
+	apiKey := flag.String("key", "", "API key for the metadata server")
+	accessKey := flag.String("access-key", "", "S3 access key clients sign requests with")
+	secretKey := flag.String("secret-key", "", "S3 secret key clients sign requests with")
+	local := flag.String("local", "", "run an in process network keeping pieces in this directory instead of using -metadata")
+	flag.Parse()
+
+	if *accessKey == "" || *secretKey == "" {
+		log.Fatal("-access-key and -secret-key are required")
+	}
+
+	fsys := fs.NewFS(*metadataURL, *apiKey)
+
+	if *local != "" {
+		net, err := localnet.Start(*local)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Printf("local network metadata server on %s", net.MetadataURL)
+
+		fsys = net.FS()
+	}
+
+	gw := s3gw.NewGateway(fsys, s3gw.WithCredentials(*accessKey, *secretKey))
+
+	log.Fatal(http.ListenAndServe(*addr, gw.Handler()))
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"dfs/client/api"
+	"dfs/identity"
+	"dfs/network"
+	"dfs/node"
+	"dfs/node/piecestore"
+	"dfs/orders"
+	"dfs/types"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// loadNodeKey reads the identity key of the node from dir, creating one on
+// first start so the node keeps its identity across restarts.
+func loadNodeKey(dir string) (ed25519.PrivateKey, error) {
+	path := filepath.Join(dir, "node-key")
+
+	data, err := os.ReadFile(path)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		_, key, err := ed25519.GenerateKey(nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return key, os.WriteFile(path, []byte(hex.EncodeToString(key.Seed())), 0o600)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	seed, err := hex.DecodeString(strings.TrimSpace(string(data)))
+
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid node key in %s", path)
+	}
+
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// reportCapacity keeps the metadata server up to date with the room left on
+// the node.
+func reportCapacity(client *api.Client, id types.NodeID, store *piecestore.Store, interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := client.ReportCapacity(id, uint64(store.Capacity()), uint64(store.Free())); err != nil {
+			log.Printf("could not report capacity: %v", err)
+		}
+	}
+}
+
+// loadOrderKey decodes the order key of the flag or asks the metadata server
+// for it. It returns nil if the metadata server signs no orders, in which case
+// the node accepts all piece traffic.
+func loadOrderKey(client *api.Client, flagValue string) (ed25519.PublicKey, error) {
+	if flagValue != "" {
+		key, err := hex.DecodeString(flagValue)
+
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid order key %q", flagValue)
+		}
+
+		return key, nil
+	}
+
+	key, err := client.OrderKey()
+
+	if errors.Is(err, types.ErrOrdersDisabled) {
+		log.Printf("the metadata server signs no orders, accepting all piece traffic")
+		return nil, nil
+	}
+
+	return key, err
+}
+
+// settleBatch is the most settlements sent in one usage report.
+const settleBatch = 1000
+
+// settleUsage reports the traffic the node served for orders that expired to
+// the metadata server, in signed batches. Batches that could not be sent are
+// tried again on the next tick.
+func settleUsage(client *api.Client, srv *node.Server, key ed25519.PrivateKey, interval time.Duration) {
+	for now := range time.Tick(interval) {
+		settlements := srv.Unsettled(now)
+
+		for len(settlements) > 0 {
+			batch := settlements[:min(len(settlements), settleBatch)]
+			settlements = settlements[len(batch):]
+
+			report := &types.UsageReport{NodeID: srv.ID(), Settlements: batch}
+			orders.SignReport(report, key)
+
+			resp, err := client.SettleUsage(report)
+
+			if err != nil {
+				log.Printf("could not settle usage: %v", err)
+				break
+			}
+
+			srv.Settled(batch)
+
+			log.Printf("settled %d orders, %d rejected", resp.Accepted, resp.Rejected)
+		}
+	}
+}
+
+// scanPieces re-hashes the stored pieces once per interval and quarantines
+// the ones that rotted on disk. They are reported to the metadata server, if
+// there is one, and reported again on the next tick if that fails.
+func scanPieces(client *api.Client, id types.NodeID, scanner *piecestore.Scanner, interval time.Duration) {
+	var lost []types.PieceID
+
+	for range time.Tick(interval) {
+		corrupted, err := scanner.Scan()
+
+		if err != nil {
+			log.Printf("could not scan pieces: %v", err)
+		}
+
+		if len(corrupted) > 0 {
+			log.Printf("quarantined %d corrupted pieces", len(corrupted))
+		}
+
+		lost = append(lost, corrupted...)
+
+		if client == nil || len(lost) == 0 {
+			continue
+		}
+
+		if err := client.ReportLostPieces(id, lost); err != nil {
+			log.Printf("could not report lost pieces: %v", err)
+			continue
+		}
+
+		lost = nil
+	}
+}
+
+// exitRetry is how long a graceful exit waits before it tries again after an
+// error.
+const exitRetry = time.Minute
+
+// gracefulExit transfers the pieces of the node to the nodes the metadata
+// server picks until none are left. The node keeps serving its pieces
+// meanwhile and keeps them afterwards, it can be shut down once the exit
+// finished.
+func gracefulExit(client *api.Client, id types.NodeID, store *piecestore.Store) {
+	nn := network.NewNetwork(network.WithApiClient(client))
+
+	read := func(piece types.PieceID) ([]byte, error) {
+		f, err := store.Open(piece)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer f.Close()
+
+		return io.ReadAll(f)
+	}
+
+	progress := func(status *types.ExitStatus) {
+		log.Printf("graceful exit: %d of %d pieces transferred, %d failed", status.Transferred, status.Pieces, status.Failed)
+	}
+
+	for {
+		status, err := nn.Exit(id, read, progress)
+
+		if err == nil {
+			log.Printf("graceful exit finished, %d pieces transferred, %d failed, the node can be shut down", status.Transferred, status.Failed)
+			return
+		}
+
+		log.Printf("graceful exit interrupted, trying again in %v: %v", exitRetry, err)
+		time.Sleep(exitRetry)
+	}
+}
+
+// deleteExpired deletes the pieces that expired, without waiting for the
+// metadata server or clients to ask for it.
+func deleteExpired(store *piecestore.Store, interval time.Duration) {
+	for now := range time.Tick(interval) {
+		n, err := store.DeleteExpired(now)
+
+		if err != nil {
+			log.Printf("could not delete expired pieces: %v", err)
+		}
+
+		if n > 0 {
+			log.Printf("deleted %d expired pieces", n)
+		}
+	}
+}
+
+// advertiseAddr is the address clients reach a listen address on. Listen
+// addresses without a host, or with an unspecified one, are reached on the
+// host name of the machine.
+func advertiseAddr(listen string) (string, error) {
+	host, port, err := net.SplitHostPort(listen)
+
+	if err != nil {
+		return "", err
+	}
+
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host, err = os.Hostname()
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
+
+func main() {
+	dir := flag.String("dir", "pieces", "directory to store pieces in")
+	httpAddr := flag.String("http", ":9000", "address to serve the HTTP piece API on")
+	grpcAddr := flag.String("grpc", ":9001", "address to serve the gRPC piece service on, empty to disable")
+	metadataURL := flag.String("metadata", "", "metadata server to register with")
+	apiKey := flag.String("key", "", "API key for the metadata server")
+	advertiseHTTP := flag.String("advertise-http", "", "HTTP URL clients reach the node on, derived from -http and the host name if empty")
+	advertiseGRPC := flag.String("advertise-grpc", "", "address clients reach the gRPC service on, derived from -grpc and the host name if empty")
+	capacityFlag := flag.String("capacity", "", "space to allocate for pieces, such as 500G, empty for no limit")
+	reportInterval := flag.Duration("report-interval", time.Minute, "how often to report free capacity to the metadata server")
+	expireInterval := flag.Duration("expire-interval", 10*time.Minute, "how often to delete expired pieces")
+	orderKeyFlag := flag.String("order-key", "", "hex encoded public key orders are signed with, fetched from the metadata server if empty")
+	settleInterval := flag.Duration("settle-interval", 15*time.Minute, "how often to settle the traffic of expired orders with the metadata server")
+	exit := flag.Bool("exit", false, "leave the network, transferring all pieces to other nodes")
+	scanInterval := flag.Duration("scan-interval", 24*time.Hour, "how often to check stored pieces for corruption, 0 to disable")
+	scanRateFlag := flag.String("scan-rate", "8M", "bytes per second to read when checking pieces, such as 8M, empty for no limit")
+	rebuildIndex := flag.Bool("rebuild-index", false, "rebuild the piece index from the pieces on disk and exit")
+	flag.Parse()
+
+	if *rebuildIndex {
+		n, err := piecestore.Rebuild(*dir)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Printf("rebuilt the piece index with %d pieces", n)
+		return
+	}
+
+	if *exit && *metadataURL == "" {
+		log.Fatal("a graceful exit needs the metadata server")
+	}
+
+	if *advertiseHTTP == "" {
+		addr, err := advertiseAddr(*httpAddr)
+
+		if err != nil {
+			log.Fatalf("can't derive -advertise-http from -http %q, set it explicitly: %v", *httpAddr, err)
+		}
+
+		*advertiseHTTP = "http://" + addr
+	}
+
+	if *advertiseGRPC == "" && *grpcAddr != "" {
+		addr, err := advertiseAddr(*grpcAddr)
+
+		if err != nil {
+			log.Fatalf("can't derive -advertise-grpc from -grpc %q, set it explicitly: %v", *grpcAddr, err)
+		}
+
+		*advertiseGRPC = addr
+	}
+
+	capacity, err := types.ParseSize(*capacityFlag)
+
+	if *capacityFlag != "" && err != nil {
+		log.Fatal(err)
+	}
+
+	store, err := piecestore.New(*dir, piecestore.WithCapacity(capacity))
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	go deleteExpired(store, *expireInterval)
+
+	scanRate, err := types.ParseSize(*scanRateFlag)
+
+	if *scanRateFlag != "" && err != nil {
+		log.Fatal(err)
+	}
+
+	key, err := loadNodeKey(*dir)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	pub := key.Public().(ed25519.PublicKey)
+	id := identity.NodeID(pub)
+
+	opts := []func(*node.Server){node.WithStore(store), node.WithIdentity(key)}
+
+	var client *api.Client
+	var orderKey ed25519.PublicKey
+
+	if *metadataURL != "" {
+		client = api.NewClient(*metadataURL, *apiKey)
+
+		orderKey, err = loadOrderKey(client, *orderKeyFlag)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if orderKey != nil {
+			opts = append(opts, node.WithOrderKey(orderKey))
+		}
+
+		self := &types.Node{
+			ID:             id,
+			HttpAddr:       *advertiseHTTP,
+			GRPCAddr:       *advertiseGRPC,
+			Capacity:       uint64(store.Capacity()),
+			Free:           uint64(store.Free()),
+			RequiresOrders: orderKey != nil,
+			PublicKey:      pub,
+		}
+
+		if err := client.RegisterNode(self); err != nil {
+			log.Fatal(err)
+		}
+
+		log.Printf("registered node %s with %s", id, *metadataURL)
+
+		if capacity > 0 {
+			go reportCapacity(client, id, store, *reportInterval)
+		}
+
+		if *exit {
+			go gracefulExit(client, id, store)
+		}
+	}
+
+	if *scanInterval > 0 {
+		go scanPieces(client, id, piecestore.NewScanner(store, piecestore.WithScanRate(scanRate)), *scanInterval)
+	}
+
+	srv := node.NewServer(opts...)
+
+	// only traffic with orders is accounted
+	if orderKey != nil {
+		go settleUsage(client, srv, key, *settleInterval)
+	}
+
+	if *grpcAddr != "" {
+		lis, err := net.Listen("tcp", *grpcAddr)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		g := grpc.NewServer()
+		srv.RegisterGRPC(g)
+
+		go func() {
+			log.Fatal(g.Serve(lis))
+		}()
+	}
+
+	log.Fatal(http.ListenAndServe(*httpAddr, srv.Handler()))
+}
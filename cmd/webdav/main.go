@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/subtle"
+	"dfs/davfs"
+	"dfs/fs"
+	"dfs/localnet"
+	"flag"
+	"log"
+	"net/http"
+)
+
+func main() {
+	addr := flag.String("addr", ":8070", "address to serve WebDAV on")
+	metadataURL := flag.String("metadata", "http://localhost:8080", "metadata server to use")
+	apiKey := flag.String("key", "", "API key for the metadata server")
+	prefix := flag.String("prefix", "", "serve only the objects below this prefix, for example a bucket")
+	user := flag.String("user", "", "user name for basic auth, empty serves without auth")
+	password := flag.String("password", "", "password for basic auth")
+	local := flag.String("local", "", "run an in process network keeping pieces in this directory instead of using -metadata")
+	flag.Parse()
+
+	fsys := fs.NewFS(*metadataURL, *apiKey)
+
+	if *local != "" {
+		net, err := localnet.Start(*local)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Printf("local network metadata server on %s", net.MetadataURL)
+
+		fsys = net.FS()
+	}
+
+	var handler http.Handler = davfs.NewFileSystem(fsys, davfs.WithPrefix(*prefix)).Handler()
+
+	if *user != "" {
+		next := handler
+
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			u, p, ok := r.BasicAuth()
+
+			if !ok || subtle.ConstantTimeCompare([]byte(u), []byte(*user)) != 1 || subtle.ConstantTimeCompare([]byte(p), []byte(*password)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="dfs"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	log.Fatal(http.ListenAndServe(*addr, handler))
+}
@@ -0,0 +1,72 @@
+package compression
+
+import (
+	"errors"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	None = ""
+	Zstd = "zstd"
+)
+
+// sampleSize is how much of the input is test compressed before the whole
+// input is.
+const sampleSize = 64 * 1024
+
+// minSavings is the fraction of the input that compression has to save for
+// the compressed form to be kept.
+const minSavings = 0.05
+
+var ErrUnknownAlgorithm = errors.New("unknown compression algorithm")
+
+var (
+	encoder, _ = zstd.NewWriter(nil)
+	decoder, _ = zstd.NewReader(nil)
+)
+
+func worthIt(in, out int) bool {
+	return float64(out) <= float64(in)*(1-minSavings)
+}
+
+// Compress compresses data with the algorithm. The returned algorithm is None
+// and data is returned as is when it does not compress well enough to be
+// worth decompressing later.
+func Compress(algorithm string, data []byte) (string, []byte, error) {
+	switch algorithm {
+	case None:
+		return None, data, nil
+	case Zstd:
+	default:
+		return None, nil, ErrUnknownAlgorithm
+	}
+
+	if len(data) > sampleSize {
+		sample := encoder.EncodeAll(data[:sampleSize], nil)
+
+		if !worthIt(sampleSize, len(sample)) {
+			return None, data, nil
+		}
+	}
+
+	compressed := encoder.EncodeAll(data, make([]byte, 0, len(data)/2))
+
+	if !worthIt(len(data), len(compressed)) {
+		return None, data, nil
+	}
+
+	return Zstd, compressed, nil
+}
+
+// Decompress reverses Compress. size is the size of the uncompressed data.
+func Decompress(algorithm string, data []byte, size uint64) ([]byte, error) {
+	switch algorithm {
+	case None:
+		return data, nil
+	case Zstd:
+		return decoder.DecodeAll(data, make([]byte, 0, size))
+	default:
+		return nil, ErrUnknownAlgorithm
+	}
+}
@@ -0,0 +1,61 @@
+package compression_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"dfs/compression"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	t.Run("can compress and decompress data", func(t *testing.T) {
+		data := bytes.Repeat([]byte(`{"level":"info","msg":"request served"}`+"\n"), 10000)
+
+		algorithm, compressed, err := compression.Compress(compression.Zstd, data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if algorithm != compression.Zstd {
+			t.Fatalf("expected zstd, got %q", algorithm)
+		}
+
+		if len(compressed) >= len(data) {
+			t.Fatalf("expected compressed data to be smaller")
+		}
+
+		result, err := compression.Decompress(algorithm, compressed, uint64(len(data)))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !bytes.Equal(result, data) {
+			t.Fatalf("expected data to be equal")
+		}
+	})
+
+	t.Run("skips incompressible data", func(t *testing.T) {
+		data := make([]byte, 256*1024)
+		rand.Read(data)
+
+		algorithm, result, err := compression.Compress(compression.Zstd, data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if algorithm != compression.None {
+			t.Fatalf("expected no compression, got %q", algorithm)
+		}
+
+		if !bytes.Equal(result, data) {
+			t.Fatalf("expected data to be returned as is")
+		}
+	})
+
+	t.Run("rejects unknown algorithms", func(t *testing.T) {
+		_, _, err := compression.Compress("lz77", []byte("hello"))
+		if err != compression.ErrUnknownAlgorithm {
+			t.Fatalf("expected %v, got %v", compression.ErrUnknownAlgorithm, err)
+		}
+	})
+}
@@ -0,0 +1,255 @@
+// Package davfs serves a FS over WebDAV so that it can be mounted by the
+// file managers of desktop operating systems.
+//
+// Files are objects, directories are emulated over object name prefixes: a
+// directory exists if any object is named below it. Empty directories are
+// kept as a zero sized object named like the directory with a trailing
+// slash.
+package davfs
+
+import (
+	"context"
+	"dfs/fs"
+	"dfs/types"
+	"errors"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/net/webdav"
+)
+
+type FileSystem struct {
+	fs     *fs.FS
+	prefix string
+}
+
+// WithPrefix serves only the objects below prefix, for example a bucket.
+func WithPrefix(prefix string) func(*FileSystem) {
+	return func(f *FileSystem) {
+		f.prefix = strings.Trim(prefix, "/")
+	}
+}
+
+func NewFileSystem(fsys *fs.FS, opts ...func(*FileSystem)) *FileSystem {
+	f := &FileSystem{fs: fsys}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	return f
+}
+
+// Handler returns the WebDAV handler for the file system.
+func (f *FileSystem) Handler() *webdav.Handler {
+	return &webdav.Handler{
+		FileSystem: f,
+		LockSystem: webdav.NewMemLS(),
+	}
+}
+
+// objectName maps a slash separated WebDAV name to the object name.
+func (f *FileSystem) objectName(name string) string {
+	name = strings.Trim(path.Clean("/"+name), "/")
+
+	if f.prefix == "" {
+		return name
+	}
+
+	if name == "" {
+		return f.prefix
+	}
+
+	return f.prefix + "/" + name
+}
+
+func mapError(err error) error {
+	switch {
+	case errors.Is(err, types.ErrObjectNotFound):
+		return os.ErrNotExist
+	case errors.Is(err, types.ErrObjectExists):
+		return os.ErrExist
+	default:
+		return err
+	}
+}
+
+// stat looks the object name up as a file, then as a directory.
+func (f *FileSystem) stat(name string) (*fileInfo, error) {
+	if name == f.prefix {
+		return &fileInfo{name: "/", dir: true}, nil
+	}
+
+	obj, err := f.fs.StatObject(name)
+
+	if err == nil {
+		return newFileInfo(obj), nil
+	}
+
+	if !errors.Is(err, types.ErrObjectNotFound) {
+		return nil, err
+	}
+
+	objs, err := f.fs.List(types.DirPrefix(name))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(objs) == 0 {
+		return nil, os.ErrNotExist
+	}
+
+	return &fileInfo{name: path.Base(name), dir: true}, nil
+}
+
+// checkParent returns os.ErrNotExist unless the parent of the object name is
+// a directory.
+func (f *FileSystem) checkParent(name string) error {
+	parent := path.Dir(name)
+
+	if parent == "." {
+		parent = ""
+	}
+
+	if parent == f.prefix {
+		return nil
+	}
+
+	fi, err := f.stat(parent)
+
+	if err != nil {
+		return err
+	}
+
+	if !fi.dir {
+		return os.ErrNotExist
+	}
+
+	return nil
+}
+
+func (f *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	return f.stat(f.objectName(name))
+}
+
+func (f *FileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	obj := f.objectName(name)
+
+	if _, err := f.stat(obj); err == nil {
+		return os.ErrExist
+	}
+
+	if err := f.checkParent(obj); err != nil {
+		return err
+	}
+
+	_, err := f.fs.WriteFile(types.DirPrefix(obj), strings.NewReader(""), 0, nil)
+
+	return mapError(err)
+}
+
+func (f *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	obj := f.objectName(name)
+
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC) != 0 {
+		if fi, err := f.stat(obj); err == nil && fi.dir {
+			return nil, os.ErrInvalid
+		}
+
+		if err := f.checkParent(obj); err != nil {
+			return nil, err
+		}
+
+		return newWriteFile(f.fs, obj)
+	}
+
+	fi, err := f.stat(obj)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if fi.dir {
+		return &dirFile{fsys: f, name: obj, info: fi}, nil
+	}
+
+	return &readFile{ObjectReader: f.fs.NewObjectReader(fi.obj), info: fi}, nil
+}
+
+// RemoveAll deletes the file, or the directory with everything below it.
+func (f *FileSystem) RemoveAll(ctx context.Context, name string) error {
+	obj := f.objectName(name)
+
+	if obj == f.prefix {
+		return os.ErrPermission
+	}
+
+	err := f.fs.DeleteFile(obj)
+
+	if err == nil {
+		return nil
+	}
+
+	if !errors.Is(err, types.ErrObjectNotFound) {
+		return err
+	}
+
+	objs, err := f.fs.List(types.DirPrefix(obj))
+
+	if err != nil {
+		return err
+	}
+
+	if len(objs) == 0 {
+		return os.ErrNotExist
+	}
+
+	for _, o := range objs {
+		if err := f.fs.DeleteFile(o.Name); err != nil && !errors.Is(err, types.ErrObjectNotFound) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Rename moves the file, or every object below the directory, without
+// transferring any data.
+func (f *FileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	src := f.objectName(oldName)
+	dst := f.objectName(newName)
+
+	if src == f.prefix || dst == f.prefix {
+		return os.ErrPermission
+	}
+
+	if err := f.checkParent(dst); err != nil {
+		return err
+	}
+
+	_, err := f.fs.MoveFile(src, dst)
+
+	if err == nil || !errors.Is(err, types.ErrObjectNotFound) {
+		return mapError(err)
+	}
+
+	objs, err := f.fs.List(types.DirPrefix(src))
+
+	if err != nil {
+		return err
+	}
+
+	if len(objs) == 0 {
+		return os.ErrNotExist
+	}
+
+	for _, o := range objs {
+		if _, err := f.fs.MoveFile(o.Name, types.DirPrefix(dst)+strings.TrimPrefix(o.Name, types.DirPrefix(src))); err != nil {
+			return mapError(err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package davfs_test
+
+import (
+	"dfs/davfs"
+	"dfs/localnet"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func do(t *testing.T, method, url string, body string, header map[string]string) (*http.Response, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return res, string(data)
+}
+
+func TestWebDAV(t *testing.T) {
+	net, err := localnet.Start(t.TempDir())
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	defer net.Close()
+
+	fsys := net.FS()
+	srv := httptest.NewServer(davfs.NewFileSystem(fsys, davfs.WithPrefix("bucket")).Handler())
+	defer srv.Close()
+
+	data := "hello webdav world!"
+
+	t.Run("make directory", func(t *testing.T) {
+		res, _ := do(t, "MKCOL", srv.URL+"/docs", "", nil)
+
+		if res.StatusCode != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d", http.StatusCreated, res.StatusCode)
+		}
+
+		if _, err := fsys.StatObject("bucket/docs/"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("put needs parent", func(t *testing.T) {
+		res, _ := do(t, http.MethodPut, srv.URL+"/missing/a.txt", data, nil)
+
+		if res.StatusCode != http.StatusNotFound {
+			t.Fatalf("expected status %d, got %d", http.StatusNotFound, res.StatusCode)
+		}
+	})
+
+	t.Run("put", func(t *testing.T) {
+		res, _ := do(t, http.MethodPut, srv.URL+"/docs/a.txt", data, nil)
+
+		if res.StatusCode != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d", http.StatusCreated, res.StatusCode)
+		}
+
+		obj, err := fsys.StatObject("bucket/docs/a.txt")
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if obj.Size != uint64(len(data)) {
+			t.Fatalf("expected size %d, got %d", len(data), obj.Size)
+		}
+	})
+
+	t.Run("propfind", func(t *testing.T) {
+		res, body := do(t, "PROPFIND", srv.URL+"/docs/", "", map[string]string{"Depth": "1"})
+
+		if res.StatusCode != http.StatusMultiStatus {
+			t.Fatalf("expected status %d, got %d", http.StatusMultiStatus, res.StatusCode)
+		}
+
+		if !strings.Contains(body, "/docs/a.txt") || !strings.Contains(body, "text/plain") {
+			t.Fatalf("expected a.txt in listing, got %s", body)
+		}
+	})
+
+	t.Run("get range", func(t *testing.T) {
+		res, body := do(t, http.MethodGet, srv.URL+"/docs/a.txt", "", map[string]string{"Range": "bytes=6-11"})
+
+		if res.StatusCode != http.StatusPartialContent {
+			t.Fatalf("expected status %d, got %d", http.StatusPartialContent, res.StatusCode)
+		}
+
+		if body != data[6:12] {
+			t.Fatalf("expected %q, got %q", data[6:12], body)
+		}
+	})
+
+	t.Run("copy", func(t *testing.T) {
+		res, _ := do(t, "COPY", srv.URL+"/docs/a.txt", "", map[string]string{"Destination": srv.URL + "/b.txt"})
+
+		if res.StatusCode != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d", http.StatusCreated, res.StatusCode)
+		}
+
+		src, err := fsys.StatObject("bucket/docs/a.txt")
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		dst, err := fsys.StatObject("bucket/b.txt")
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if src.Segments[0].Pieces[0].ID != dst.Segments[0].Pieces[0].ID {
+			t.Fatalf("expected copy to share the pieces")
+		}
+	})
+
+	t.Run("move directory", func(t *testing.T) {
+		res, _ := do(t, "MOVE", srv.URL+"/docs/", "", map[string]string{"Destination": srv.URL + "/notes/"})
+
+		if res.StatusCode != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d", http.StatusCreated, res.StatusCode)
+		}
+
+		res, body := do(t, http.MethodGet, srv.URL+"/notes/a.txt", "", nil)
+
+		if res.StatusCode != http.StatusOK || body != data {
+			t.Fatalf("expected %q, got %d %q", data, res.StatusCode, body)
+		}
+
+		res, _ = do(t, http.MethodGet, srv.URL+"/docs/a.txt", "", nil)
+
+		if res.StatusCode != http.StatusNotFound {
+			t.Fatalf("expected status %d, got %d", http.StatusNotFound, res.StatusCode)
+		}
+	})
+
+	t.Run("delete directory", func(t *testing.T) {
+		res, _ := do(t, http.MethodDelete, srv.URL+"/notes/", "", nil)
+
+		if res.StatusCode != http.StatusNoContent {
+			t.Fatalf("expected status %d, got %d", http.StatusNoContent, res.StatusCode)
+		}
+
+		objs, err := fsys.List("bucket/notes/")
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(objs) != 0 {
+			t.Fatalf("expected no objects, got %d", len(objs))
+		}
+	})
+}
@@ -0,0 +1,285 @@
+package davfs
+
+import (
+	"context"
+	"dfs/fs"
+	"dfs/types"
+	"errors"
+	"io"
+	iofs "io/fs"
+	"mime"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+type fileInfo struct {
+	name string
+	size int64
+	dir  bool
+	obj  *types.Object
+}
+
+func newFileInfo(obj *types.Object) *fileInfo {
+	return &fileInfo{
+		name: path.Base(obj.Name),
+		size: int64(obj.Size),
+		obj:  obj,
+	}
+}
+
+func (fi *fileInfo) Name() string { return fi.name }
+func (fi *fileInfo) Size() int64  { return fi.size }
+func (fi *fileInfo) IsDir() bool  { return fi.dir }
+func (fi *fileInfo) Sys() any     { return fi.obj }
+
+// ModTime is the zero time for directories, which have no object.
+func (fi *fileInfo) ModTime() time.Time {
+	if fi.obj == nil {
+		return time.Time{}
+	}
+
+	return fi.obj.ModifiedAt
+}
+
+func (fi *fileInfo) Mode() iofs.FileMode {
+	if fi.dir {
+		return iofs.ModeDir | 0o755
+	}
+
+	return 0o644
+}
+
+// ETag implements webdav.ETager, see types.Object.ETag.
+func (fi *fileInfo) ETag(ctx context.Context) (string, error) {
+	if fi.obj == nil {
+		return "", webdav.ErrNotImplemented
+	}
+
+	return fi.obj.ETag(), nil
+}
+
+// ContentType implements webdav.ContentTyper, which keeps the handler from
+// reading every listed file to sniff its type.
+func (fi *fileInfo) ContentType(ctx context.Context) (string, error) {
+	if fi.obj != nil {
+		return fi.obj.MediaType(), nil
+	}
+
+	if t := mime.TypeByExtension(path.Ext(fi.name)); t != "" {
+		return t, nil
+	}
+
+	return "application/octet-stream", nil
+}
+
+var errIsDir = errors.New("is a directory")
+var errNotDir = errors.New("not a directory")
+var errReadOnly = errors.New("file is open for reading")
+
+type readFile struct {
+	*fs.ObjectReader
+	info *fileInfo
+}
+
+func (f *readFile) Readdir(count int) ([]iofs.FileInfo, error) {
+	return nil, errNotDir
+}
+
+func (f *readFile) Stat() (iofs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *readFile) Write(p []byte) (int, error) {
+	return 0, errReadOnly
+}
+
+type dirFile struct {
+	fsys     *FileSystem
+	name     string
+	info     *fileInfo
+	children []iofs.FileInfo
+	listed   bool
+}
+
+func (d *dirFile) list() error {
+	prefix := types.DirPrefix(d.name)
+
+	objs, err := d.fsys.fs.List(prefix)
+
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+
+	for _, obj := range objs {
+		rest := strings.TrimPrefix(obj.Name, prefix)
+
+		// the marker of the directory itself
+		if rest == "" {
+			continue
+		}
+
+		if i := strings.Index(rest, "/"); i >= 0 {
+			if !seen[rest[:i]] {
+				seen[rest[:i]] = true
+				d.children = append(d.children, &fileInfo{name: rest[:i], dir: true})
+			}
+
+			continue
+		}
+
+		if !seen[rest] {
+			seen[rest] = true
+			d.children = append(d.children, newFileInfo(obj))
+		}
+	}
+
+	d.listed = true
+
+	return nil
+}
+
+func (d *dirFile) Readdir(count int) ([]iofs.FileInfo, error) {
+	if !d.listed {
+		if err := d.list(); err != nil {
+			return nil, err
+		}
+	}
+
+	if count <= 0 {
+		children := d.children
+		d.children = nil
+		return children, nil
+	}
+
+	if len(d.children) == 0 {
+		return nil, io.EOF
+	}
+
+	n := min(count, len(d.children))
+	children := d.children[:n]
+	d.children = d.children[n:]
+
+	return children, nil
+}
+
+func (d *dirFile) Stat() (iofs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *dirFile) Read(p []byte) (int, error) {
+	return 0, errIsDir
+}
+
+func (d *dirFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, errIsDir
+}
+
+func (d *dirFile) Write(p []byte) (int, error) {
+	return 0, errIsDir
+}
+
+func (d *dirFile) Close() error {
+	return nil
+}
+
+// writeFile collects what is written in a temporary file and uploads it on
+// Close, as the size of an object has to be known before it is written.
+type writeFile struct {
+	fs   *fs.FS
+	name string
+	tmp  *os.File
+
+	// copyFrom is set when the file is filled from another file, which is
+	// then copied on the metadata server instead.
+	copyFrom *types.Object
+}
+
+func newWriteFile(fsys *fs.FS, name string) (*writeFile, error) {
+	tmp, err := os.CreateTemp("", "davfs-*")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &writeFile{fs: fsys, name: name, tmp: tmp}, nil
+}
+
+func (w *writeFile) Write(p []byte) (int, error) {
+	return w.tmp.Write(p)
+}
+
+// ReadFrom lets io.Copy from a file of the file system, which is how COPY
+// fills the destination, copy the object without transferring data.
+func (w *writeFile) ReadFrom(r io.Reader) (int64, error) {
+	if src, ok := r.(*readFile); ok && w.copyFrom == nil {
+		w.copyFrom = src.info.obj
+		return src.info.size, nil
+	}
+
+	return io.Copy(w.tmp, r)
+}
+
+func (w *writeFile) Read(p []byte) (int, error) {
+	return w.tmp.Read(p)
+}
+
+func (w *writeFile) Seek(offset int64, whence int) (int64, error) {
+	return w.tmp.Seek(offset, whence)
+}
+
+func (w *writeFile) Readdir(count int) ([]iofs.FileInfo, error) {
+	return nil, errNotDir
+}
+
+func (w *writeFile) Stat() (iofs.FileInfo, error) {
+	if w.copyFrom != nil {
+		return &fileInfo{name: path.Base(w.name), size: int64(w.copyFrom.Size), obj: w.copyFrom}, nil
+	}
+
+	fi, err := w.tmp.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileInfo{name: path.Base(w.name), size: fi.Size()}, nil
+}
+
+func (w *writeFile) Close() error {
+	defer os.Remove(w.tmp.Name())
+	defer w.tmp.Close()
+
+	if w.copyFrom != nil {
+		_, err := w.fs.CopyFile(w.copyFrom.Name, w.name)
+
+		if errors.Is(err, types.ErrObjectExists) {
+			if err := w.fs.DeleteFile(w.name); err != nil {
+				return err
+			}
+
+			_, err = w.fs.CopyFile(w.copyFrom.Name, w.name)
+		}
+
+		return mapError(err)
+	}
+
+	size, err := w.tmp.Seek(0, io.SeekEnd)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	_, err = w.fs.WriteFile(w.name, w.tmp, uint64(size), nil, fs.WithContentType(mime.TypeByExtension(path.Ext(w.name))))
+
+	return err
+}
@@ -1,27 +1,89 @@
 package main
 
 import (
+	"dfs/fs"
+	"dfs/httpgw"
+	"dfs/localnet"
+	"dfs/types"
+	"errors"
+	"flag"
+	"log"
 	"net/http"
-
-	"github.com/gin-gonic/gin"
+	"os"
 )
 
+// demoBucket holds the files the page references as blogger:app1/...
+const demoBucket = "blogger"
+
+// seed uploads the demo files to the bucket the page loads them from.
+func seed(fsys *fs.FS) error {
+	if _, err := fsys.CreateBucket(demoBucket); err != nil && !errors.Is(err, types.ErrBucketExists) {
+		return err
+	}
+
+	for _, name := range []string{"example.jpg", "script.js"} {
+		f, err := os.Open(name)
+
+		if err != nil {
+			return err
+		}
+
+		fi, err := f.Stat()
+
+		if err != nil {
+			f.Close()
+			return err
+		}
+
+		_, err = fsys.WriteFile(demoBucket+"/app1/"+name, f, uint64(fi.Size()), nil)
+		f.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func main() {
-	r := gin.Default()
-	r.LoadHTMLFiles("index.html")
+	addr := flag.String("addr", ":8000", "address to serve the demo on")
+	metadataURL := flag.String("metadata", "http://localhost:8080", "metadata server to use")
+	apiKey := flag.String("key", "", "API key for the metadata server")
+	local := flag.String("local", "", "run an in process network keeping pieces in this directory instead of using -metadata")
+	seedFiles := flag.Bool("seed", false, "upload the demo files before serving")
+	signedOnly := flag.Bool("signed-only", false, "serve share links only")
+	flag.Parse()
 
-	r.GET("/", func(c *gin.Context) {
-		c.Header("Content-Type", "text/html")
-		c.HTML(http.StatusOK, "index.html", gin.H{})
-	})
+	fsys := fs.NewFS(*metadataURL, *apiKey)
 
-	r.GET("/app1/example.jpg", func(c *gin.Context) {
-		c.File("example.jpg")
-	})
+	if *local != "" {
+		net, err := localnet.Start(*local)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fsys = net.FS()
+	}
+
+	if *seedFiles || *local != "" {
+		if err := seed(fsys); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var opts []func(*httpgw.Gateway)
+
+	if *signedOnly {
+		opts = append(opts, httpgw.WithSignedOnly())
+	}
 
-	r.GET("/app1/script.js", func(c *gin.Context) {
-		c.File("script.js")
+	mux := http.NewServeMux()
+	mux.Handle("/", httpgw.NewGateway(fsys, opts...).Handler())
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "index.html")
 	})
 
-	r.Run(":8080")
+	log.Fatal(http.ListenAndServe(*addr, mux))
 }
@@ -0,0 +1,250 @@
+// Package dirsync mirrors a local directory to a prefix of a FS, uploading
+// only the files that are new or changed since the last sync.
+//
+// The modification time of every uploaded file is kept in the metadata of its
+// object. A file whose size and modification time match is taken as unchanged
+// without reading it, otherwise it is hashed and only uploaded if the hash
+// differs from the content hash of the object. A file that was only touched
+// gets its new modification time recorded without uploading it again.
+package dirsync
+
+import (
+	"bytes"
+	"dfs/fs"
+	"dfs/hashutil"
+	"dfs/types"
+	"io"
+	iofs "io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// MetaModTime is the metadata key the modification time of synced files is
+// kept under, in nanoseconds since the epoch.
+const MetaModTime = "mtime"
+
+type Action string
+
+const (
+	ActionUpload Action = "upload"
+	ActionDelete Action = "delete"
+)
+
+// Change is a file a sync uploaded or deleted, or would have in a dry run.
+type Change struct {
+	Action Action
+
+	// Name is the slash separated path of the file relative to the synced
+	// directory.
+	Name string
+	Size int64
+
+	// Reason is "new" or "changed" for uploads, empty for deletes.
+	Reason string
+}
+
+type Syncer struct {
+	fs       *fs.FS
+	delete   bool
+	dryRun   bool
+	onChange func(Change)
+}
+
+// WithDelete deletes remote files that don't exist in the local directory.
+func WithDelete() func(*Syncer) {
+	return func(s *Syncer) {
+		s.delete = true
+	}
+}
+
+// WithDryRun only reports the changes a sync would make.
+func WithDryRun() func(*Syncer) {
+	return func(s *Syncer) {
+		s.dryRun = true
+	}
+}
+
+// WithOnChange calls fn for every change before it is made.
+func WithOnChange(fn func(Change)) func(*Syncer) {
+	return func(s *Syncer) {
+		s.onChange = fn
+	}
+}
+
+func NewSyncer(fsys *fs.FS, opts ...func(*Syncer)) *Syncer {
+	s := &Syncer{fs: fsys}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Sync makes the files below prefix match the regular files below dir and
+// returns the changes made. Symbolic links are skipped.
+func (s *Syncer) Sync(dir, prefix string) ([]Change, error) {
+	prefix = strings.Trim(prefix, "/")
+
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	objs, err := s.fs.List(prefix)
+
+	if err != nil {
+		return nil, err
+	}
+
+	remote := make(map[string]*types.Object, len(objs))
+
+	for _, obj := range objs {
+		remote[strings.TrimPrefix(obj.Name, prefix)] = obj
+	}
+
+	var changes []Change
+	local := make(map[string]bool)
+
+	err = filepath.WalkDir(dir, func(p string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, p)
+
+		if err != nil {
+			return err
+		}
+
+		name := filepath.ToSlash(rel)
+		local[name] = true
+
+		change, err := s.syncFile(p, name, prefix+name, remote[name])
+
+		if err != nil {
+			return err
+		}
+
+		if change != nil {
+			changes = append(changes, *change)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.delete {
+		return changes, nil
+	}
+
+	for _, obj := range objs {
+		name := strings.TrimPrefix(obj.Name, prefix)
+
+		// directory markers
+		if local[name] || strings.HasSuffix(name, "/") {
+			continue
+		}
+
+		change := Change{Action: ActionDelete, Name: name, Size: int64(obj.Size)}
+		s.report(change)
+
+		if !s.dryRun {
+			if err := s.fs.DeleteFile(obj.Name); err != nil {
+				return nil, err
+			}
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
+
+func (s *Syncer) report(change Change) {
+	if s.onChange != nil {
+		s.onChange(change)
+	}
+}
+
+// syncFile uploads the local file p as the object name unless obj, the
+// object currently stored there, holds the same content.
+func (s *Syncer) syncFile(p, name, objName string, obj *types.Object) (*Change, error) {
+	fi, err := os.Stat(p)
+
+	if err != nil {
+		return nil, err
+	}
+
+	modTime := strconv.FormatInt(fi.ModTime().UnixNano(), 10)
+	change := &Change{Action: ActionUpload, Name: name, Size: fi.Size(), Reason: "new"}
+
+	if obj != nil {
+		if obj.Size == uint64(fi.Size()) && obj.Metadata[MetaModTime] == modTime {
+			return nil, nil
+		}
+
+		change.Reason = "changed"
+	}
+
+	f, err := os.Open(p)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	h := hashutil.NewBlake3()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+
+	// only touched, the new modification time saves hashing it next time
+	if obj != nil && obj.Size == uint64(fi.Size()) && bytes.Equal(obj.ContentHash, h.Sum(nil)) {
+		if s.dryRun {
+			return nil, nil
+		}
+
+		metadata := maps.Clone(obj.Metadata)
+
+		// objects uploaded by other means have no metadata
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+
+		metadata[MetaModTime] = modTime
+
+		_, err := s.fs.UpdateFile(&types.UpdateObjectRequest{Name: objName, Metadata: metadata})
+
+		return nil, err
+	}
+
+	s.report(*change)
+
+	if s.dryRun {
+		return change, nil
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	metadata := map[string]string{MetaModTime: modTime}
+
+	if _, err := s.fs.WriteFile(objName, f, uint64(fi.Size()), nil, fs.WithMetadata(metadata)); err != nil {
+		return nil, err
+	}
+
+	return change, nil
+}
@@ -0,0 +1,154 @@
+package dirsync_test
+
+import (
+	"bytes"
+	"dfs/dirsync"
+	"dfs/localnet"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func summary(changes []dirsync.Change) string {
+	var s []string
+
+	for _, c := range changes {
+		s = append(s, fmt.Sprintf("%s %s %s", c.Action, c.Name, c.Reason))
+	}
+
+	return fmt.Sprint(s)
+}
+
+func TestSync(t *testing.T) {
+	net, err := localnet.Start(t.TempDir())
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	defer net.Close()
+
+	fsys := net.FS()
+	dir := t.TempDir()
+
+	writeFile(t, filepath.Join(dir, "a.txt"), "first file")
+	writeFile(t, filepath.Join(dir, "sub", "b.txt"), "second file")
+
+	sync := func(t *testing.T, expected string, opts ...func(*dirsync.Syncer)) {
+		t.Helper()
+
+		changes, err := dirsync.NewSyncer(fsys, opts...).Sync(dir, "backup")
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if summary(changes) != expected {
+			t.Fatalf("expected %s, got %s", expected, summary(changes))
+		}
+	}
+
+	t.Run("uploads new files", func(t *testing.T) {
+		sync(t, "[upload a.txt new upload sub/b.txt new]")
+
+		var buf bytes.Buffer
+
+		if _, err := fsys.ReadFileTo("backup/sub/b.txt", &buf, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if buf.String() != "second file" {
+			t.Fatalf("expected second file, got %s", buf.String())
+		}
+	})
+
+	t.Run("skips unchanged files", func(t *testing.T) {
+		sync(t, "[]")
+	})
+
+	t.Run("skips touched files", func(t *testing.T) {
+		later := time.Now().Add(time.Hour)
+
+		if err := os.Chtimes(filepath.Join(dir, "a.txt"), later, later); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		sync(t, "[]")
+
+		obj, err := fsys.StatObject("backup/a.txt")
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if expected := strconv.FormatInt(later.UnixNano(), 10); obj.Metadata[dirsync.MetaModTime] != expected {
+			t.Fatalf("expected mtime %s, got %s", expected, obj.Metadata[dirsync.MetaModTime])
+		}
+	})
+
+	t.Run("uploads changed files", func(t *testing.T) {
+		writeFile(t, filepath.Join(dir, "sub", "b.txt"), "second file, changed")
+		sync(t, "[upload sub/b.txt changed]")
+	})
+
+	t.Run("deletes remote extras", func(t *testing.T) {
+		data := []byte("extra")
+
+		if _, err := fsys.WriteFile("backup/extra.txt", bytes.NewReader(data), uint64(len(data)), nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		sync(t, "[]")
+		sync(t, "[delete extra.txt ]", dirsync.WithDelete(), dirsync.WithDryRun())
+
+		if _, err := fsys.StatObject("backup/extra.txt"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		sync(t, "[delete extra.txt ]", dirsync.WithDelete())
+		sync(t, "[]", dirsync.WithDelete())
+	})
+
+	t.Run("dry run does not upload", func(t *testing.T) {
+		writeFile(t, filepath.Join(dir, "c.txt"), "third file")
+
+		sync(t, "[upload c.txt new]", dirsync.WithDryRun())
+		sync(t, "[upload c.txt new]")
+	})
+
+	t.Run("records the modification time of objects uploaded without one", func(t *testing.T) {
+		data := []byte("fourth file")
+		writeFile(t, filepath.Join(dir, "d.txt"), string(data))
+
+		if _, err := fsys.WriteFile("backup/d.txt", bytes.NewReader(data), uint64(len(data)), nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		sync(t, "[]")
+
+		obj, err := fsys.StatObject("backup/d.txt")
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if obj.Metadata[dirsync.MetaModTime] == "" {
+			t.Fatalf("expected the modification time to be recorded")
+		}
+	})
+}
@@ -3,42 +3,240 @@ package fs
 import (
 	"dfs/client/api"
 	"dfs/network"
+	"dfs/progress"
 	"dfs/types"
+	"errors"
 	"io"
+	"sync"
+	"time"
 )
 
 type FS struct {
 	apiClient *api.Client
-	network   *network.NodeNetwork
+	network   *network.Network
+
+	mu          sync.Mutex
+	nodesLoaded bool
 }
 
-func NewFS(baseURL, apiKey string) *FS {
+// NewFS returns a FS backed by the metadata server at baseURL. Storage nodes
+// are looked up on the metadata server unless given with network.WithNodes.
+func NewFS(baseURL, apiKey string, opts ...func(*network.Network)) *FS {
 	apiClient := api.NewClient(baseURL, apiKey)
+	opts = append([]func(*network.Network){network.WithApiClient(apiClient)}, opts...)
+
 	return &FS{
 		apiClient: apiClient,
-		network:   network.NewNodeNetwork(network.WithApiClient(apiClient)),
+		network:   network.NewNetwork(opts...),
+	}
+}
+
+// loadNodes fetches the storage nodes from the metadata server the first
+// time they are needed.
+func (fs *FS) loadNodes() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.nodesLoaded || fs.network.NodeCount() > 0 {
+		return nil
 	}
+
+	if err := fs.network.RefreshNodes(); err != nil {
+		return err
+	}
+
+	fs.nodesLoaded = true
+
+	return nil
 }
 
-func (fs *FS) ReadFile(name string, w io.WriteCloser) (*types.Object, error) {
+// ReadFileTo writes the file to w.
+func (fs *FS) ReadFileTo(name string, w io.Writer, pc progress.BytesReadWithTotal) (*types.Object, error) {
 	obj, err := fs.apiClient.GetObject(name)
 	if err != nil {
 		return nil, err
 	}
 
-	fs.network.ReadObject(obj, w)
+	if err := fs.loadNodes(); err != nil {
+		return nil, err
+	}
+
+	err = fs.network.ReadObject(obj, w, pc)
+
+	if err != nil {
+		return nil, err
+	}
 
 	return obj, nil
 }
 
-// func (fs *FS) WriteFile(name string, r io.ReadCloser, pc progress.Callback) (*types.Object, error) {
-// 	obj := types.NewObject(name)
-// 	err := fs.apiClient.PutObject(&obj)
-// 	if err != nil {
-// 		return nil, err
-// 	}
+// ReadFileRange writes length bytes of the file starting at offset to w.
+func (fs *FS) ReadFileRange(name string, w io.Writer, offset, length uint64) (*types.Object, error) {
+	obj, err := fs.apiClient.GetObject(name)
+	if err != nil {
+		return nil, err
+	}
 
-// 	fs.network.WriteData(obj, r, pc)
+	if err := fs.ReadObjectRange(obj, w, offset, length); err != nil {
+		return nil, err
+	}
 
-// 	return obj, nil
-// }
+	return obj, nil
+}
+
+// ReadObjectRange is ReadFileRange for an object that was already looked up
+// with StatObject.
+func (fs *FS) ReadObjectRange(obj *types.Object, w io.Writer, offset, length uint64) error {
+	if err := fs.loadNodes(); err != nil {
+		return err
+	}
+
+	return fs.network.ReadObjectRange(obj, w, offset, length, nil)
+}
+
+// WithMetadata sets metadata on a file written with WriteFile.
+func WithMetadata(metadata map[string]string) func(*types.Object) {
+	return func(obj *types.Object) {
+		obj.Metadata = metadata
+	}
+}
+
+// WithContentType sets the media type of a file written with WriteFile.
+func WithContentType(contentType string) func(*types.Object) {
+	return func(obj *types.Object) {
+		obj.ContentType = contentType
+	}
+}
+
+// WithCompression compresses the segments of a file written with WriteFile
+// with the algorithm, see the compression package. Segments that don't
+// compress well are stored as is.
+func WithCompression(algorithm string) func(*types.Object) {
+	return func(obj *types.Object) {
+		obj.Compression = algorithm
+	}
+}
+
+// WithExpiresAt makes a file written with WriteFile expire at t. The storage
+// nodes delete its pieces and the metadata server stops serving it then.
+func WithExpiresAt(t time.Time) func(*types.Object) {
+	return func(obj *types.Object) {
+		obj.ExpiresAt = t
+	}
+}
+
+// WriteFile uploads size bytes from r as the file name, replacing the file if
+// it already exists. An existing file is only replaced once the new data is
+// written, it is kept if the upload fails.
+func (fs *FS) WriteFile(name string, r io.Reader, size uint64, pc progress.BytesReadWithTotal, opts ...func(*types.Object)) (*types.Object, error) {
+	if err := fs.loadNodes(); err != nil {
+		return nil, err
+	}
+
+	obj := types.NewObject(name)
+	obj.Size = size
+
+	for _, opt := range opts {
+		opt(&obj)
+	}
+
+	err := fs.apiClient.PutObject(&obj)
+
+	replace := errors.Is(err, types.ErrObjectExists)
+
+	if replace {
+		obj.Name = uploadName(name, obj.ID)
+		err = fs.apiClient.PutObject(&obj)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	obj.Segments = types.NewSegments(obj.ID, size)
+
+	if err := fs.network.WriteObject(&obj, r, pc); err != nil {
+		// don't leave a partial object behind
+		fs.DeleteFile(obj.Name)
+		return nil, err
+	}
+
+	if !replace {
+		return &obj, nil
+	}
+
+	// pieces of the old file left on the storage nodes don't fail the write
+	replaced, err := fs.network.ReplaceObject(obj.Name, name)
+
+	if replaced == nil {
+		fs.DeleteFile(obj.Name)
+		return nil, err
+	}
+
+	return replaced, nil
+}
+
+// uploadName is the name a file that replaces an existing one is uploaded
+// under until its data is written.
+func uploadName(name string, id types.ObjectID) string {
+	return name + ".upload-" + id.String()
+}
+
+// StatObject returns the object of the file, without its contents.
+func (fs *FS) StatObject(name string) (*types.Object, error) {
+	return fs.apiClient.GetObject(name)
+}
+
+// UpdateFile changes the content type and metadata of the file without
+// rewriting its data, see types.UpdateObjectRequest.
+func (fs *FS) UpdateFile(req *types.UpdateObjectRequest) (*types.Object, error) {
+	return fs.apiClient.UpdateObject(req)
+}
+
+// List returns the files whose name starts with prefix.
+func (fs *FS) List(prefix string) ([]*types.Object, error) {
+	return fs.apiClient.ListObjects(prefix)
+}
+
+// CopyFile copies the file without transferring any data, the copy shares
+// its pieces with the original.
+func (fs *FS) CopyFile(src, dst string) (*types.Object, error) {
+	return fs.apiClient.CopyObject(src, dst)
+}
+
+func (fs *FS) MoveFile(src, dst string) (*types.Object, error) {
+	return fs.apiClient.MoveObject(src, dst)
+}
+
+// ComposeFile creates dst from the contents of srcs, in order, without
+// transferring any data.
+func (fs *FS) ComposeFile(dst string, srcs []string) (*types.Object, error) {
+	return fs.apiClient.ComposeObject(dst, srcs)
+}
+
+// DeleteFile deletes the file. Pieces still referenced by copies of the file
+// are kept.
+func (fs *FS) DeleteFile(name string) error {
+	if err := fs.loadNodes(); err != nil {
+		return err
+	}
+
+	return fs.network.DeleteObject(name)
+}
+
+func (fs *FS) CreateBucket(name string) (*types.Bucket, error) {
+	return fs.apiClient.CreateBucket(name)
+}
+
+func (fs *FS) GetBucket(name string) (*types.Bucket, error) {
+	return fs.apiClient.GetBucket(name)
+}
+
+func (fs *FS) ListBuckets() ([]*types.Bucket, error) {
+	return fs.apiClient.ListBuckets()
+}
+
+// GetShareKey returns the key share links name by ID, to verify them.
+func (fs *FS) GetShareKey(id string) (*types.ShareKey, error) {
+	return fs.apiClient.GetShareKey(id)
+}
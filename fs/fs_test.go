@@ -0,0 +1,275 @@
+package fs_test
+
+import (
+	"bytes"
+	"dfs/client/api"
+	"dfs/compression"
+	"dfs/fs"
+	"dfs/metadata"
+	"dfs/network"
+	"dfs/types"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"testing/iotest"
+)
+
+// newTestFS returns a FS backed by an in-process metadata server with 80
+// registered nodes whose pieces are kept in memory.
+func newTestFS(t *testing.T) *fs.FS {
+	t.Helper()
+
+	ts := httptest.NewServer(metadata.NewServer().Handler())
+	t.Cleanup(ts.Close)
+
+	client := api.NewClient(ts.URL, "test")
+
+	for i := 0; i < 80; i++ {
+		node := &types.Node{
+			ID:       types.NewNodeID(),
+			HttpAddr: fmt.Sprintf("http://node-%d", i),
+		}
+
+		if err := client.RegisterNode(node); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	return fs.NewFS(ts.URL, "test", network.WithTransport(network.NewMemoryTransport()), network.WithUnsignedReceipts())
+}
+
+func TestFS(t *testing.T) {
+	t.Run("can write, list, read and delete files", func(t *testing.T) {
+		fsys := newTestFS(t)
+		data := []byte("hello world")
+
+		var reported uint64
+
+		_, err := fsys.WriteFile("docs/hello.txt", bytes.NewReader(data), uint64(len(data)), func(read, total uint64) error {
+			reported = read
+			return nil
+		})
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if reported != uint64(len(data)) {
+			t.Fatalf("expected progress to report %d bytes, got %d", len(data), reported)
+		}
+
+		objs, err := fsys.List("docs/")
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(objs) != 1 || objs[0].Name != "docs/hello.txt" {
+			t.Fatalf("expected docs/hello.txt to be listed, got %v", objs)
+		}
+
+		var buf bytes.Buffer
+
+		if _, err := fsys.ReadFileTo("docs/hello.txt", &buf, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !bytes.Equal(buf.Bytes(), data) {
+			t.Fatalf("expected %s, got %s", data, buf.Bytes())
+		}
+
+		if err := fsys.DeleteFile("docs/hello.txt"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := fsys.StatObject("docs/hello.txt"); !errors.Is(err, types.ErrObjectNotFound) {
+			t.Fatalf("expected %v, got %v", types.ErrObjectNotFound, err)
+		}
+	})
+
+	t.Run("overwrites existing files", func(t *testing.T) {
+		fsys := newTestFS(t)
+
+		for _, content := range []string{"first", "second version"} {
+			if _, err := fsys.WriteFile("file.txt", bytes.NewBufferString(content), uint64(len(content)), nil); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		var buf bytes.Buffer
+
+		if _, err := fsys.ReadFileTo("file.txt", &buf, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if buf.String() != "second version" {
+			t.Fatalf("expected second version, got %s", buf.String())
+		}
+	})
+
+	t.Run("keeps the file when an overwrite fails", func(t *testing.T) {
+		fsys := newTestFS(t)
+		data := []byte("first")
+
+		if _, err := fsys.WriteFile("file.txt", bytes.NewReader(data), uint64(len(data)), nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := fsys.WriteFile("file.txt", iotest.ErrReader(io.ErrUnexpectedEOF), 14, nil); err == nil {
+			t.Fatalf("expected the overwrite to fail")
+		}
+
+		var buf bytes.Buffer
+
+		if _, err := fsys.ReadFileTo("file.txt", &buf, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !bytes.Equal(buf.Bytes(), data) {
+			t.Fatalf("expected %s, got %s", data, buf.Bytes())
+		}
+
+		objs, err := fsys.List("")
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(objs) != 1 {
+			t.Fatalf("expected only file.txt to be listed, got %v", objs)
+		}
+	})
+
+	t.Run("compresses files written with a compression", func(t *testing.T) {
+		fsys := newTestFS(t)
+		data := bytes.Repeat([]byte("compressible "), 10000)
+
+		if _, err := fsys.WriteFile("logs/app.log", bytes.NewReader(data), uint64(len(data)), nil, fs.WithCompression(compression.Zstd)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		obj, err := fsys.StatObject("logs/app.log")
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if seg := obj.Segments[0]; seg.Compression != compression.Zstd || seg.EncodedSize >= seg.Size {
+			t.Fatalf("expected the segment to be stored compressed, got %q with %d bytes", seg.Compression, seg.EncodedSize)
+		}
+
+		var buf bytes.Buffer
+
+		if _, err := fsys.ReadFileTo("logs/app.log", &buf, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !bytes.Equal(buf.Bytes(), data) {
+			t.Fatalf("expected the file to read back unchanged")
+		}
+	})
+
+	t.Run("copies survive deleting the original", func(t *testing.T) {
+		fsys := newTestFS(t)
+		data := []byte("shared data")
+
+		if _, err := fsys.WriteFile("original", bytes.NewReader(data), uint64(len(data)), nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := fsys.CopyFile("original", "copy"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := fsys.DeleteFile("original"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var buf bytes.Buffer
+
+		if _, err := fsys.ReadFileTo("copy", &buf, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !bytes.Equal(buf.Bytes(), data) {
+			t.Fatalf("expected %s, got %s", data, buf.Bytes())
+		}
+	})
+}
+
+func TestIOFS(t *testing.T) {
+	fsys := newTestFS(t)
+
+	files := map[string]string{
+		"index.html":       "<h1>hello</h1>",
+		"docs/a.txt":       "first file",
+		"docs/b.txt":       "second file",
+		"docs/deep/c.txt":  "nested file",
+		"empty/":           "",
+		"assets/empty.bin": "",
+	}
+
+	for name, content := range files {
+		if _, err := fsys.WriteFile(name, bytes.NewBufferString(content), uint64(len(content)), nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	t.Run("passes fstest", func(t *testing.T) {
+		if err := fstest.TestFS(fsys, "index.html", "docs/a.txt", "docs/b.txt", "docs/deep/c.txt", "assets/empty.bin", "empty"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("walks directories", func(t *testing.T) {
+		var names []string
+
+		err := iofs.WalkDir(fsys, ".", func(name string, d iofs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !d.IsDir() {
+				names = append(names, name)
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []string{"assets/empty.bin", "docs/a.txt", "docs/b.txt", "docs/deep/c.txt", "index.html"}
+
+		if fmt.Sprint(names) != fmt.Sprint(expected) {
+			t.Fatalf("expected %v, got %v", expected, names)
+		}
+	})
+
+	t.Run("reads files", func(t *testing.T) {
+		data, err := iofs.ReadFile(fsys, "docs/deep/c.txt")
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if string(data) != "nested file" {
+			t.Fatalf("expected nested file, got %s", data)
+		}
+	})
+
+	t.Run("reports missing files", func(t *testing.T) {
+		if _, err := fsys.Open("docs/missing.txt"); !errors.Is(err, iofs.ErrNotExist) {
+			t.Fatalf("expected %v, got %v", iofs.ErrNotExist, err)
+		}
+
+		if _, err := fsys.Open("/docs/a.txt"); !errors.Is(err, iofs.ErrInvalid) {
+			t.Fatalf("expected %v, got %v", iofs.ErrInvalid, err)
+		}
+	})
+}
@@ -0,0 +1,278 @@
+package fs
+
+import (
+	"bytes"
+	"dfs/types"
+	"errors"
+	"io"
+	iofs "io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FS implements the io/fs interfaces. Files are objects and directories are
+// emulated over object name prefixes: a directory exists if any object is
+// named below it, or an object named like it with a trailing slash marks it.
+var (
+	_ iofs.FS         = (*FS)(nil)
+	_ iofs.ReadDirFS  = (*FS)(nil)
+	_ iofs.StatFS     = (*FS)(nil)
+	_ iofs.ReadFileFS = (*FS)(nil)
+)
+
+// fileInfo is the iofs.FileInfo of an object, or of a directory if obj is
+// nil.
+type fileInfo struct {
+	name string
+	obj  *types.Object
+}
+
+func (fi *fileInfo) Name() string { return fi.name }
+func (fi *fileInfo) IsDir() bool  { return fi.obj == nil }
+func (fi *fileInfo) Sys() any     { return fi.obj }
+
+func (fi *fileInfo) Size() int64 {
+	if fi.obj == nil {
+		return 0
+	}
+
+	return int64(fi.obj.Size)
+}
+
+func (fi *fileInfo) Mode() iofs.FileMode {
+	if fi.obj == nil {
+		return iofs.ModeDir | 0o555
+	}
+
+	return 0o444
+}
+
+// ModTime is the zero time for directories, which have no object.
+func (fi *fileInfo) ModTime() time.Time {
+	if fi.obj == nil {
+		return time.Time{}
+	}
+
+	return fi.obj.ModifiedAt
+}
+
+func (fi *fileInfo) Type() iofs.FileMode {
+	return fi.Mode().Type()
+}
+
+func (fi *fileInfo) Info() (iofs.FileInfo, error) {
+	return fi, nil
+}
+
+func (fi *fileInfo) String() string {
+	return iofs.FormatFileInfo(fi)
+}
+
+func pathError(op, name string, err error) error {
+	if errors.Is(err, types.ErrObjectNotFound) {
+		err = iofs.ErrNotExist
+	}
+
+	return &iofs.PathError{Op: op, Path: name, Err: err}
+}
+
+// stat looks the name up as a file, then as a directory.
+func (fs *FS) stat(op, name string) (*fileInfo, error) {
+	if !iofs.ValidPath(name) {
+		return nil, pathError(op, name, iofs.ErrInvalid)
+	}
+
+	if name == "." {
+		return &fileInfo{name: name}, nil
+	}
+
+	obj, err := fs.apiClient.GetObject(name)
+
+	if err == nil {
+		return &fileInfo{name: path.Base(name), obj: obj}, nil
+	}
+
+	if !errors.Is(err, types.ErrObjectNotFound) {
+		return nil, pathError(op, name, err)
+	}
+
+	objs, err := fs.List(types.DirPrefix(name))
+
+	if err != nil {
+		return nil, pathError(op, name, err)
+	}
+
+	if len(objs) == 0 {
+		return nil, pathError(op, name, iofs.ErrNotExist)
+	}
+
+	return &fileInfo{name: path.Base(name)}, nil
+}
+
+func (fs *FS) Stat(name string) (iofs.FileInfo, error) {
+	fi, err := fs.stat("stat", name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return fi, nil
+}
+
+// Open opens the file for reading, fetching only the segments that are read,
+// or the directory for listing.
+func (fs *FS) Open(name string) (iofs.File, error) {
+	fi, err := fs.stat("open", name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if fi.IsDir() {
+		return &dir{fs: fs, name: name, info: fi}, nil
+	}
+
+	return &file{ObjectReader: fs.NewObjectReader(fi.obj), info: fi}, nil
+}
+
+// ReadDir returns the entries of the directory sorted by name.
+func (fs *FS) ReadDir(name string) ([]iofs.DirEntry, error) {
+	fi, err := fs.stat("readdir", name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !fi.IsDir() {
+		return nil, pathError("readdir", name, errors.New("not a directory"))
+	}
+
+	entries, err := fs.readDir(name)
+
+	if err != nil {
+		return nil, pathError("readdir", name, err)
+	}
+
+	return entries, nil
+}
+
+func (fs *FS) readDir(name string) ([]iofs.DirEntry, error) {
+	prefix := types.DirPrefix(name)
+
+	objs, err := fs.List(prefix)
+
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var entries []iofs.DirEntry
+
+	for _, obj := range objs {
+		rest := strings.TrimPrefix(obj.Name, prefix)
+		child, _, isDir := strings.Cut(rest, "/")
+
+		// the marker of the directory itself and empty path elements
+		if child == "" || seen[child] {
+			continue
+		}
+
+		seen[child] = true
+
+		if isDir {
+			entries = append(entries, &fileInfo{name: child})
+		} else {
+			entries = append(entries, &fileInfo{name: child, obj: obj})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries, nil
+}
+
+// ReadFile returns the contents of the file.
+func (fs *FS) ReadFile(name string) ([]byte, error) {
+	fi, err := fs.stat("readfile", name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if fi.IsDir() {
+		return nil, pathError("readfile", name, errors.New("is a directory"))
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, fi.obj.Size))
+
+	if err := fs.ReadObjectRange(fi.obj, buf, 0, fi.obj.Size); err != nil {
+		return nil, pathError("readfile", name, err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// file is an open file, reading it streams the object from the current
+// offset.
+type file struct {
+	*ObjectReader
+	info *fileInfo
+}
+
+func (f *file) Stat() (iofs.FileInfo, error) {
+	return f.info, nil
+}
+
+// dir is an open directory, listed on the first call to ReadDir.
+type dir struct {
+	fs      *FS
+	name    string
+	info    *fileInfo
+	entries []iofs.DirEntry
+	listed  bool
+}
+
+func (d *dir) Stat() (iofs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *dir) Read(p []byte) (int, error) {
+	return 0, pathError("read", d.name, errors.New("is a directory"))
+}
+
+func (d *dir) Close() error {
+	return nil
+}
+
+func (d *dir) ReadDir(n int) ([]iofs.DirEntry, error) {
+	if !d.listed {
+		entries, err := d.fs.readDir(d.name)
+
+		if err != nil {
+			return nil, pathError("readdir", d.name, err)
+		}
+
+		d.entries = entries
+		d.listed = true
+	}
+
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+
+	return entries, nil
+}
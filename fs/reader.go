@@ -0,0 +1,84 @@
+package fs
+
+import (
+	"dfs/types"
+	"errors"
+	"io"
+)
+
+// ObjectReader is an io.ReadSeekCloser over size bytes of an object starting
+// at start. Reading streams the object from the current offset to the end, so
+// serving a range only fetches the segments it overlaps.
+type ObjectReader struct {
+	fs     *FS
+	obj    *types.Object
+	start  uint64
+	size   uint64
+	offset int64
+	pr     *io.PipeReader
+}
+
+// NewObjectReader returns a reader of the object, which was looked up with
+// StatObject.
+func (fs *FS) NewObjectReader(obj *types.Object) *ObjectReader {
+	return fs.NewSectionReader(obj, 0, obj.Size)
+}
+
+// NewSectionReader returns a reader of size bytes of the object from start.
+func (fs *FS) NewSectionReader(obj *types.Object, start, size uint64) *ObjectReader {
+	return &ObjectReader{fs: fs, obj: obj, start: start, size: size}
+}
+
+func (o *ObjectReader) Read(p []byte) (int, error) {
+	size := int64(o.size)
+
+	if o.offset >= size {
+		return 0, io.EOF
+	}
+
+	if o.pr == nil {
+		pr, pw := io.Pipe()
+		offset := o.offset
+
+		go func() {
+			pw.CloseWithError(o.fs.ReadObjectRange(o.obj, pw, o.start+uint64(offset), uint64(size-offset)))
+		}()
+
+		o.pr = pr
+	}
+
+	n, err := o.pr.Read(p)
+	o.offset += int64(n)
+
+	return n, err
+}
+
+func (o *ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += o.offset
+	case io.SeekEnd:
+		offset += int64(o.size)
+	}
+
+	if offset < 0 {
+		return 0, errors.New("fs: negative position")
+	}
+
+	if offset != o.offset {
+		o.Close()
+		o.offset = offset
+	}
+
+	return offset, nil
+}
+
+// Close stops a running read.
+func (o *ObjectReader) Close() error {
+	if o.pr != nil {
+		o.pr.Close()
+		o.pr = nil
+	}
+
+	return nil
+}
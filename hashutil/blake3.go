@@ -1,6 +1,8 @@
 package hashutil
 
 import (
+	"hash"
+
 	"github.com/zeebo/blake3"
 )
 
@@ -16,3 +18,22 @@ func Blake3(data []byte) []byte {
 
 	return hash
 }
+
+// KeyedBlake3 returns the Blake3 hash of data keyed with a 32 byte key.
+func KeyedBlake3(key, data []byte) ([]byte, error) {
+	hasher, err := blake3.NewKeyed(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	hasher.Write(data)
+
+	return hasher.Sum(nil), nil
+}
+
+// NewBlake3 returns a hash.Hash computing Blake3, for hashing data as it
+// streams by.
+func NewBlake3() hash.Hash {
+	return blake3.New()
+}
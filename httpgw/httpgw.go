@@ -0,0 +1,175 @@
+// Package httpgw is a read only HTTP gateway to a FS. The object "bucket/path"
+// is served at /bucket/path, which is what a dfs-src="bucket:path" reference
+// resolves to.
+//
+// Requests carrying a share link signature are only served what the link
+// grants, a gateway created with WithSignedOnly serves nothing else.
+package httpgw
+
+import (
+	"dfs/fs"
+	"dfs/share"
+	"dfs/types"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HashHeader carries the hex encoded Blake3 hash of the whole object, so
+// clients can verify what they received. Objects without a content hash,
+// such as composed ones, are served without it.
+const HashHeader = "X-Dfs-Blake3"
+
+type Gateway struct {
+	fs         *fs.FS
+	maxAge     time.Duration
+	signedOnly bool
+}
+
+// WithMaxAge sets how long clients may cache objects before revalidating
+// them with their ETag.
+func WithMaxAge(d time.Duration) func(*Gateway) {
+	return func(g *Gateway) {
+		g.maxAge = d
+	}
+}
+
+// WithSignedOnly makes the gateway serve share links only.
+func WithSignedOnly() func(*Gateway) {
+	return func(g *Gateway) {
+		g.signedOnly = true
+	}
+}
+
+func NewGateway(fsys *fs.FS, opts ...func(*Gateway)) *Gateway {
+	g := &Gateway{
+		fs:     fsys,
+		maxAge: time.Minute,
+	}
+
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	return g
+}
+
+func (g *Gateway) Handler() http.Handler {
+	r := gin.New()
+	r.Use(gin.Recovery())
+
+	r.GET("/:bucket/*path", g.handleObject)
+	r.HEAD("/:bucket/*path", g.handleObject)
+
+	return r
+}
+
+// verifyShare checks the share link in the query grants access to name.
+func (g *Gateway) verifyShare(name string, q url.Values) (*share.Grant, error) {
+	grant, sig, err := share.Parse(name, q)
+
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := g.fs.GetShareKey(grant.KeyID)
+
+	if errors.Is(err, types.ErrShareKeyNotFound) {
+		return nil, share.ErrInvalidSignature
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if key.Revoked {
+		return nil, share.ErrKeyRevoked
+	}
+
+	if err := share.Verify(grant, sig, key.PublicKey, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return grant, nil
+}
+
+func (g *Gateway) handleObject(c *gin.Context) {
+	name := c.Param("bucket") + "/" + strings.TrimPrefix(c.Param("path"), "/")
+	q := c.Request.URL.Query()
+
+	var grant *share.Grant
+
+	if share.IsSigned(q) {
+		var err error
+		grant, err = g.verifyShare(name, q)
+
+		if err != nil {
+			c.String(http.StatusForbidden, err.Error())
+			return
+		}
+	} else if g.signedOnly {
+		c.String(http.StatusForbidden, "a share link is required")
+		return
+	}
+
+	obj, err := g.fs.StatObject(name)
+
+	if errors.Is(err, types.ErrObjectNotFound) {
+		c.String(http.StatusNotFound, "not found")
+		return
+	}
+
+	if err != nil {
+		c.String(http.StatusBadGateway, err.Error())
+		return
+	}
+
+	h := c.Writer.Header()
+	h.Set("Content-Type", obj.MediaType())
+	h.Set("Access-Control-Allow-Origin", "*")
+	h.Set("Access-Control-Expose-Headers", "ETag, Content-Range, "+HashHeader)
+
+	var w http.ResponseWriter = c.Writer
+	r := g.fs.NewObjectReader(obj)
+
+	if grant != nil && grant.Length > 0 {
+		// a link to a byte range serves the range as if it were the object
+		if grant.Offset >= obj.Size {
+			c.String(http.StatusRequestedRangeNotSatisfiable, "shared range is outside the object")
+			return
+		}
+
+		length := min(grant.Length, obj.Size-grant.Offset)
+		r = g.fs.NewSectionReader(obj, grant.Offset, length)
+		h.Set("ETag", fmt.Sprintf(`"%s-%d-%d"`, hex.EncodeToString(obj.ID[:]), grant.Offset, length))
+	} else {
+		h.Set("ETag", obj.ETag())
+
+		if obj.ContentHash != nil {
+			h.Set(HashHeader, hex.EncodeToString(obj.ContentHash))
+		}
+	}
+
+	defer r.Close()
+
+	if grant != nil {
+		// links are personal and must not outlive their expiry in caches
+		maxAge := min(g.maxAge, time.Until(grant.Expires))
+		h.Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(maxAge.Seconds())))
+
+		if grant.RateLimit > 0 {
+			w = newRateWriter(c.Writer, grant.RateLimit)
+		}
+	} else {
+		h.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(g.maxAge.Seconds())))
+	}
+
+	// ServeContent answers Range and If-None-Match requests
+	http.ServeContent(w, c.Request, name, obj.ModifiedAt, r)
+}
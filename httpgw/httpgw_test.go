@@ -0,0 +1,202 @@
+package httpgw_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"dfs/client/api"
+	"dfs/hashutil"
+	"dfs/httpgw"
+	"dfs/localnet"
+	"dfs/share"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func get(t *testing.T, url string, header http.Header) (*http.Response, []byte) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	req.Header = header
+
+	res, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return res, data
+}
+
+func TestGateway(t *testing.T) {
+	net, err := localnet.Start(t.TempDir())
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	defer net.Close()
+
+	fsys := net.FS()
+	data := []byte("alert('hello world!');")
+
+	if _, err := fsys.WriteFile("blogger/app1/script.js", bytes.NewReader(data), uint64(len(data)), nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ts := httptest.NewServer(httpgw.NewGateway(fsys).Handler())
+	defer ts.Close()
+
+	url := ts.URL + "/blogger/app1/script.js"
+	sum := hex.EncodeToString(hashutil.Blake3(data))
+
+	t.Run("serves objects with their hash", func(t *testing.T) {
+		res, body := get(t, url, nil)
+
+		if res.StatusCode != http.StatusOK || !bytes.Equal(body, data) {
+			t.Fatalf("expected the object, got %d: %q", res.StatusCode, body)
+		}
+
+		if got := res.Header.Get(httpgw.HashHeader); got != sum {
+			t.Fatalf("expected hash %s, got %s", sum, got)
+		}
+
+		if got := res.Header.Get("Content-Type"); got != "text/javascript; charset=utf-8" {
+			t.Fatalf("expected a javascript content type, got %s", got)
+		}
+
+		if got := res.Header.Get("ETag"); got != `"`+sum+`"` {
+			t.Fatalf("expected ETag %q, got %q", `"`+sum+`"`, got)
+		}
+	})
+
+	t.Run("serves ranges", func(t *testing.T) {
+		res, body := get(t, url, http.Header{"Range": {"bytes=7-11"}})
+
+		if res.StatusCode != http.StatusPartialContent || string(body) != "hello" {
+			t.Fatalf("expected hello, got %d: %q", res.StatusCode, body)
+		}
+	})
+
+	t.Run("revalidates with the ETag", func(t *testing.T) {
+		res, _ := get(t, url, http.Header{"If-None-Match": {`"` + sum + `"`}})
+
+		if res.StatusCode != http.StatusNotModified {
+			t.Fatalf("expected status 304, got %d", res.StatusCode)
+		}
+	})
+
+	t.Run("returns 404 for missing objects", func(t *testing.T) {
+		res, _ := get(t, ts.URL+"/blogger/missing.js", nil)
+
+		if res.StatusCode != http.StatusNotFound {
+			t.Fatalf("expected status 404, got %d", res.StatusCode)
+		}
+	})
+}
+
+func TestShareLinks(t *testing.T) {
+	net, err := localnet.Start(t.TempDir())
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	defer net.Close()
+
+	fsys := net.FS()
+	data := []byte("the quarterly report")
+
+	if _, err := fsys.WriteFile("docs/report.txt", bytes.NewReader(data), uint64(len(data)), nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ts := httptest.NewServer(httpgw.NewGateway(fsys, httpgw.WithSignedOnly()).Handler())
+	defer ts.Close()
+
+	client := api.NewClient(net.MetadataURL, net.APIKey)
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	key, err := client.RegisterShareKey(pub)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	grant := &share.Grant{
+		Object:  "docs/report.txt",
+		Expires: time.Now().Add(time.Hour),
+		KeyID:   key.ID,
+	}
+
+	t.Run("requires a link", func(t *testing.T) {
+		res, _ := get(t, ts.URL+"/docs/report.txt", nil)
+
+		if res.StatusCode != http.StatusForbidden {
+			t.Fatalf("expected status 403, got %d", res.StatusCode)
+		}
+	})
+
+	t.Run("serves signed links", func(t *testing.T) {
+		res, body := get(t, client.ShareURL(ts.URL, grant, priv), nil)
+
+		if res.StatusCode != http.StatusOK || !bytes.Equal(body, data) {
+			t.Fatalf("expected the object, got %d: %q", res.StatusCode, body)
+		}
+	})
+
+	t.Run("serves only the shared range", func(t *testing.T) {
+		ranged := *grant
+		ranged.Offset = 4
+		ranged.Length = 9
+
+		res, body := get(t, client.ShareURL(ts.URL, &ranged, priv), nil)
+
+		if res.StatusCode != http.StatusOK || string(body) != "quarterly" {
+			t.Fatalf("expected quarterly, got %d: %q", res.StatusCode, body)
+		}
+	})
+
+	t.Run("rejects links to other objects", func(t *testing.T) {
+		link := strings.Replace(client.ShareURL(ts.URL, grant, priv), "report.txt", "secret.txt", 1)
+		res, _ := get(t, link, nil)
+
+		if res.StatusCode != http.StatusForbidden {
+			t.Fatalf("expected status 403, got %d", res.StatusCode)
+		}
+	})
+
+	t.Run("rejects links of revoked keys", func(t *testing.T) {
+		if err := client.RevokeShareKey(key.ID); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		res, _ := get(t, client.ShareURL(ts.URL, grant, priv), nil)
+
+		if res.StatusCode != http.StatusForbidden {
+			t.Fatalf("expected status 403, got %d", res.StatusCode)
+		}
+	})
+}
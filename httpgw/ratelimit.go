@@ -0,0 +1,44 @@
+package httpgw
+
+import (
+	"net/http"
+	"time"
+)
+
+// rateWriter caps the throughput of a response at rate bytes per second.
+type rateWriter struct {
+	http.ResponseWriter
+	rate    int64
+	start   time.Time
+	written int64
+}
+
+func newRateWriter(w http.ResponseWriter, rate int64) *rateWriter {
+	return &rateWriter{ResponseWriter: w, rate: rate, start: time.Now()}
+}
+
+func (w *rateWriter) Write(p []byte) (int, error) {
+	// write in pieces of a tenth of a second each to keep the rate smooth
+	chunk := int(max(w.rate/10, 1))
+	var n int
+
+	for len(p) > 0 {
+		m, err := w.ResponseWriter.Write(p[:min(len(p), chunk)])
+		n += m
+		w.written += int64(m)
+
+		if err != nil {
+			return n, err
+		}
+
+		p = p[m:]
+
+		due := time.Duration(float64(w.written) / float64(w.rate) * float64(time.Second))
+
+		if d := due - time.Since(w.start); d > 0 {
+			time.Sleep(d)
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,48 @@
+// Package identity ties storage nodes to Ed25519 keys. A node ID is derived
+// from the public key of the node, so whoever knows the ID of a node can
+// check that a signature was made by it. Nodes sign a receipt for every piece
+// they store, clients verify it before they record the piece.
+package identity
+
+import (
+	"crypto/ed25519"
+	"dfs/types"
+	"encoding/hex"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// namespace is the UUID namespace node IDs are derived in.
+var namespace = uuid.MustParse("5c3e6f0e-8f43-4b8a-9d6e-2f1b7c4a9e10")
+
+// NodeID returns the ID of the node with the public key.
+func NodeID(key ed25519.PublicKey) types.NodeID {
+	return types.NodeID(uuid.NewSHA1(namespace, key))
+}
+
+// Verify reports whether key is the identity of the node with the ID.
+func Verify(id types.NodeID, key ed25519.PublicKey) bool {
+	return len(key) == ed25519.PublicKeySize && NodeID(key) == id
+}
+
+// receiptMessage is the canonical form of a piece receipt that is signed.
+func receiptMessage(r *types.PieceReceipt) []byte {
+	return []byte("receipt.v1." + r.PieceID.String() + "." + hex.EncodeToString(r.Hash) + "." + strconv.FormatInt(r.Size, 10))
+}
+
+// SignReceipt signs the receipt with the key of the node that stored the
+// piece.
+func SignReceipt(r *types.PieceReceipt, key ed25519.PrivateKey) {
+	r.Signature = ed25519.Sign(key, receiptMessage(r))
+}
+
+// VerifyReceipt checks the signature of the receipt with the key of the node
+// that stored the piece.
+func VerifyReceipt(r *types.PieceReceipt, key ed25519.PublicKey) error {
+	if len(key) != ed25519.PublicKeySize || !ed25519.Verify(key, receiptMessage(r), r.Signature) {
+		return types.ErrInvalidReceipt
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package identity_test
+
+import (
+	"crypto/ed25519"
+	"dfs/hashutil"
+	"dfs/identity"
+	"dfs/types"
+	"errors"
+	"testing"
+)
+
+func TestIdentity(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	other, _, err := ed25519.GenerateKey(nil)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	t.Run("derives node ids from public keys", func(t *testing.T) {
+		id := identity.NodeID(pub)
+
+		if id != identity.NodeID(pub) {
+			t.Fatalf("expected the same key to derive the same id")
+		}
+
+		if !identity.Verify(id, pub) {
+			t.Fatalf("expected %s to be the identity of its key", id)
+		}
+
+		if identity.Verify(id, other) || identity.Verify(types.NewNodeID(), pub) {
+			t.Fatalf("expected other keys and ids not to verify")
+		}
+	})
+
+	t.Run("verifies signed piece receipts", func(t *testing.T) {
+		data := []byte("hello world")
+		receipt := &types.PieceReceipt{
+			PieceID: types.NewPieceID(),
+			Hash:    hashutil.Blake3(data),
+			Size:    int64(len(data)),
+		}
+
+		identity.SignReceipt(receipt, priv)
+
+		if err := identity.VerifyReceipt(receipt, pub); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := identity.VerifyReceipt(receipt, other); !errors.Is(err, types.ErrInvalidReceipt) {
+			t.Fatalf("expected %v, got %v", types.ErrInvalidReceipt, err)
+		}
+
+		receipt.Size++
+
+		if err := identity.VerifyReceipt(receipt, pub); !errors.Is(err, types.ErrInvalidReceipt) {
+			t.Fatalf("expected %v, got %v", types.ErrInvalidReceipt, err)
+		}
+	})
+}
@@ -0,0 +1,111 @@
+// Package localnet runs a complete network in process: a metadata server and
+// a single storage node that stands in for all the nodes a segment needs. It
+// is meant for tests and local development.
+package localnet
+
+import (
+	"dfs/client/api"
+	"dfs/fs"
+	"dfs/metadata"
+	"dfs/network"
+	"dfs/node"
+	"dfs/node/piecestore"
+	"dfs/types"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// VirtualNodes is how many nodes are registered for the storage node, one
+// for every piece of a segment.
+const VirtualNodes = 80
+
+type Network struct {
+	MetadataURL string
+	NodeURL     string
+	APIKey      string
+
+	servers []*http.Server
+	store   *piecestore.Store
+}
+
+func serve(handler http.Handler) (*http.Server, string, error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	srv := &http.Server{Handler: handler}
+
+	go srv.Serve(lis)
+
+	return srv, "http://" + lis.Addr().String(), nil
+}
+
+// Start runs the network, keeping pieces below dir.
+func Start(dir string) (*Network, error) {
+	store, err := piecestore.New(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	n := &Network{APIKey: "localnet", store: store}
+
+	metadataSrv, metadataURL, err := serve(metadata.NewServer(metadata.WithAPIKeys(n.APIKey)).Handler())
+
+	if err != nil {
+		n.Close()
+		return nil, err
+	}
+
+	n.servers = append(n.servers, metadataSrv)
+	n.MetadataURL = metadataURL
+
+	nodeSrv, nodeURL, err := serve(node.NewServer(node.WithStore(store)).Handler())
+
+	if err != nil {
+		n.Close()
+		return nil, err
+	}
+
+	n.servers = append(n.servers, nodeSrv)
+	n.NodeURL = nodeURL
+
+	client := api.NewClient(n.MetadataURL, n.APIKey)
+
+	for i := 0; i < VirtualNodes; i++ {
+		err := client.RegisterNode(&types.Node{
+			ID:       types.NewNodeID(),
+			HttpAddr: nodeURL,
+		})
+
+		if err != nil {
+			n.Close()
+			return nil, err
+		}
+	}
+
+	return n, nil
+}
+
+// FS returns a FS for the network. The virtual nodes have no identity to
+// sign piece receipts with, so the FS accepts unsigned ones.
+func (n *Network) FS() *fs.FS {
+	return fs.NewFS(n.MetadataURL, n.APIKey, network.WithUnsignedReceipts())
+}
+
+// Close stops the servers and closes the piece store, so that the network
+// can be started again on the same directory.
+func (n *Network) Close() error {
+	var errs []error
+
+	for _, srv := range n.servers {
+		errs = append(errs, srv.Close())
+	}
+
+	errs = append(errs, n.store.Close())
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,31 @@
+package localnet_test
+
+import (
+	"bytes"
+	"dfs/localnet"
+	"testing"
+)
+
+func TestLocalnet(t *testing.T) {
+	t.Run("restarts on the same directory", func(t *testing.T) {
+		dir := t.TempDir()
+
+		for i := 0; i < 2; i++ {
+			net, err := localnet.Start(dir)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			data := []byte("hello world")
+
+			if _, err := net.FS().WriteFile("hello.txt", bytes.NewReader(data), uint64(len(data)), nil); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if err := net.Close(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+	})
+}
@@ -0,0 +1,1036 @@
+package metadata
+
+import (
+	"crypto/ed25519"
+	"dfs/auth"
+	"dfs/identity"
+	"dfs/orders"
+	"dfs/types"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Server is the metadata server the api.Client talks to.
+type Server struct {
+	store    *Store
+	keys     map[string]bool
+	rootKeys map[string][]byte
+	orderKey ed25519.PrivateKey
+}
+
+// orderTTL is how long signed orders are valid.
+const orderTTL = time.Hour
+
+func WithStore(store *Store) func(*Server) {
+	return func(s *Server) {
+		s.store = store
+	}
+}
+
+// WithAPIKeys restricts the server to requests carrying one of the keys. A
+// server without keys accepts every request.
+func WithAPIKeys(keys ...string) func(*Server) {
+	return func(s *Server) {
+		for _, key := range keys {
+			s.keys[key] = true
+		}
+	}
+}
+
+// WithRootKey accepts auth keys derived from the root key id with secret.
+// Their caveats are enforced on every request.
+func WithRootKey(id string, secret []byte) func(*Server) {
+	return func(s *Server) {
+		s.rootKeys[id] = secret
+	}
+}
+
+// WithOrderKey signs orders for piece traffic with key. Clients get them
+// along with the pieces they may access and storage nodes that know the
+// public key reject requests without one.
+func WithOrderKey(key ed25519.PrivateKey) func(*Server) {
+	return func(s *Server) {
+		s.orderKey = key
+	}
+}
+
+func NewServer(opts ...func(*Server)) *Server {
+	s := &Server{
+		keys:     make(map[string]bool),
+		rootKeys: make(map[string][]byte),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.store == nil {
+		s.store = NewStore()
+	}
+
+	return s
+}
+
+func (s *Server) Handler() http.Handler {
+	r := gin.New()
+	r.Use(gin.Recovery(), s.authenticate)
+
+	r.POST("/object/get", s.handleGetObject)
+	r.POST("/object/put", s.handlePutObject)
+	r.POST("/object/delete", s.handleDeleteObject)
+	r.POST("/object/copy", s.handleCopyObject)
+	r.POST("/object/move", s.handleMoveObject)
+	r.POST("/object/replace", s.handleReplaceObject)
+	r.POST("/object/compose", s.handleComposeObject)
+	r.POST("/object/update", s.handleUpdateObject)
+	r.POST("/objects/:id/segments", s.handleCreateSegment)
+	r.POST("/objects/:id/orders", s.handleCreateOrders)
+	r.GET("/orders/key", s.handleOrderKey)
+	r.POST("/segments/lookup", s.handleLookupSegment)
+	r.POST("/objects/list", s.handleListObjects)
+
+	r.GET("/buckets", s.handleListBuckets)
+	r.POST("/buckets", s.handleCreateBucket)
+	r.GET("/buckets/:name", s.handleGetBucket)
+	r.GET("/buckets/:name/limits", s.handleGetLimits)
+	r.POST("/buckets/:name/limits", s.handleSetLimits)
+
+	r.POST("/sharekeys", s.handleRegisterShareKey)
+	r.GET("/sharekeys/:id", s.handleGetShareKey)
+	r.POST("/sharekeys/:id/revoke", s.handleRevokeShareKey)
+
+	r.GET("/nodes", s.handleListNodes)
+	r.POST("/nodes", s.handleRegisterNode)
+	r.POST("/nodes/:id/capacity", s.handleReportCapacity)
+	r.POST("/nodes/:id/usage", s.handleSettleUsage)
+	r.POST("/nodes/:id/lost", s.handleReportLostPieces)
+	r.POST("/nodes/:id/exit", s.handleStartExit)
+	r.GET("/nodes/:id/exit", s.handleExitStatus)
+	r.POST("/nodes/:id/exit/transfers", s.handleExitTransfers)
+	r.POST("/nodes/:id/exit/report", s.handleReportExit)
+	r.POST("/usage/bandwidth", s.handleBandwidth)
+	r.POST("/usage/storage", s.handleStorageUsage)
+	r.GET("/repair/segments", s.handleDegradedSegments)
+
+	return r
+}
+
+// authKey is where authenticate leaves the auth key of a request.
+const authKey = "auth-key"
+
+func (s *Server) authenticate(c *gin.Context) {
+	if len(s.keys) == 0 && len(s.rootKeys) == 0 {
+		return
+	}
+
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+
+	if s.keys[token] {
+		return
+	}
+
+	if auth.IsKey(token) {
+		key, err := auth.Parse(token)
+
+		if err == nil {
+			err = key.Verify(s.rootKeys)
+		}
+
+		if err == nil {
+			c.Set(authKey, key)
+			return
+		}
+	}
+
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid api key"})
+}
+
+func requestKey(c *gin.Context) *auth.Key {
+	key, _ := c.Get(authKey)
+	k, _ := key.(*auth.Key)
+	return k
+}
+
+// authorize checks the request against the caveats of the auth key it was
+// made with and aborts it if they are not met. Static keys allow everything.
+func authorize(c *gin.Context, req auth.Request) bool {
+	key := requestKey(c)
+
+	if key == nil {
+		return true
+	}
+
+	if err := key.Authorize(req, time.Now()); err != nil {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return false
+	}
+
+	return true
+}
+
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, types.ErrObjectNotFound), errors.Is(err, types.ErrSegmentNotFound),
+		errors.Is(err, types.ErrBucketNotFound), errors.Is(err, types.ErrShareKeyNotFound),
+		errors.Is(err, types.ErrNodeNotFound), errors.Is(err, types.ErrOrdersDisabled),
+		errors.Is(err, types.ErrNodeNotExiting):
+		return http.StatusNotFound
+	case errors.Is(err, types.ErrObjectExists), errors.Is(err, types.ErrBucketExists),
+		errors.Is(err, types.ErrNodeKeyMismatch):
+		return http.StatusConflict
+	case errors.Is(err, types.ErrInvalidBucketName), errors.Is(err, types.ErrInvalidShareKey),
+		errors.Is(err, types.ErrInvalidReport), errors.Is(err, types.ErrInvalidIdentity),
+		errors.Is(err, types.ErrSameObject):
+		return http.StatusBadRequest
+	case errors.Is(err, types.ErrLimitExceeded):
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func abort(c *gin.Context, err error) {
+	c.AbortWithStatusJSON(errorStatus(err), gin.H{"error": err.Error()})
+}
+
+func (s *Server) handleGetObject(c *gin.Context) {
+	var req types.GetObjectRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !authorize(c, auth.Request{Op: auth.OpRead, Names: []string{req.Name}}) {
+		return
+	}
+
+	obj, err := s.store.GetObject(req.Name)
+
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	for _, segment := range obj.Segments {
+		s.signOrders(segment.Pieces, types.BucketOf(obj.Name), orders.ActionGet, segment.PieceSize())
+	}
+
+	c.JSON(http.StatusOK, types.GetObjectResponse{Object: *obj})
+}
+
+func (s *Server) handlePutObject(c *gin.Context) {
+	var obj types.Object
+
+	if err := c.ShouldBindJSON(&obj); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !authorize(c, auth.Request{Op: auth.OpWrite, Names: []string{obj.Name}}) {
+		return
+	}
+
+	if err := s.store.PutObject(&obj); err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func (s *Server) handleDeleteObject(c *gin.Context) {
+	var req types.DeleteObjectRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !authorize(c, auth.Request{Op: auth.OpDelete, Names: []string{req.Name}}) {
+		return
+	}
+
+	pieces, err := s.store.DeleteObject(req.Name)
+
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	s.signOrders(pieces, types.BucketOf(req.Name), orders.ActionDelete, 0)
+
+	c.JSON(http.StatusOK, types.DeleteObjectResponse{Pieces: pieces})
+}
+
+func (s *Server) handleCopyObject(c *gin.Context) {
+	var req types.CopyObjectRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !authorize(c, auth.Request{Op: auth.OpRead, Names: []string{req.Source}}) ||
+		!authorize(c, auth.Request{Op: auth.OpWrite, Names: []string{req.Destination}}) {
+		return
+	}
+
+	obj, err := s.store.CopyObject(req.Source, req.Destination)
+
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.GetObjectResponse{Object: *obj})
+}
+
+func (s *Server) handleMoveObject(c *gin.Context) {
+	var req types.CopyObjectRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !authorize(c, auth.Request{Op: auth.OpRead, Names: []string{req.Source}}) ||
+		!authorize(c, auth.Request{Op: auth.OpDelete, Names: []string{req.Source}}) ||
+		!authorize(c, auth.Request{Op: auth.OpWrite, Names: []string{req.Destination}}) {
+		return
+	}
+
+	obj, err := s.store.MoveObject(req.Source, req.Destination)
+
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.GetObjectResponse{Object: *obj})
+}
+
+func (s *Server) handleReplaceObject(c *gin.Context) {
+	var req types.CopyObjectRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !authorize(c, auth.Request{Op: auth.OpRead, Names: []string{req.Source}}) ||
+		!authorize(c, auth.Request{Op: auth.OpDelete, Names: []string{req.Source, req.Destination}}) ||
+		!authorize(c, auth.Request{Op: auth.OpWrite, Names: []string{req.Destination}}) {
+		return
+	}
+
+	obj, pieces, err := s.store.ReplaceObject(req.Source, req.Destination)
+
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	s.signOrders(pieces, types.BucketOf(req.Destination), orders.ActionDelete, 0)
+
+	c.JSON(http.StatusOK, types.ReplaceObjectResponse{Object: *obj, Pieces: pieces})
+}
+
+func (s *Server) handleComposeObject(c *gin.Context) {
+	var req types.ComposeObjectRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !authorize(c, auth.Request{Op: auth.OpRead, Names: req.Sources}) ||
+		!authorize(c, auth.Request{Op: auth.OpWrite, Names: []string{req.Destination}}) {
+		return
+	}
+
+	obj, err := s.store.ComposeObject(req.Destination, req.Sources)
+
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.GetObjectResponse{Object: *obj})
+}
+
+func (s *Server) handleUpdateObject(c *gin.Context) {
+	var req types.UpdateObjectRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !authorize(c, auth.Request{Op: auth.OpWrite, Names: []string{req.Name}}) {
+		return
+	}
+
+	obj, err := s.store.UpdateObject(&req)
+
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.GetObjectResponse{Object: *obj})
+}
+
+func (s *Server) handleCreateSegment(c *gin.Context) {
+	objectID, err := uuid.Parse(c.Param("id"))
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid object id"})
+		return
+	}
+
+	var segment types.Segment
+
+	if err := c.ShouldBindJSON(&segment); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	segment.ObjectID = types.ObjectID(objectID)
+
+	name, err := s.store.ObjectName(segment.ObjectID)
+
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	if !authorize(c, auth.Request{Op: auth.OpWrite, Names: []string{name}}) {
+		return
+	}
+
+	stored, err := s.store.CreateSegment(&segment)
+
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.SegmentResponse{Segment: stored})
+}
+
+// signOrders sets an order for action on each of the pieces, replacing them
+// with copies so that stored pieces are never modified. Their traffic is
+// accounted to bucket. It does nothing if the server has no order key.
+func (s *Server) signOrders(pieces []*types.Piece, bucket string, action orders.Action, maxSize int64) {
+	if s.orderKey == nil {
+		return
+	}
+
+	expires := time.Now().Add(orderTTL)
+
+	for i, piece := range pieces {
+		p := *piece
+		p.Order = orders.Sign(&orders.Order{
+			Serial:  orders.NewSerial(),
+			Bucket:  bucket,
+			PieceID: p.ID,
+			NodeID:  p.NodeID,
+			Action:  action,
+			MaxSize: maxSize,
+			Expires: expires,
+		}, s.orderKey)
+		pieces[i] = &p
+	}
+}
+
+// handleCreateOrders signs orders to upload new pieces of an object, or to
+// delete pieces of it that no segment references, like those of an upload
+// that lost a race to store the same content.
+func (s *Server) handleCreateOrders(c *gin.Context) {
+	objectID, err := uuid.Parse(c.Param("id"))
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid object id"})
+		return
+	}
+
+	var req types.OrderRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if s.orderKey == nil {
+		abort(c, types.ErrOrdersDisabled)
+		return
+	}
+
+	name, err := s.store.ObjectName(types.ObjectID(objectID))
+
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	// deleting pieces needs a key that may delete, not only write
+	op := auth.OpWrite
+
+	if orders.Action(req.Action) == orders.ActionDelete {
+		op = auth.OpDelete
+	}
+
+	if !authorize(c, auth.Request{Op: op, Names: []string{name}}) {
+		return
+	}
+
+	switch orders.Action(req.Action) {
+	case orders.ActionPut:
+		if req.MaxSize <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "missing max size"})
+			return
+		}
+	case orders.ActionDelete:
+		if s.store.Referenced(req.Pieces) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "pieces are in use"})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid action"})
+		return
+	}
+
+	s.signOrders(req.Pieces, types.BucketOf(name), orders.Action(req.Action), req.MaxSize)
+
+	c.JSON(http.StatusOK, types.OrderResponse{Pieces: req.Pieces})
+}
+
+func (s *Server) handleOrderKey(c *gin.Context) {
+	if s.orderKey == nil {
+		abort(c, types.ErrOrdersDisabled)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.OrderKeyResponse{PublicKey: s.orderKey.Public().(ed25519.PublicKey)})
+}
+
+func (s *Server) handleLookupSegment(c *gin.Context) {
+	var req types.LookupSegmentRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name, err := s.store.ObjectName(req.ObjectID)
+
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	// lookups only happen while writing
+	if !authorize(c, auth.Request{Op: auth.OpWrite, Names: []string{name}}) {
+		return
+	}
+
+	segment, err := s.store.LookupSegment(types.BucketOf(name), req.ContentKey)
+
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.SegmentResponse{Segment: segment})
+}
+
+func (s *Server) handleListObjects(c *gin.Context) {
+	var req types.ListObjectsRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !authorize(c, auth.Request{Op: auth.OpList}) {
+		return
+	}
+
+	objects := s.store.ListObjects(req.Prefix)
+
+	// keys limited to some names only see those
+	if key := requestKey(c); key != nil {
+		allowed := objects[:0]
+
+		for _, obj := range objects {
+			if key.Allows(obj.Name) {
+				allowed = append(allowed, obj)
+			}
+		}
+
+		objects = allowed
+	}
+
+	c.JSON(http.StatusOK, types.ListObjectsResponse{Objects: objects})
+}
+
+func (s *Server) handleListNodes(c *gin.Context) {
+	c.JSON(http.StatusOK, types.ListNodesResponse{Nodes: s.store.ListNodes()})
+}
+
+func (s *Server) handleRegisterNode(c *gin.Context) {
+	var node types.Node
+
+	if err := c.ShouldBindJSON(&node); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !authorize(c, auth.Request{Op: auth.OpAdmin}) {
+		return
+	}
+
+	if node.HttpAddr == "" && node.GRPCAddr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "node has no address"})
+		return
+	}
+
+	// clients trust the key of a node to verify its receipts
+	if len(node.PublicKey) > 0 && !identity.Verify(node.ID, node.PublicKey) {
+		abort(c, types.ErrInvalidIdentity)
+		return
+	}
+
+	if err := s.store.RegisterNode(&node); err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func (s *Server) handleReportCapacity(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid node id"})
+		return
+	}
+
+	var req types.ReportCapacityRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !authorize(c, auth.Request{Op: auth.OpAdmin}) {
+		return
+	}
+
+	if err := s.store.ReportCapacity(types.NodeID(id), req.Capacity, req.Free); err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// handleReportLostPieces records the pieces a node found corrupted, their
+// segments are listed for repair.
+func (s *Server) handleReportLostPieces(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid node id"})
+		return
+	}
+
+	var req types.LostPiecesRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !authorize(c, auth.Request{Op: auth.OpAdmin}) {
+		return
+	}
+
+	if _, err := s.store.ReportLostPieces(types.NodeID(id), req.Pieces); err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (s *Server) handleDegradedSegments(c *gin.Context) {
+	if !authorize(c, auth.Request{Op: auth.OpAdmin}) {
+		return
+	}
+
+	c.JSON(http.StatusOK, types.RepairResponse{Segments: s.store.DegradedSegments()})
+}
+
+// exitBatch is the number of transfers handed out if a node asks for none in
+// particular.
+const exitBatch = 100
+
+func (s *Server) handleStartExit(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid node id"})
+		return
+	}
+
+	if !authorize(c, auth.Request{Op: auth.OpAdmin}) {
+		return
+	}
+
+	status, err := s.store.StartExit(types.NodeID(id), time.Now())
+
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+func (s *Server) handleExitStatus(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid node id"})
+		return
+	}
+
+	if !authorize(c, auth.Request{Op: auth.OpAdmin}) {
+		return
+	}
+
+	status, err := s.store.ExitStatus(types.NodeID(id))
+
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// handleExitTransfers hands an exiting node the next pieces to transfer. The
+// traffic is accounted to no bucket, it is the node's and not a customer's.
+func (s *Server) handleExitTransfers(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid node id"})
+		return
+	}
+
+	var req types.ExitTransfersRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !authorize(c, auth.Request{Op: auth.OpAdmin}) {
+		return
+	}
+
+	if req.Limit <= 0 {
+		req.Limit = exitBatch
+	}
+
+	transfers, err := s.store.ExitTransfers(types.NodeID(id), req.Limit, time.Now())
+
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	for _, t := range transfers {
+		pieces := []*types.Piece{t.Piece}
+		s.signOrders(pieces, "", orders.ActionPut, t.Size)
+		t.Piece = pieces[0]
+	}
+
+	c.JSON(http.StatusOK, types.ExitTransfersResponse{Transfers: transfers})
+}
+
+// handleReportExit records the transfers of an exiting node. Transfers only
+// count if their target signed a receipt for the piece.
+func (s *Server) handleReportExit(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid node id"})
+		return
+	}
+
+	var report types.ExitReport
+
+	if err := c.ShouldBindJSON(&report); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !authorize(c, auth.Request{Op: auth.OpAdmin}) {
+		return
+	}
+
+	status, err := s.store.ReportExit(types.NodeID(id), report.Results, time.Now())
+
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// handleSettleUsage accounts the traffic of a usage report. The report must be
+// signed by the node and every order by the server, settlements are capped at
+// the size their order allowed.
+func (s *Server) handleSettleUsage(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid node id"})
+		return
+	}
+
+	var report types.UsageReport
+
+	if err := c.ShouldBindJSON(&report); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !authorize(c, auth.Request{Op: auth.OpAdmin}) {
+		return
+	}
+
+	if s.orderKey == nil {
+		abort(c, types.ErrOrdersDisabled)
+		return
+	}
+
+	node, err := s.store.GetNode(types.NodeID(id))
+
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	if report.NodeID != node.ID || orders.VerifyReport(&report, node.PublicKey) != nil {
+		abort(c, types.ErrInvalidReport)
+		return
+	}
+
+	orderKey := s.orderKey.Public().(ed25519.PublicKey)
+	now := time.Now()
+
+	var resp types.SettleResponse
+
+	for _, settlement := range report.Settlements {
+		o, sig, err := orders.Parse(settlement.Order)
+
+		if err == nil {
+			err = orders.VerifySignature(o, sig, orderKey)
+		}
+
+		if err != nil || o.NodeID != node.ID || now.After(o.Expires.Add(orders.SettleWindow)) ||
+			!s.store.Settle(o, min(max(settlement.Bytes, 0), o.MaxSize), now) {
+			resp.Rejected++
+			continue
+		}
+
+		resp.Accepted++
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (s *Server) handleBandwidth(c *gin.Context) {
+	var req types.BandwidthRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !authorize(c, auth.Request{Op: auth.OpAdmin}) {
+		return
+	}
+
+	c.JSON(http.StatusOK, types.BandwidthResponse{Rollups: s.store.Bandwidth(&req)})
+}
+
+func (s *Server) handleListBuckets(c *gin.Context) {
+	if !authorize(c, auth.Request{Op: auth.OpList}) {
+		return
+	}
+
+	buckets := s.store.ListBuckets()
+
+	if key := requestKey(c); key != nil {
+		allowed := buckets[:0]
+
+		for _, bucket := range buckets {
+			if key.AllowsBucket(bucket.Name) {
+				allowed = append(allowed, bucket)
+			}
+		}
+
+		buckets = allowed
+	}
+
+	c.JSON(http.StatusOK, types.ListBucketsResponse{Buckets: buckets})
+}
+
+func (s *Server) handleCreateBucket(c *gin.Context) {
+	var req types.CreateBucketRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !authorize(c, auth.Request{Op: auth.OpWrite, Buckets: []string{req.Name}}) {
+		return
+	}
+
+	bucket, err := s.store.CreateBucket(req.Name)
+
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, bucket)
+}
+
+func (s *Server) handleGetBucket(c *gin.Context) {
+	// any operation on a bucket needs to see it exists
+	if !authorize(c, auth.Request{Buckets: []string{c.Param("name")}}) {
+		return
+	}
+
+	bucket, err := s.store.GetBucket(c.Param("name"))
+
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, bucket)
+}
+
+func (s *Server) handleGetLimits(c *gin.Context) {
+	if !authorize(c, auth.Request{Buckets: []string{c.Param("name")}}) {
+		return
+	}
+
+	c.JSON(http.StatusOK, s.store.Limits(c.Param("name")))
+}
+
+func (s *Server) handleSetLimits(c *gin.Context) {
+	var limits types.Limits
+
+	if err := c.ShouldBindJSON(&limits); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !authorize(c, auth.Request{Op: auth.OpAdmin}) {
+		return
+	}
+
+	s.store.SetLimits(c.Param("name"), limits)
+
+	c.JSON(http.StatusOK, limits)
+}
+
+// handleStorageUsage returns the storage tally of a bucket to anyone who may
+// see it, the tallies of all buckets only to admins.
+func (s *Server) handleStorageUsage(c *gin.Context) {
+	var req types.StorageUsageRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	access := auth.Request{Op: auth.OpAdmin}
+
+	if req.Bucket != "" {
+		access = auth.Request{Buckets: []string{req.Bucket}}
+	}
+
+	if !authorize(c, access) {
+		return
+	}
+
+	c.JSON(http.StatusOK, types.StorageUsageResponse{Tallies: s.store.StorageUsage(req.Bucket)})
+}
+
+func (s *Server) handleRegisterShareKey(c *gin.Context) {
+	var req types.RegisterShareKeyRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !authorize(c, auth.Request{Op: auth.OpAdmin}) {
+		return
+	}
+
+	key, err := s.store.RegisterShareKey(req.PublicKey)
+
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, key)
+}
+
+func (s *Server) handleGetShareKey(c *gin.Context) {
+	if !authorize(c, auth.Request{Op: auth.OpRead}) {
+		return
+	}
+
+	key, err := s.store.GetShareKey(c.Param("id"))
+
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, key)
+}
+
+func (s *Server) handleRevokeShareKey(c *gin.Context) {
+	if !authorize(c, auth.Request{Op: auth.OpAdmin}) {
+		return
+	}
+
+	if err := s.store.RevokeShareKey(c.Param("id")); err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,102 @@
+package metadata_test
+
+import (
+	"dfs/auth"
+	"dfs/client/api"
+	"dfs/metadata"
+	"dfs/types"
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthKeys(t *testing.T) {
+	secret := []byte("root secret")
+
+	ts := httptest.NewServer(metadata.NewServer(metadata.WithRootKey("root", secret)).Handler())
+	defer ts.Close()
+
+	root := auth.NewKey("root", secret)
+	admin := api.NewClient(ts.URL, root.Encode())
+
+	for _, name := range []string{"ci/build.log", "secret/passwords.txt"} {
+		obj := types.NewObject(name)
+
+		if err := admin.PutObject(&obj); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	ci := api.NewClient(ts.URL, root.Attenuate(auth.AllowOps(auth.OpRead, auth.OpList), auth.AllowPrefixes("ci/")).Encode())
+
+	t.Run("allows what the caveats allow", func(t *testing.T) {
+		if _, err := ci.GetObject("ci/build.log"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("forbids other names and operations", func(t *testing.T) {
+		if _, err := ci.GetObject("secret/passwords.txt"); !errors.Is(err, types.ErrForbidden) {
+			t.Fatalf("expected %v, got %v", types.ErrForbidden, err)
+		}
+
+		if _, err := ci.DeleteObject("ci/build.log"); !errors.Is(err, types.ErrForbidden) {
+			t.Fatalf("expected %v, got %v", types.ErrForbidden, err)
+		}
+
+		if _, err := ci.CopyObject("ci/build.log", "ci/copy.log"); !errors.Is(err, types.ErrForbidden) {
+			t.Fatalf("expected %v, got %v", types.ErrForbidden, err)
+		}
+	})
+
+	t.Run("forbids admin requests to keys restricted to names", func(t *testing.T) {
+		prefixed := api.NewClient(ts.URL, root.Attenuate(auth.AllowPrefixes("ci/")).Encode())
+		node := &types.Node{ID: types.NewNodeID(), HttpAddr: "http://node"}
+
+		if err := prefixed.RegisterNode(node); !errors.Is(err, types.ErrForbidden) {
+			t.Fatalf("expected %v, got %v", types.ErrForbidden, err)
+		}
+	})
+
+	t.Run("filters listings", func(t *testing.T) {
+		objs, err := ci.ListObjects("")
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(objs) != 1 || objs[0].Name != "ci/build.log" {
+			t.Fatalf("expected only ci/build.log, got %+v", objs)
+		}
+	})
+
+	t.Run("rejects forged keys", func(t *testing.T) {
+		forged := api.NewClient(ts.URL, auth.NewKey("root", []byte("guess")).Encode())
+
+		if _, err := forged.GetObject("ci/build.log"); !errors.Is(err, types.ErrUnauthorized) {
+			t.Fatalf("expected %v, got %v", types.ErrUnauthorized, err)
+		}
+	})
+}
+
+func TestReplaceObject(t *testing.T) {
+	ts := httptest.NewServer(metadata.NewServer().Handler())
+	defer ts.Close()
+
+	client := api.NewClient(ts.URL, "")
+	obj := types.NewObject("photos/cat.jpg")
+
+	if err := client.PutObject(&obj); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	t.Run("rejects replacing an object with itself", func(t *testing.T) {
+		if _, _, err := client.ReplaceObject("photos/cat.jpg", "photos/cat.jpg"); !errors.Is(err, types.ErrSameObject) {
+			t.Fatalf("expected %v, got %v", types.ErrSameObject, err)
+		}
+
+		if _, err := client.GetObject("photos/cat.jpg"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
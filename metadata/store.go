@@ -0,0 +1,1386 @@
+package metadata
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"dfs/identity"
+	"dfs/orders"
+	"dfs/types"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Store keeps object metadata in memory.
+//
+// Pieces may be shared by several segments, either because segments were
+// deduplicated by content key or because an object was copied. The store
+// counts references per set of pieces so that deleting an object only frees
+// pieces nobody else uses.
+//
+// Content keys are computed by clients and taken on trust: whoever may write
+// to a bucket can store pieces under a key another writer will match. Shared
+// segments are therefore only matched within the bucket they were stored in,
+// and writers check a shared segment holds their data before using it.
+type Store struct {
+	mu sync.Mutex
+
+	objects   map[string]*types.Object
+	objectIDs map[types.ObjectID]*types.Object
+
+	refs   map[string]int
+	shared map[string]*types.Segment
+
+	// sharedKeys maps the data key of shared segments to their key in shared.
+	sharedKeys map[string]string
+
+	nodes   map[types.NodeID]*types.Node
+	buckets map[string]*types.Bucket
+
+	shareKeys map[string]*types.ShareKey
+
+	// settled holds the serials of settled orders until they can no longer
+	// be submitted, bandwidth the traffic they were settled for.
+	settled   map[string]time.Time
+	bandwidth map[rollupKey]*types.BandwidthRollup
+
+	// tallies is what the objects of each bucket store, limits what the
+	// buckets with their own limits may use.
+	tallies       map[string]*types.StorageTally
+	limits        map[string]types.Limits
+	defaultLimits types.Limits
+
+	// exits tracks the nodes leaving the network and the pieces they still
+	// have to transfer.
+	exits map[types.NodeID]*exit
+
+	// lost holds the pieces storage nodes reported corrupted, until their
+	// segments are repaired or deleted.
+	lost map[types.PieceID]bool
+}
+
+type exit struct {
+	status  types.ExitStatus
+	pending map[types.PieceID]*exitPiece
+}
+
+// exitPiece is a piece of an exiting node. target is the node it was last
+// handed out to, attempts how many transfers failed.
+type exitPiece struct {
+	target   types.NodeID
+	attempts int
+}
+
+// maxExitAttempts is how often the transfer of a piece may fail before it is
+// given up.
+const maxExitAttempts = 3
+
+type rollupKey struct {
+	node   types.NodeID
+	bucket string
+	day    time.Time
+}
+
+// WithDefaultLimits limits every bucket without limits of its own.
+func WithDefaultLimits(limits types.Limits) func(*Store) {
+	return func(s *Store) {
+		s.defaultLimits = limits
+	}
+}
+
+func NewStore(opts ...func(*Store)) *Store {
+	s := &Store{
+		objects:    make(map[string]*types.Object),
+		objectIDs:  make(map[types.ObjectID]*types.Object),
+		refs:       make(map[string]int),
+		shared:     make(map[string]*types.Segment),
+		sharedKeys: make(map[string]string),
+		nodes:      make(map[types.NodeID]*types.Node),
+		buckets:    make(map[string]*types.Bucket),
+		shareKeys:  make(map[string]*types.ShareKey),
+		settled:    make(map[string]time.Time),
+		bandwidth:  make(map[rollupKey]*types.BandwidthRollup),
+		tallies:    make(map[string]*types.StorageTally),
+		limits:     make(map[string]types.Limits),
+		exits:      make(map[types.NodeID]*exit),
+		lost:       make(map[types.PieceID]bool),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// dataKey identifies the pieces backing a segment by its first piece, which
+// is unique to the upload that created it and kept by the segments sharing
+// its pieces.
+func dataKey(segment *types.Segment) string {
+	if len(segment.Pieces) == 0 {
+		return "segment:" + segment.ID.String()
+	}
+
+	return "piece:" + segment.Pieces[0].ID.String()
+}
+
+func cloneSegment(segment *types.Segment) *types.Segment {
+	c := *segment
+	c.Pieces = append([]*types.Piece(nil), segment.Pieces...)
+	return &c
+}
+
+func cloneObject(obj *types.Object) *types.Object {
+	c := *obj
+	c.Metadata = maps.Clone(obj.Metadata)
+	c.Segments = make([]*types.Segment, len(obj.Segments))
+
+	for i, segment := range obj.Segments {
+		c.Segments[i] = cloneSegment(segment)
+	}
+
+	return &c
+}
+
+// object returns the object stored under name. An expired object is removed
+// instead, freeing the name. Its pieces are left to the storage nodes, which
+// delete them once they expire.
+func (s *Store) object(name string) (*types.Object, bool) {
+	obj, ok := s.objects[name]
+
+	if ok && obj.Expired(time.Now()) {
+		s.remove(obj)
+		return nil, false
+	}
+
+	return obj, ok
+}
+
+func (s *Store) GetObject(name string) (*types.Object, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, ok := s.object(name)
+
+	if !ok {
+		return nil, types.ErrObjectNotFound
+	}
+
+	return cloneObject(obj), nil
+}
+
+// ObjectName returns the name of the object with the ID.
+func (s *Store) ObjectName(id types.ObjectID) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, ok := s.objectIDs[id]
+
+	if !ok || obj.Expired(time.Now()) {
+		return "", types.ErrObjectNotFound
+	}
+
+	return obj.Name, nil
+}
+
+// ListObjects returns the objects whose name starts with prefix, sorted by
+// name and without their segments. Expired objects are left out.
+func (s *Store) ListObjects(prefix string) []*types.Object {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var objects []*types.Object
+	now := time.Now()
+
+	for name, obj := range s.objects {
+		if strings.HasPrefix(name, prefix) && !obj.Expired(now) {
+			listed := *obj
+			listed.Metadata = maps.Clone(obj.Metadata)
+			listed.Segments = nil
+			objects = append(objects, &listed)
+		}
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Name < objects[j].Name
+	})
+
+	return objects
+}
+
+func (s *Store) PutObject(obj *types.Object) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.object(obj.Name); ok {
+		return types.ErrObjectExists
+	}
+
+	if err := s.checkLimits(types.BucketOf(obj.Name), int64(obj.Size)); err != nil {
+		return err
+	}
+
+	stored := *obj
+	stored.Segments = nil
+	stored.CreatedAt = time.Now().UTC()
+	stored.ModifiedAt = stored.CreatedAt
+
+	for _, segment := range obj.Segments {
+		if len(segment.Pieces) > 0 {
+			s.addSegment(&stored, segment)
+		}
+	}
+
+	s.objects[stored.Name] = &stored
+	s.objectIDs[stored.ID] = &stored
+	s.tally(&stored, 1)
+
+	return nil
+}
+
+// CreateSegment adds the segment to its object. If a segment with the same
+// content key already exists its pieces replace the ones sent by the client,
+// the returned segment is the one that was stored.
+func (s *Store) CreateSegment(segment *types.Segment) (*types.Segment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, ok := s.objectIDs[segment.ObjectID]
+
+	if !ok || obj.Expired(time.Now()) {
+		return nil, types.ErrObjectNotFound
+	}
+
+	bucket := types.BucketOf(obj.Name)
+
+	if err := s.checkLimits(bucket, int64(segment.Size)); err != nil {
+		return nil, err
+	}
+
+	stored := s.addSegment(obj, segment)
+	s.tallySegment(bucket, stored, 1)
+
+	return cloneSegment(stored), nil
+}
+
+func (s *Store) addSegment(obj *types.Object, segment *types.Segment) *types.Segment {
+	stored := *segment
+	stored.ObjectID = obj.ID
+	stored.Pieces = make([]*types.Piece, len(segment.Pieces))
+
+	// orders are handed out, never stored
+	for i, piece := range segment.Pieces {
+		p := *piece
+		p.Order = ""
+		stored.Pieces[i] = &p
+	}
+
+	shared := false
+
+	if len(stored.ContentKey) > 0 {
+		key := sharedKey(types.BucketOf(obj.Name), stored.ContentKey)
+
+		if canonical, ok := s.shared[key]; ok {
+			stored.Pieces = canonical.Pieces
+			stored.Compression = canonical.Compression
+			stored.EncodedSize = canonical.EncodedSize
+			shared = true
+		} else {
+			s.shared[key] = &stored
+			s.sharedKeys[dataKey(&stored)] = key
+		}
+	}
+
+	// clients may not know yet that a node is leaving
+	if !shared {
+		s.queueExit(stored.Pieces)
+	}
+
+	s.refs[dataKey(&stored)]++
+
+	// keep segments ordered by position
+	i := len(obj.Segments)
+	for i > 0 && obj.Segments[i-1].Position > stored.Position {
+		i--
+	}
+	obj.Segments = append(obj.Segments, nil)
+	copy(obj.Segments[i+1:], obj.Segments[i:])
+	obj.Segments[i] = &stored
+
+	return &stored
+}
+
+// Referenced reports whether any segment references one of the pieces. It
+// looks at every segment and is meant for the rare cases where pieces are
+// deleted without deleting an object.
+func (s *Store) Referenced(pieces []*types.Piece) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make(map[types.PieceID]bool, len(pieces))
+
+	for _, piece := range pieces {
+		ids[piece.ID] = true
+	}
+
+	for _, obj := range s.objects {
+		for _, segment := range obj.Segments {
+			for _, piece := range segment.Pieces {
+				if ids[piece.ID] {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// sharedKey scopes a content key to the bucket it was stored in.
+func sharedKey(bucket string, contentKey []byte) string {
+	return bucket + "/" + hex.EncodeToString(contentKey)
+}
+
+// LookupSegment returns the shared segment stored in the bucket under the
+// content key.
+func (s *Store) LookupSegment(bucket string, contentKey []byte) (*types.Segment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	segment, ok := s.shared[sharedKey(bucket, contentKey)]
+
+	if !ok {
+		return nil, types.ErrSegmentNotFound
+	}
+
+	return cloneSegment(segment), nil
+}
+
+// CopyObject stores a copy of the object under a new name. The copy gets new
+// object and segment IDs but references the pieces of the source, so it
+// expires with it.
+func (s *Store) CopyObject(src, dst string) (*types.Object, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, ok := s.object(src)
+
+	if !ok {
+		return nil, types.ErrObjectNotFound
+	}
+
+	if _, ok := s.object(dst); ok {
+		return nil, types.ErrObjectExists
+	}
+
+	if err := s.checkLimits(types.BucketOf(dst), storedSize(obj)); err != nil {
+		return nil, err
+	}
+
+	cp := cloneObject(obj)
+	cp.ID = types.NewObjectID()
+	cp.Name = dst
+	cp.CreatedAt = time.Now().UTC()
+	cp.ModifiedAt = cp.CreatedAt
+
+	for _, segment := range cp.Segments {
+		segment.ID = types.NewSegmentID()
+		segment.ObjectID = cp.ID
+		s.refs[dataKey(segment)]++
+	}
+
+	s.objects[cp.Name] = cp
+	s.objectIDs[cp.ID] = cp
+	s.tally(cp, 1)
+
+	return cloneObject(cp), nil
+}
+
+// ComposeObject stores dst made up of the segments of srcs, in order. Like a
+// copy it references the pieces of the sources without moving any data, and
+// it expires with the first of them to expire.
+func (s *Store) ComposeObject(dst string, srcs []string) (*types.Object, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.object(dst); ok {
+		return nil, types.ErrObjectExists
+	}
+
+	obj := types.NewObject(dst)
+	obj.CreatedAt = time.Now().UTC()
+	obj.ModifiedAt = obj.CreatedAt
+
+	for _, src := range srcs {
+		part, ok := s.object(src)
+
+		if !ok {
+			return nil, types.ErrObjectNotFound
+		}
+
+		if !part.ExpiresAt.IsZero() && (obj.ExpiresAt.IsZero() || part.ExpiresAt.Before(obj.ExpiresAt)) {
+			obj.ExpiresAt = part.ExpiresAt
+		}
+
+		for _, segment := range part.Segments {
+			c := cloneSegment(segment)
+			c.ID = types.NewSegmentID()
+			c.ObjectID = obj.ID
+			c.Position = uint(len(obj.Segments))
+
+			obj.Segments = append(obj.Segments, c)
+			obj.Size += c.Size
+		}
+
+		obj.Compression = part.Compression
+	}
+
+	if err := s.checkLimits(types.BucketOf(dst), storedSize(&obj)); err != nil {
+		return nil, err
+	}
+
+	for _, segment := range obj.Segments {
+		s.refs[dataKey(segment)]++
+	}
+
+	s.objects[obj.Name] = &obj
+	s.objectIDs[obj.ID] = &obj
+	s.tally(&obj, 1)
+
+	return cloneObject(&obj), nil
+}
+
+// UpdateObject changes the metadata of the object, see
+// types.UpdateObjectRequest.
+func (s *Store) UpdateObject(req *types.UpdateObjectRequest) (*types.Object, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, ok := s.object(req.Name)
+
+	if !ok {
+		return nil, types.ErrObjectNotFound
+	}
+
+	if req.ContentHash != nil {
+		obj.ContentHash = req.ContentHash
+	}
+
+	if req.ContentType != nil || req.Metadata != nil {
+		obj.ModifiedAt = time.Now().UTC()
+	}
+
+	if req.ContentType != nil {
+		obj.ContentType = *req.ContentType
+	}
+
+	if req.Metadata != nil {
+		obj.Metadata = maps.Clone(req.Metadata)
+	}
+
+	return cloneObject(obj), nil
+}
+
+// MoveObject renames the object, keeping its timestamps.
+func (s *Store) MoveObject(src, dst string) (*types.Object, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, ok := s.object(src)
+
+	if !ok {
+		return nil, types.ErrObjectNotFound
+	}
+
+	if _, ok := s.object(dst); ok {
+		return nil, types.ErrObjectExists
+	}
+
+	if bucket := types.BucketOf(dst); bucket != types.BucketOf(src) {
+		if err := s.checkLimits(bucket, storedSize(obj)); err != nil {
+			return nil, err
+		}
+	}
+
+	s.rename(obj, dst)
+
+	return cloneObject(obj), nil
+}
+
+// ReplaceObject moves src to dst like MoveObject but replaces dst if it
+// exists. It returns the pieces of the replaced object that are no longer
+// referenced. An object cannot replace itself.
+func (s *Store) ReplaceObject(src, dst string) (*types.Object, []*types.Piece, error) {
+	if src == dst {
+		return nil, nil, types.ErrSameObject
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, ok := s.object(src)
+
+	if !ok {
+		return nil, nil, types.ErrObjectNotFound
+	}
+
+	old, replaced := s.object(dst)
+
+	if bucket := types.BucketOf(dst); bucket != types.BucketOf(src) {
+		size := storedSize(obj)
+
+		// the replaced object makes room
+		if replaced {
+			size -= storedSize(old)
+		}
+
+		if err := s.checkLimits(bucket, size); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var freed []*types.Piece
+
+	if replaced {
+		freed = s.remove(old)
+	}
+
+	s.rename(obj, dst)
+
+	return cloneObject(obj), freed, nil
+}
+
+func (s *Store) rename(obj *types.Object, name string) {
+	s.tally(obj, -1)
+	delete(s.objects, obj.Name)
+	obj.Name = name
+	s.objects[name] = obj
+	s.tally(obj, 1)
+}
+
+// DeleteObject removes the object and returns the pieces that are no longer
+// referenced by any segment.
+func (s *Store) DeleteObject(name string) ([]*types.Piece, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, ok := s.object(name)
+
+	if !ok {
+		return nil, types.ErrObjectNotFound
+	}
+
+	return s.remove(obj), nil
+}
+
+func (s *Store) remove(obj *types.Object) []*types.Piece {
+	delete(s.objects, obj.Name)
+	delete(s.objectIDs, obj.ID)
+	s.tally(obj, -1)
+
+	var freed []*types.Piece
+
+	for _, segment := range obj.Segments {
+		freed = append(freed, s.release(segment)...)
+	}
+
+	return freed
+}
+
+// PurgeExpired removes the objects that expired at now and returns how many
+// there were.
+func (s *Store) PurgeExpired(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := 0
+
+	for _, obj := range s.objects {
+		if obj.Expired(now) {
+			s.remove(obj)
+			purged++
+		}
+	}
+
+	// orders past their settle window are rejected without looking them up
+	for serial, until := range s.settled {
+		if now.After(until) {
+			delete(s.settled, serial)
+		}
+	}
+
+	return purged
+}
+
+func (s *Store) release(segment *types.Segment) []*types.Piece {
+	key := dataKey(segment)
+
+	s.refs[key]--
+
+	if s.refs[key] > 0 {
+		return nil
+	}
+
+	delete(s.refs, key)
+
+	if shared, ok := s.sharedKeys[key]; ok {
+		delete(s.shared, shared)
+		delete(s.sharedKeys, key)
+	}
+
+	for _, piece := range segment.Pieces {
+		delete(s.lost, piece.ID)
+	}
+
+	return segment.Pieces
+}
+
+// RegisterNode adds or updates a node. A node registered with a public key
+// keeps it, so that nobody else can sign reports in its name, and an exiting
+// node stays exiting.
+func (s *Store) RegisterNode(node *types.Node) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.nodes[node.ID]; ok && len(existing.PublicKey) > 0 && !bytes.Equal(existing.PublicKey, node.PublicKey) {
+		return types.ErrNodeKeyMismatch
+	}
+
+	registered := *node
+	_, registered.Exiting = s.exits[node.ID]
+	s.nodes[node.ID] = &registered
+
+	return nil
+}
+
+func (s *Store) GetNode(id types.NodeID) (*types.Node, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	node, ok := s.nodes[id]
+
+	if !ok {
+		return nil, types.ErrNodeNotFound
+	}
+
+	c := *node
+	return &c, nil
+}
+
+// ReportCapacity records the capacity a node reported.
+func (s *Store) ReportCapacity(id types.NodeID, capacity, free uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	node, ok := s.nodes[id]
+
+	if !ok {
+		return types.ErrNodeNotFound
+	}
+
+	node.Capacity = capacity
+	node.Free = free
+
+	return nil
+}
+
+func (s *Store) ListNodes() []*types.Node {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nodes := make([]*types.Node, 0, len(s.nodes))
+
+	for _, node := range s.nodes {
+		listed := *node
+		nodes = append(nodes, &listed)
+	}
+
+	return nodes
+}
+
+// StartExit marks the node as exiting and collects the pieces it has to
+// transfer to other nodes. Starting an exit again returns its status.
+func (s *Store) StartExit(id types.NodeID, now time.Time) (*types.ExitStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	node, ok := s.nodes[id]
+
+	if !ok {
+		return nil, types.ErrNodeNotFound
+	}
+
+	if e, ok := s.exits[id]; ok {
+		status := e.status
+		return &status, nil
+	}
+
+	node.Exiting = true
+
+	e := &exit{
+		status:  types.ExitStatus{NodeID: id, StartedAt: now},
+		pending: make(map[types.PieceID]*exitPiece),
+	}
+	s.exits[id] = e
+
+	for _, obj := range s.objects {
+		for _, segment := range obj.Segments {
+			s.queueExit(segment.Pieces)
+		}
+	}
+
+	e.finish(now)
+
+	status := e.status
+	return &status, nil
+}
+
+// queueExit adds the pieces stored on exiting nodes to the pieces they have
+// to transfer.
+func (s *Store) queueExit(pieces []*types.Piece) {
+	if len(s.exits) == 0 {
+		return
+	}
+
+	for _, piece := range pieces {
+		e, ok := s.exits[piece.NodeID]
+
+		if !ok || e.pending[piece.ID] != nil {
+			continue
+		}
+
+		e.pending[piece.ID] = &exitPiece{}
+		e.status.Pieces++
+		e.status.FinishedAt = time.Time{}
+	}
+}
+
+// finish ends the exit once no piece is left to transfer.
+func (e *exit) finish(now time.Time) {
+	if len(e.pending) == 0 && e.status.FinishedAt.IsZero() {
+		e.status.FinishedAt = now
+	}
+}
+
+func (s *Store) ExitStatus(id types.NodeID) (*types.ExitStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.exits[id]
+
+	if !ok {
+		return nil, types.ErrNodeNotExiting
+	}
+
+	status := e.status
+	return &status, nil
+}
+
+// exitSegment is a segment holding a piece of an exiting node.
+type exitSegment struct {
+	segment *types.Segment
+	piece   *types.Piece
+}
+
+// ExitTransfers hands out up to limit pieces of the exiting node, each with a
+// node to transfer it to. Targets are nodes that are not exiting, have room
+// for the piece and hold no other piece of its segment. Pieces that were
+// handed out before without a result get a new target, pieces that are no
+// longer referenced are dropped.
+func (s *Store) ExitTransfers(id types.NodeID, limit int, now time.Time) ([]*types.ExitTransfer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.exits[id]
+
+	if !ok {
+		return nil, types.ErrNodeNotExiting
+	}
+
+	segments := make(map[types.PieceID]exitSegment, len(e.pending))
+
+	for _, obj := range s.objects {
+		for _, segment := range obj.Segments {
+			for _, piece := range segment.Pieces {
+				if e.pending[piece.ID] != nil && piece.NodeID == id {
+					segments[piece.ID] = exitSegment{segment: segment, piece: piece}
+				}
+			}
+		}
+	}
+
+	// the pieces of deleted objects need no transfer
+	for pieceID := range e.pending {
+		if _, ok := segments[pieceID]; !ok {
+			delete(e.pending, pieceID)
+			e.status.Pieces--
+		}
+	}
+
+	e.finish(now)
+
+	var transfers []*types.ExitTransfer
+
+	for pieceID, p := range e.pending {
+		if len(transfers) == limit {
+			break
+		}
+
+		found := segments[pieceID]
+		target := s.exitTarget(found.segment, p.target)
+
+		if target == nil {
+			continue
+		}
+
+		p.target = target.ID
+
+		piece := *found.piece
+		piece.NodeID = target.ID
+		t := *target
+
+		transfers = append(transfers, &types.ExitTransfer{
+			Piece:     &piece,
+			Size:      found.segment.PieceSize(),
+			Target:    &t,
+			ExpiresAt: found.segment.ExpiresAt,
+		})
+	}
+
+	return transfers, nil
+}
+
+// exitTarget picks a random node to transfer a piece of the segment to, other
+// than the node it was last handed out to.
+func (s *Store) exitTarget(segment *types.Segment, previous types.NodeID) *types.Node {
+	used := make(map[types.NodeID]bool, len(segment.Pieces)+1)
+	used[previous] = true
+
+	for _, piece := range segment.Pieces {
+		used[piece.NodeID] = true
+	}
+
+	var candidates []*types.Node
+
+	for _, node := range s.nodes {
+		if !used[node.ID] && !node.Exiting && node.HasRoom(uint64(segment.PieceSize())) {
+			candidates = append(candidates, node)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	return candidates[rand.Intn(len(candidates))]
+}
+
+// ReportExit records the results of transfers the exiting node made. Pieces
+// whose target signed a receipt for them are moved to it in every segment,
+// failed ones are handed out again until they failed maxExitAttempts times.
+func (s *Store) ReportExit(id types.NodeID, results []*types.ExitResult, now time.Time) (*types.ExitStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.exits[id]
+
+	if !ok {
+		return nil, types.ErrNodeNotExiting
+	}
+
+	pieces := make(map[types.PieceID]*types.Piece, len(results))
+
+	for _, obj := range s.objects {
+		for _, segment := range obj.Segments {
+			for _, piece := range segment.Pieces {
+				if e.pending[piece.ID] != nil {
+					pieces[piece.ID] = piece
+				}
+			}
+		}
+	}
+
+	moved := make(map[types.PieceID]types.NodeID)
+
+	for _, result := range results {
+		p, ok := e.pending[result.PieceID]
+
+		// only pieces that were handed out can be reported
+		if !ok || p.target == (types.NodeID{}) {
+			continue
+		}
+
+		if result.Error == "" && s.validReceipt(result.Receipt, pieces[result.PieceID], p.target) {
+			moved[result.PieceID] = p.target
+			delete(e.pending, result.PieceID)
+			e.status.Transferred++
+			continue
+		}
+
+		p.target = types.NodeID{}
+		p.attempts++
+
+		if p.attempts >= maxExitAttempts {
+			delete(e.pending, result.PieceID)
+			e.status.Failed++
+		}
+	}
+
+	if len(moved) > 0 {
+		s.movePieces(moved)
+	}
+
+	e.finish(now)
+
+	status := e.status
+	return &status, nil
+}
+
+// validReceipt reports whether the receipt is for the piece as it is stored
+// and, if the target has an identity, signed by it.
+func (s *Store) validReceipt(receipt *types.PieceReceipt, piece *types.Piece, target types.NodeID) bool {
+	node, ok := s.nodes[target]
+
+	if !ok || receipt == nil || piece == nil || receipt.PieceID != piece.ID || !bytes.Equal(receipt.Hash, piece.Hash) {
+		return false
+	}
+
+	return len(node.PublicKey) == 0 || identity.VerifyReceipt(receipt, node.PublicKey) == nil
+}
+
+// movePieces points the segments holding the pieces to their new nodes.
+// Pieces are replaced rather than modified, they may be in use outside the
+// lock.
+func (s *Store) movePieces(moved map[types.PieceID]types.NodeID) {
+	move := func(segment *types.Segment) {
+		for i, piece := range segment.Pieces {
+			if target, ok := moved[piece.ID]; ok && piece.NodeID != target {
+				p := *piece
+				p.NodeID = target
+				segment.Pieces[i] = &p
+			}
+		}
+	}
+
+	for _, obj := range s.objects {
+		for _, segment := range obj.Segments {
+			move(segment)
+		}
+	}
+
+	// shared segments outlive the object that stored them first
+	for _, segment := range s.shared {
+		move(segment)
+	}
+}
+
+// ReportLostPieces records that the node lost the pieces. Only pieces a
+// segment holds on that node are recorded, it returns how many.
+func (s *Store) ReportLostPieces(id types.NodeID, pieces []types.PieceID) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.nodes[id]; !ok {
+		return 0, types.ErrNodeNotFound
+	}
+
+	reported := make(map[types.PieceID]bool, len(pieces))
+
+	for _, pieceID := range pieces {
+		reported[pieceID] = true
+	}
+
+	n := 0
+
+	for _, obj := range s.objects {
+		for _, segment := range obj.Segments {
+			for _, piece := range segment.Pieces {
+				if reported[piece.ID] && piece.NodeID == id && !s.lost[piece.ID] {
+					s.lost[piece.ID] = true
+					n++
+				}
+			}
+		}
+	}
+
+	return n, nil
+}
+
+// DegradedSegments returns the segments that lost pieces, those with the
+// fewest pieces left first. Segments shared by several objects are listed
+// once.
+func (s *Store) DegradedSegments() []*types.DegradedSegment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var degraded []*types.DegradedSegment
+
+	if len(s.lost) == 0 {
+		return degraded
+	}
+
+	seen := make(map[string]bool)
+
+	for _, obj := range s.objects {
+		for _, segment := range obj.Segments {
+			lost := 0
+
+			for _, piece := range segment.Pieces {
+				if s.lost[piece.ID] {
+					lost++
+				}
+			}
+
+			key := dataKey(segment)
+
+			if lost == 0 || seen[key] {
+				continue
+			}
+
+			seen[key] = true
+
+			degraded = append(degraded, &types.DegradedSegment{
+				ObjectName: obj.Name,
+				SegmentID:  segment.ID,
+				Position:   segment.Position,
+				Pieces:     len(segment.Pieces),
+				Lost:       lost,
+			})
+		}
+	}
+
+	sort.Slice(degraded, func(i, j int) bool {
+		a, b := degraded[i], degraded[j]
+
+		if a.Pieces-a.Lost != b.Pieces-b.Lost {
+			return a.Pieces-a.Lost < b.Pieces-b.Lost
+		}
+
+		return a.ObjectName < b.ObjectName || a.ObjectName == b.ObjectName && a.Position < b.Position
+	})
+
+	return degraded
+}
+
+// Settle accounts n bytes of traffic served for a verified order to the
+// rollup of its node and bucket on the day of now. It returns false if the
+// order was settled before.
+func (s *Store) Settle(o *orders.Order, n int64, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.settled[o.Serial]; ok {
+		return false
+	}
+
+	s.settled[o.Serial] = o.Expires.Add(orders.SettleWindow)
+
+	day := now.UTC().Truncate(24 * time.Hour)
+	key := rollupKey{node: o.NodeID, bucket: o.Bucket, day: day}
+
+	rollup, ok := s.bandwidth[key]
+
+	if !ok {
+		rollup = &types.BandwidthRollup{NodeID: o.NodeID, Bucket: o.Bucket, Day: day}
+		s.bandwidth[key] = rollup
+	}
+
+	switch o.Action {
+	case orders.ActionPut:
+		rollup.Ingress += n
+	case orders.ActionGet:
+		rollup.Egress += n
+	}
+
+	return true
+}
+
+// Bandwidth returns the rollups matching the request, ordered by day, node
+// and bucket.
+func (s *Store) Bandwidth(req *types.BandwidthRequest) []*types.BandwidthRollup {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rollups := []*types.BandwidthRollup{}
+
+	for _, rollup := range s.bandwidth {
+		if (req.NodeID != types.NodeID{} && rollup.NodeID != req.NodeID) ||
+			(req.Bucket != "" && rollup.Bucket != req.Bucket) ||
+			(!req.From.IsZero() && rollup.Day.Before(req.From)) ||
+			(!req.To.IsZero() && rollup.Day.After(req.To)) {
+			continue
+		}
+
+		c := *rollup
+		rollups = append(rollups, &c)
+	}
+
+	sort.Slice(rollups, func(i, j int) bool {
+		a, b := rollups[i], rollups[j]
+
+		if !a.Day.Equal(b.Day) {
+			return a.Day.Before(b.Day)
+		}
+
+		if a.NodeID != b.NodeID {
+			return a.NodeID.String() < b.NodeID.String()
+		}
+
+		return a.Bucket < b.Bucket
+	})
+
+	return rollups
+}
+
+// tally adds the object and its segments to the tally of its bucket, or
+// takes them off for sign -1.
+func (s *Store) tally(obj *types.Object, sign int64) {
+	bucket := types.BucketOf(obj.Name)
+
+	s.bucketTally(bucket).Objects += sign
+
+	for _, segment := range obj.Segments {
+		s.tallySegment(bucket, segment, sign)
+	}
+
+	s.pruneTally(bucket)
+}
+
+// storedSize is the number of bytes the object adds to the tally of its
+// bucket.
+func storedSize(obj *types.Object) int64 {
+	var size int64
+
+	for _, segment := range obj.Segments {
+		size += int64(segment.Size)
+	}
+
+	return size
+}
+
+func (s *Store) tallySegment(bucket string, segment *types.Segment, sign int64) {
+	tally := s.bucketTally(bucket)
+	tally.Segments += sign
+	tally.Bytes += sign * int64(segment.Size)
+}
+
+func (s *Store) bucketTally(bucket string) *types.StorageTally {
+	tally, ok := s.tallies[bucket]
+
+	if !ok {
+		tally = &types.StorageTally{Bucket: bucket}
+		s.tallies[bucket] = tally
+	}
+
+	return tally
+}
+
+// pruneTally drops the tally of a bucket that stores nothing any more.
+func (s *Store) pruneTally(bucket string) {
+	if tally, ok := s.tallies[bucket]; ok && *tally == (types.StorageTally{Bucket: bucket}) {
+		delete(s.tallies, bucket)
+	}
+}
+
+// StorageUsage returns the tallies of the bucket, or of all buckets storing
+// anything if bucket is empty, ordered by bucket.
+func (s *Store) StorageUsage(bucket string) []*types.StorageTally {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tallies := []*types.StorageTally{}
+
+	for name, tally := range s.tallies {
+		if bucket == "" || name == bucket {
+			c := *tally
+			tallies = append(tallies, &c)
+		}
+	}
+
+	sort.Slice(tallies, func(i, j int) bool {
+		return tallies[i].Bucket < tallies[j].Bucket
+	})
+
+	return tallies
+}
+
+// SetLimits gives the bucket limits of its own, replacing the default ones.
+func (s *Store) SetLimits(bucket string, limits types.Limits) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.limits[bucket] = limits
+}
+
+// Limits returns the limits that apply to the bucket.
+func (s *Store) Limits(bucket string) types.Limits {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.bucketLimits(bucket)
+}
+
+func (s *Store) bucketLimits(bucket string) types.Limits {
+	if limits, ok := s.limits[bucket]; ok {
+		return limits
+	}
+
+	return s.defaultLimits
+}
+
+// checkLimits fails if storing size more bytes in the bucket would take it
+// over its storage limit, or if it used up its bandwidth for the month.
+func (s *Store) checkLimits(bucket string, size int64) error {
+	limits := s.bucketLimits(bucket)
+
+	used := int64(0)
+
+	if tally, ok := s.tallies[bucket]; ok {
+		used = tally.Bytes
+	}
+
+	if limits.Storage > 0 && used+size > limits.Storage {
+		return fmt.Errorf("%w: bucket %s is out of storage", types.ErrLimitExceeded, bucket)
+	}
+
+	if limits.Bandwidth > 0 && s.monthlyBandwidth(bucket, time.Now()) >= limits.Bandwidth {
+		return fmt.Errorf("%w: bucket %s is out of bandwidth", types.ErrLimitExceeded, bucket)
+	}
+
+	return nil
+}
+
+// monthlyBandwidth returns the traffic settled for the bucket in the month of
+// now.
+func (s *Store) monthlyBandwidth(bucket string, now time.Time) int64 {
+	year, month, _ := now.UTC().Date()
+	total := int64(0)
+
+	for key, rollup := range s.bandwidth {
+		if key.bucket != bucket {
+			continue
+		}
+
+		if y, m, _ := key.day.Date(); y == year && m == month {
+			total += rollup.Ingress + rollup.Egress
+		}
+	}
+
+	return total
+}
+
+var bucketName = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+func (s *Store) CreateBucket(name string) (*types.Bucket, error) {
+	if !bucketName.MatchString(name) {
+		return nil, types.ErrInvalidBucketName
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.buckets[name]; ok {
+		return nil, types.ErrBucketExists
+	}
+
+	bucket := &types.Bucket{
+		Name:      name,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	s.buckets[name] = bucket
+
+	return bucket, nil
+}
+
+func (s *Store) GetBucket(name string) (*types.Bucket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket, ok := s.buckets[name]
+
+	if !ok {
+		return nil, types.ErrBucketNotFound
+	}
+
+	c := *bucket
+	return &c, nil
+}
+
+func (s *Store) ListBuckets() []*types.Bucket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buckets := make([]*types.Bucket, 0, len(s.buckets))
+
+	for _, bucket := range s.buckets {
+		c := *bucket
+		buckets = append(buckets, &c)
+	}
+
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Name < buckets[j].Name
+	})
+
+	return buckets
+}
+
+// RegisterShareKey stores an Ed25519 public key for verifying share links and
+// returns it with its new ID.
+func (s *Store) RegisterShareKey(publicKey []byte) (*types.ShareKey, error) {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return nil, types.ErrInvalidShareKey
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := &types.ShareKey{
+		ID:        uuid.NewString(),
+		PublicKey: publicKey,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	s.shareKeys[key.ID] = key
+
+	c := *key
+	return &c, nil
+}
+
+func (s *Store) GetShareKey(id string) (*types.ShareKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.shareKeys[id]
+
+	if !ok {
+		return nil, types.ErrShareKeyNotFound
+	}
+
+	c := *key
+	return &c, nil
+}
+
+// RevokeShareKey invalidates every link signed with the key.
+func (s *Store) RevokeShareKey(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.shareKeys[id]
+
+	if !ok {
+		return types.ErrShareKeyNotFound
+	}
+
+	key.Revoked = true
+
+	return nil
+}
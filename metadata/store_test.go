@@ -0,0 +1,912 @@
+package metadata_test
+
+import (
+	"dfs/metadata"
+	"dfs/orders"
+	"dfs/types"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newSegment(obj types.Object, contentKey []byte) *types.Segment {
+	segment := types.NewSegment(obj.ID, 11, 0)
+	segment.ContentKey = contentKey
+	segment.Pieces = []*types.Piece{
+		{ID: types.NewPieceID(), NodeID: types.NewNodeID()},
+		{ID: types.NewPieceID(), NodeID: types.NewNodeID(), Position: 1},
+	}
+	return &segment
+}
+
+func TestStore(t *testing.T) {
+	t.Run("can put, get and delete objects", func(t *testing.T) {
+		store := metadata.NewStore()
+		obj := types.NewObject("file.txt")
+
+		if err := store.PutObject(&obj); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := store.PutObject(&obj); !errors.Is(err, types.ErrObjectExists) {
+			t.Fatalf("expected %v, got %v", types.ErrObjectExists, err)
+		}
+
+		segment := newSegment(obj, nil)
+
+		if _, err := store.CreateSegment(segment); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		got, err := store.GetObject("file.txt")
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(got.Segments) != 1 {
+			t.Fatalf("expected 1 segment, got %d", len(got.Segments))
+		}
+
+		freed, err := store.DeleteObject("file.txt")
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(freed) != 2 {
+			t.Fatalf("expected 2 freed pieces, got %d", len(freed))
+		}
+
+		if _, err := store.GetObject("file.txt"); !errors.Is(err, types.ErrObjectNotFound) {
+			t.Fatalf("expected %v, got %v", types.ErrObjectNotFound, err)
+		}
+	})
+
+	t.Run("shares segments with the same content key", func(t *testing.T) {
+		store := metadata.NewStore()
+		key := []byte("content key")
+
+		first := types.NewObject("builds/first")
+		second := types.NewObject("builds/second")
+
+		for _, obj := range []*types.Object{&first, &second} {
+			if err := store.PutObject(obj); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		if _, err := store.LookupSegment("builds", key); !errors.Is(err, types.ErrSegmentNotFound) {
+			t.Fatalf("expected %v, got %v", types.ErrSegmentNotFound, err)
+		}
+
+		original, err := store.CreateSegment(newSegment(first, key))
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		found, err := store.LookupSegment("builds", key)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if found.Pieces[0].ID != original.Pieces[0].ID {
+			t.Fatalf("expected looked up segment to reference the original pieces")
+		}
+
+		shared, err := store.CreateSegment(newSegment(second, key))
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if shared.Pieces[0].ID != original.Pieces[0].ID {
+			t.Fatalf("expected shared segment to reference the original pieces")
+		}
+
+		freed, err := store.DeleteObject("builds/first")
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(freed) != 0 {
+			t.Fatalf("expected no freed pieces while still referenced, got %d", len(freed))
+		}
+
+		freed, err = store.DeleteObject("builds/second")
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(freed) != 2 {
+			t.Fatalf("expected 2 freed pieces, got %d", len(freed))
+		}
+
+		if _, err := store.LookupSegment("builds", key); !errors.Is(err, types.ErrSegmentNotFound) {
+			t.Fatalf("expected %v, got %v", types.ErrSegmentNotFound, err)
+		}
+	})
+
+	t.Run("only shares segments within a bucket", func(t *testing.T) {
+		store := metadata.NewStore()
+		key := []byte("content key")
+
+		first := types.NewObject("builds/first")
+		other := types.NewObject("other/first")
+
+		for _, obj := range []*types.Object{&first, &other} {
+			if err := store.PutObject(obj); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		original, err := store.CreateSegment(newSegment(first, key))
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := store.LookupSegment("other", key); !errors.Is(err, types.ErrSegmentNotFound) {
+			t.Fatalf("expected %v, got %v", types.ErrSegmentNotFound, err)
+		}
+
+		separate, err := store.CreateSegment(newSegment(other, key))
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if separate.Pieces[0].ID == original.Pieces[0].ID {
+			t.Fatalf("expected the segment of another bucket to keep its own pieces")
+		}
+
+		if freed, err := store.DeleteObject("builds/first"); err != nil || len(freed) != 2 {
+			t.Fatalf("expected 2 freed pieces, got %d, %v", len(freed), err)
+		}
+
+		if _, err := store.LookupSegment("other", key); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestCopyAndMove(t *testing.T) {
+	t.Run("copies share pieces until the last reference is deleted", func(t *testing.T) {
+		store := metadata.NewStore()
+		obj := types.NewObject("original")
+
+		if err := store.PutObject(&obj); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := store.CreateSegment(newSegment(obj, nil)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		cp, err := store.CopyObject("original", "copy")
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if cp.ID == obj.ID || cp.Name != "copy" || len(cp.Segments) != 1 {
+			t.Fatalf("expected a new object named copy with one segment, got %+v", cp)
+		}
+
+		if _, err := store.CopyObject("original", "copy"); !errors.Is(err, types.ErrObjectExists) {
+			t.Fatalf("expected %v, got %v", types.ErrObjectExists, err)
+		}
+
+		freed, err := store.DeleteObject("original")
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(freed) != 0 {
+			t.Fatalf("expected no freed pieces while the copy exists, got %d", len(freed))
+		}
+
+		if _, err := store.MoveObject("copy", "moved"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := store.GetObject("copy"); !errors.Is(err, types.ErrObjectNotFound) {
+			t.Fatalf("expected %v, got %v", types.ErrObjectNotFound, err)
+		}
+
+		freed, err = store.DeleteObject("moved")
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(freed) != 2 {
+			t.Fatalf("expected 2 freed pieces, got %d", len(freed))
+		}
+	})
+
+	t.Run("does not replace an object with itself", func(t *testing.T) {
+		store := metadata.NewStore()
+		obj := types.NewObject("photos/cat.jpg")
+
+		if err := store.PutObject(&obj); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := store.CreateSegment(newSegment(obj, nil)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, _, err := store.ReplaceObject("photos/cat.jpg", "photos/cat.jpg"); !errors.Is(err, types.ErrSameObject) {
+			t.Fatalf("expected %v, got %v", types.ErrSameObject, err)
+		}
+
+		got, err := store.GetObject("photos/cat.jpg")
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if got.ID != obj.ID || len(got.Segments) != 1 {
+			t.Fatalf("expected the object to keep its segment, got %+v", got)
+		}
+
+		freed, err := store.DeleteObject("photos/cat.jpg")
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(freed) != 2 {
+			t.Fatalf("expected 2 freed pieces, got %d", len(freed))
+		}
+	})
+}
+
+func TestUpdate(t *testing.T) {
+	t.Run("updates metadata without touching segments", func(t *testing.T) {
+		store := metadata.NewStore()
+		obj := types.NewObject("file")
+		obj.ContentType = "text/plain"
+		obj.Metadata = map[string]string{"color": "blue"}
+
+		if err := store.PutObject(&obj); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := store.CreateSegment(newSegment(obj, nil)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		stored, err := store.GetObject("file")
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if stored.CreatedAt.IsZero() || !stored.ModifiedAt.Equal(stored.CreatedAt) {
+			t.Fatalf("expected creation timestamps, got %v and %v", stored.CreatedAt, stored.ModifiedAt)
+		}
+
+		contentType := "text/markdown"
+
+		updated, err := store.UpdateObject(&types.UpdateObjectRequest{Name: "file", ContentType: &contentType})
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if updated.ContentType != contentType || updated.Metadata["color"] != "blue" || len(updated.Segments) != 1 {
+			t.Fatalf("expected only the content type to change, got %+v", updated)
+		}
+
+		if updated.ModifiedAt.Before(stored.ModifiedAt) || !updated.CreatedAt.Equal(stored.CreatedAt) {
+			t.Fatalf("expected only the modification time to change, got %v and %v", updated.CreatedAt, updated.ModifiedAt)
+		}
+
+		updated, err = store.UpdateObject(&types.UpdateObjectRequest{Name: "file", Metadata: map[string]string{}})
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(updated.Metadata) != 0 || updated.ContentType != contentType {
+			t.Fatalf("expected the metadata to be cleared, got %+v", updated)
+		}
+
+		if _, err := store.UpdateObject(&types.UpdateObjectRequest{Name: "missing"}); !errors.Is(err, types.ErrObjectNotFound) {
+			t.Fatalf("expected %v, got %v", types.ErrObjectNotFound, err)
+		}
+	})
+}
+
+func TestCompose(t *testing.T) {
+	t.Run("composes objects from the segments of others", func(t *testing.T) {
+		store := metadata.NewStore()
+
+		for _, name := range []string{"part1", "part2"} {
+			obj := types.NewObject(name)
+
+			if err := store.PutObject(&obj); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if _, err := store.CreateSegment(newSegment(obj, nil)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		obj, err := store.ComposeObject("whole", []string{"part1", "part2"})
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if obj.Size != 22 || len(obj.Segments) != 2 || obj.Segments[1].Position != 1 {
+			t.Fatalf("expected 22 bytes in 2 ordered segments, got %+v", obj)
+		}
+
+		if _, err := store.ComposeObject("other", []string{"part1", "missing"}); !errors.Is(err, types.ErrObjectNotFound) {
+			t.Fatalf("expected %v, got %v", types.ErrObjectNotFound, err)
+		}
+
+		for _, name := range []string{"part1", "part2"} {
+			freed, err := store.DeleteObject(name)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(freed) != 0 {
+				t.Fatalf("expected no freed pieces while the composed object exists, got %d", len(freed))
+			}
+		}
+	})
+}
+
+func TestBuckets(t *testing.T) {
+	t.Run("can create, get and list buckets", func(t *testing.T) {
+		store := metadata.NewStore()
+
+		if _, err := store.CreateBucket("photos"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := store.CreateBucket("photos"); !errors.Is(err, types.ErrBucketExists) {
+			t.Fatalf("expected %v, got %v", types.ErrBucketExists, err)
+		}
+
+		if _, err := store.CreateBucket("Not_Valid"); !errors.Is(err, types.ErrInvalidBucketName) {
+			t.Fatalf("expected %v, got %v", types.ErrInvalidBucketName, err)
+		}
+
+		if _, err := store.GetBucket("missing"); !errors.Is(err, types.ErrBucketNotFound) {
+			t.Fatalf("expected %v, got %v", types.ErrBucketNotFound, err)
+		}
+
+		if buckets := store.ListBuckets(); len(buckets) != 1 || buckets[0].Name != "photos" {
+			t.Fatalf("expected the photos bucket, got %+v", buckets)
+		}
+	})
+}
+
+func TestNodes(t *testing.T) {
+	t.Run("records the capacity nodes report", func(t *testing.T) {
+		store := metadata.NewStore()
+		node := &types.Node{ID: types.NewNodeID(), HttpAddr: "http://node1"}
+
+		if err := store.RegisterNode(node); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := store.ReportCapacity(node.ID, 1000, 250); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		nodes := store.ListNodes()
+
+		if len(nodes) != 1 || nodes[0].Capacity != 1000 || nodes[0].Free != 250 {
+			t.Fatalf("expected the reported capacity, got %+v", nodes)
+		}
+
+		if err := store.ReportCapacity(types.NewNodeID(), 1000, 250); !errors.Is(err, types.ErrNodeNotFound) {
+			t.Fatalf("expected %v, got %v", types.ErrNodeNotFound, err)
+		}
+	})
+
+	t.Run("keeps the key a node registered with", func(t *testing.T) {
+		store := metadata.NewStore()
+		node := &types.Node{ID: types.NewNodeID(), HttpAddr: "http://node1", PublicKey: []byte("key one")}
+
+		if err := store.RegisterNode(node); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		node.HttpAddr = "http://node2"
+
+		if err := store.RegisterNode(node); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		node.PublicKey = []byte("key two")
+
+		if err := store.RegisterNode(node); !errors.Is(err, types.ErrNodeKeyMismatch) {
+			t.Fatalf("expected %v, got %v", types.ErrNodeKeyMismatch, err)
+		}
+
+		registered, err := store.GetNode(node.ID)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if registered.HttpAddr != "http://node2" || string(registered.PublicKey) != "key one" {
+			t.Fatalf("expected the first key with the new address, got %+v", registered)
+		}
+	})
+}
+
+func TestBandwidth(t *testing.T) {
+	t.Run("rolls up settled orders per node, bucket and day", func(t *testing.T) {
+		store := metadata.NewStore()
+		nodeID := types.NewNodeID()
+		now := time.Date(2024, 3, 1, 15, 30, 0, 0, time.UTC)
+
+		settle := func(bucket string, action orders.Action, n int64, now time.Time) *orders.Order {
+			o := &orders.Order{
+				Serial:  orders.NewSerial(),
+				Bucket:  bucket,
+				PieceID: types.NewPieceID(),
+				NodeID:  nodeID,
+				Action:  action,
+				Expires: now,
+			}
+
+			if !store.Settle(o, n, now) {
+				t.Fatalf("expected order to be settled")
+			}
+
+			return o
+		}
+
+		o := settle("photos", orders.ActionPut, 100, now)
+		settle("photos", orders.ActionGet, 40, now)
+		settle("photos", orders.ActionGet, 60, now.Add(time.Hour))
+		settle("backups", orders.ActionPut, 500, now)
+		settle("photos", orders.ActionGet, 7, now.Add(24*time.Hour))
+
+		if store.Settle(o, 100, now) {
+			t.Fatalf("expected an order to be settled only once")
+		}
+
+		rollups := store.Bandwidth(&types.BandwidthRequest{Bucket: "photos", To: now.Truncate(24 * time.Hour)})
+
+		if len(rollups) != 1 {
+			t.Fatalf("expected 1 rollup, got %d", len(rollups))
+		}
+
+		if rollups[0].Ingress != 100 || rollups[0].Egress != 100 || rollups[0].NodeID != nodeID {
+			t.Fatalf("expected 100 bytes in and out, got %+v", rollups[0])
+		}
+
+		if rollups := store.Bandwidth(&types.BandwidthRequest{}); len(rollups) != 3 {
+			t.Fatalf("expected 3 rollups, got %d", len(rollups))
+		}
+
+		if rollups := store.Bandwidth(&types.BandwidthRequest{NodeID: types.NewNodeID()}); len(rollups) != 0 {
+			t.Fatalf("expected no rollups for another node, got %d", len(rollups))
+		}
+	})
+}
+
+func TestExpiration(t *testing.T) {
+	t.Run("hides and purges expired objects", func(t *testing.T) {
+		store := metadata.NewStore()
+
+		expired := types.NewObject("cache/old")
+		expired.ExpiresAt = time.Now().Add(-time.Minute)
+
+		live := types.NewObject("cache/new")
+		live.ExpiresAt = time.Now().Add(time.Hour)
+
+		for _, obj := range []*types.Object{&expired, &live} {
+			if err := store.PutObject(obj); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		if _, err := store.GetObject("cache/old"); !errors.Is(err, types.ErrObjectNotFound) {
+			t.Fatalf("expected %v, got %v", types.ErrObjectNotFound, err)
+		}
+
+		if objs := store.ListObjects("cache/"); len(objs) != 1 || objs[0].Name != "cache/new" {
+			t.Fatalf("expected only the live object to be listed, got %+v", objs)
+		}
+
+		if n := store.PurgeExpired(time.Now().Add(2 * time.Hour)); n != 1 {
+			t.Fatalf("expected 1 object to be purged, got %d", n)
+		}
+
+		// the name of an expired object is free again
+		if err := store.PutObject(&expired); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("copies and composed objects expire with their sources", func(t *testing.T) {
+		store := metadata.NewStore()
+		expiresAt := time.Now().Add(time.Hour)
+
+		temp := types.NewObject("temp")
+		temp.ExpiresAt = expiresAt
+		kept := types.NewObject("kept")
+
+		for _, obj := range []*types.Object{&temp, &kept} {
+			if err := store.PutObject(obj); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		cp, err := store.CopyObject("temp", "copy")
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		composed, err := store.ComposeObject("composed", []string{"kept", "temp"})
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !cp.ExpiresAt.Equal(expiresAt) || !composed.ExpiresAt.Equal(expiresAt) {
+			t.Fatalf("expected both to expire at %v, got %v and %v", expiresAt, cp.ExpiresAt, composed.ExpiresAt)
+		}
+	})
+}
+
+func TestStorageUsage(t *testing.T) {
+	t.Run("tallies objects, segments and bytes per bucket", func(t *testing.T) {
+		store := metadata.NewStore()
+
+		obj := types.NewObject("photos/cat.jpg")
+
+		if err := store.PutObject(&obj); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := store.CreateSegment(newSegment(obj, nil)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := store.CopyObject("photos/cat.jpg", "photos/copy.jpg"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := store.MoveObject("photos/copy.jpg", "backups/cat.jpg"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		tallies := store.StorageUsage("")
+
+		if len(tallies) != 2 {
+			t.Fatalf("expected 2 tallies, got %d", len(tallies))
+		}
+
+		want := types.StorageTally{Bucket: "backups", Objects: 1, Segments: 1, Bytes: 11}
+
+		if *tallies[0] != want {
+			t.Fatalf("expected %+v, got %+v", want, tallies[0])
+		}
+
+		if _, err := store.DeleteObject("photos/cat.jpg"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if tallies := store.StorageUsage("photos"); len(tallies) != 0 {
+			t.Fatalf("expected the tally of an empty bucket to be dropped, got %+v", tallies[0])
+		}
+	})
+
+	t.Run("rejects writes to buckets over their limits", func(t *testing.T) {
+		store := metadata.NewStore(metadata.WithDefaultLimits(types.Limits{Storage: 20}))
+
+		obj := types.NewObject("photos/cat.jpg")
+
+		if err := store.PutObject(&obj); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := store.CreateSegment(newSegment(obj, nil)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := store.CreateSegment(newSegment(obj, nil)); !errors.Is(err, types.ErrLimitExceeded) {
+			t.Fatalf("expected %v, got %v", types.ErrLimitExceeded, err)
+		}
+
+		large := types.NewObject("photos/large.jpg")
+		large.Size = 100
+
+		if err := store.PutObject(&large); !errors.Is(err, types.ErrLimitExceeded) {
+			t.Fatalf("expected %v, got %v", types.ErrLimitExceeded, err)
+		}
+
+		// buckets with limits of their own are not held to the default ones
+		store.SetLimits("videos", types.Limits{Bandwidth: 50})
+		large.Name = "videos/large.mp4"
+
+		if err := store.PutObject(&large); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		store.Settle(&orders.Order{
+			Serial:  orders.NewSerial(),
+			Bucket:  "videos",
+			NodeID:  types.NewNodeID(),
+			Action:  orders.ActionGet,
+			Expires: time.Now(),
+		}, 50, time.Now())
+
+		next := types.NewObject("videos/next.mp4")
+
+		if err := store.PutObject(&next); !errors.Is(err, types.ErrLimitExceeded) {
+			t.Fatalf("expected %v, got %v", types.ErrLimitExceeded, err)
+		}
+	})
+
+	t.Run("rejects copies, compositions and moves into buckets over their limits", func(t *testing.T) {
+		store := metadata.NewStore()
+		store.SetLimits("full", types.Limits{Storage: 10})
+
+		obj := types.NewObject("photos/cat.jpg")
+
+		if err := store.PutObject(&obj); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := store.CreateSegment(newSegment(obj, nil)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := store.CopyObject("photos/cat.jpg", "full/cat.jpg"); !errors.Is(err, types.ErrLimitExceeded) {
+			t.Fatalf("expected %v, got %v", types.ErrLimitExceeded, err)
+		}
+
+		if _, err := store.ComposeObject("full/cat.jpg", []string{"photos/cat.jpg"}); !errors.Is(err, types.ErrLimitExceeded) {
+			t.Fatalf("expected %v, got %v", types.ErrLimitExceeded, err)
+		}
+
+		if _, err := store.MoveObject("photos/cat.jpg", "full/cat.jpg"); !errors.Is(err, types.ErrLimitExceeded) {
+			t.Fatalf("expected %v, got %v", types.ErrLimitExceeded, err)
+		}
+
+		if _, _, err := store.ReplaceObject("photos/cat.jpg", "full/cat.jpg"); !errors.Is(err, types.ErrLimitExceeded) {
+			t.Fatalf("expected %v, got %v", types.ErrLimitExceeded, err)
+		}
+
+		if tallies := store.StorageUsage("full"); len(tallies) != 0 {
+			t.Fatalf("expected nothing stored in the full bucket, got %+v", tallies[0])
+		}
+
+		// moves within a bucket don't add to it
+		if _, err := store.MoveObject("photos/cat.jpg", "photos/kitten.jpg"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestExit(t *testing.T) {
+	setup := func(t *testing.T) (*metadata.Store, *types.Node, *types.Segment) {
+		store := metadata.NewStore()
+
+		obj := types.NewObject("photos/cat.jpg")
+
+		if err := store.PutObject(&obj); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		segment := newSegment(obj, nil)
+		segment.Pieces[0].Hash = []byte("piece hash")
+
+		for i := 0; i < 4; i++ {
+			node := &types.Node{ID: types.NewNodeID(), HttpAddr: "http://node"}
+
+			if i < len(segment.Pieces) {
+				node.ID = segment.Pieces[i].NodeID
+			}
+
+			if err := store.RegisterNode(node); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		if _, err := store.CreateSegment(segment); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := store.CopyObject("photos/cat.jpg", "photos/copy.jpg"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		exiting, err := store.GetNode(segment.Pieces[0].NodeID)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		status, err := store.StartExit(exiting.ID, time.Now())
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if status.Pieces != 1 || !status.FinishedAt.IsZero() {
+			t.Fatalf("expected 1 piece to transfer, got %+v", status)
+		}
+
+		return store, exiting, segment
+	}
+
+	transfer := func(t *testing.T, store *metadata.Store, exiting *types.Node, segment *types.Segment) *types.ExitTransfer {
+		transfers, err := store.ExitTransfers(exiting.ID, 10, time.Now())
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(transfers) != 1 {
+			t.Fatalf("expected 1 transfer, got %d", len(transfers))
+		}
+
+		target := transfers[0].Target.ID
+
+		if target == exiting.ID || target == segment.Pieces[1].NodeID {
+			t.Fatalf("expected a node without a piece of the segment, got %s", target)
+		}
+
+		return transfers[0]
+	}
+
+	t.Run("moves transferred pieces to their new node", func(t *testing.T) {
+		store, exiting, segment := setup(t)
+
+		// exiting nodes stay exiting when they register again
+		if err := store.RegisterNode(exiting); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if node, _ := store.GetNode(exiting.ID); !node.Exiting {
+			t.Fatalf("expected the node to be exiting")
+		}
+
+		// receipts for other data don't count
+		tr := transfer(t, store, exiting, segment)
+		receipt := &types.PieceReceipt{PieceID: tr.Piece.ID, Hash: []byte("other hash")}
+
+		status, err := store.ReportExit(exiting.ID, []*types.ExitResult{{PieceID: tr.Piece.ID, Receipt: receipt}}, time.Now())
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if status.Transferred != 0 || status.Failed != 0 {
+			t.Fatalf("expected the piece to be handed out again, got %+v", status)
+		}
+
+		tr = transfer(t, store, exiting, segment)
+		receipt = &types.PieceReceipt{PieceID: tr.Piece.ID, Hash: tr.Piece.Hash}
+
+		status, err = store.ReportExit(exiting.ID, []*types.ExitResult{{PieceID: tr.Piece.ID, Receipt: receipt}}, time.Now())
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if status.Transferred != 1 || status.FinishedAt.IsZero() {
+			t.Fatalf("expected the exit to be finished, got %+v", status)
+		}
+
+		for _, name := range []string{"photos/cat.jpg", "photos/copy.jpg"} {
+			obj, err := store.GetObject(name)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := obj.Segments[0].Pieces[0].NodeID; got != tr.Target.ID {
+				t.Fatalf("expected the piece of %s on %s, got %s", name, tr.Target.ID, got)
+			}
+		}
+	})
+
+	t.Run("gives up on pieces that keep failing", func(t *testing.T) {
+		store, exiting, segment := setup(t)
+
+		var status *types.ExitStatus
+
+		for i := 0; i < 3; i++ {
+			tr := transfer(t, store, exiting, segment)
+
+			var err error
+			status, err = store.ReportExit(exiting.ID, []*types.ExitResult{{PieceID: tr.Piece.ID, Error: "node is full"}}, time.Now())
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		if status.Failed != 1 || status.FinishedAt.IsZero() {
+			t.Fatalf("expected the piece to fail, got %+v", status)
+		}
+
+		if _, err := store.ExitStatus(types.NewNodeID()); !errors.Is(err, types.ErrNodeNotExiting) {
+			t.Fatalf("expected %v, got %v", types.ErrNodeNotExiting, err)
+		}
+	})
+}
+
+func TestLostPieces(t *testing.T) {
+	t.Run("lists segments with lost pieces for repair", func(t *testing.T) {
+		store := metadata.NewStore()
+
+		obj := types.NewObject("photos/cat.jpg")
+
+		if err := store.PutObject(&obj); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		segment := newSegment(obj, nil)
+		node := &types.Node{ID: segment.Pieces[0].NodeID, HttpAddr: "http://node"}
+
+		if err := store.RegisterNode(node); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := store.CreateSegment(segment); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := store.CopyObject("photos/cat.jpg", "photos/copy.jpg"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// nodes can only report the pieces they hold
+		n, err := store.ReportLostPieces(node.ID, []types.PieceID{segment.Pieces[0].ID, segment.Pieces[1].ID})
+
+		if err != nil || n != 1 {
+			t.Fatalf("expected 1 lost piece, got %d, %v", n, err)
+		}
+
+		degraded := store.DegradedSegments()
+
+		if len(degraded) != 1 || degraded[0].Lost != 1 || degraded[0].Pieces != 2 {
+			t.Fatalf("expected the segment to be listed once, got %+v", degraded)
+		}
+
+		if _, err := store.DeleteObject("photos/cat.jpg"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if degraded := store.DegradedSegments(); len(degraded) != 1 || degraded[0].ObjectName != "photos/copy.jpg" {
+			t.Fatalf("expected the copy to still need repair, got %+v", degraded)
+		}
+
+		if _, err := store.DeleteObject("photos/copy.jpg"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if degraded := store.DegradedSegments(); len(degraded) != 0 {
+			t.Fatalf("expected no segment to repair, got %+v", degraded)
+		}
+
+		if _, err := store.ReportLostPieces(types.NewNodeID(), nil); !errors.Is(err, types.ErrNodeNotFound) {
+			t.Fatalf("expected %v, got %v", types.ErrNodeNotFound, err)
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package network_test
+
+import (
+	"bytes"
+	"dfs/client/api"
+	"dfs/compression"
+	"dfs/metadata"
+	"dfs/network"
+	"dfs/types"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCompressedWrites(t *testing.T) {
+	t.Run("compressed objects read back transparently", func(t *testing.T) {
+		ts := httptest.NewServer(metadata.NewServer().Handler())
+		defer ts.Close()
+
+		client := api.NewClient(ts.URL, "test")
+
+		nn := network.NewNetwork(
+			network.WithUnsignedReceipts(),
+			network.WithApiClient(client),
+			network.WithNodes(newTestNodes(80)),
+			network.WithTransport(network.NewMemoryTransport()),
+		)
+
+		data := bytes.Repeat([]byte(`{"level":"info","msg":"hello"}`+"\n"), 5000)
+
+		obj := types.NewObject("app.log")
+		obj.Size = uint64(len(data))
+		obj.Compression = compression.Zstd
+
+		segment := types.NewSegment(obj.ID, obj.Size, 0)
+		obj.Segments = []*types.Segment{&segment}
+
+		if err := client.PutObject(&obj); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := nn.WriteObject(&obj, bytes.NewReader(data), nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		stored, err := client.GetObject("app.log")
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if stored.Size != uint64(len(data)) {
+			t.Fatalf("expected logical size %d, got %d", len(data), stored.Size)
+		}
+
+		if seg := stored.Segments[0]; seg.Compression != compression.Zstd || seg.EncodedSize >= seg.Size {
+			t.Fatalf("expected segment to be stored compressed, got %q with %d bytes", seg.Compression, seg.EncodedSize)
+		}
+
+		var buf bytes.Buffer
+
+		if err := nn.ReadObject(stored, &buf, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !bytes.Equal(buf.Bytes(), data) {
+			t.Fatalf("expected data to be equal")
+		}
+	})
+}
@@ -0,0 +1,174 @@
+package network_test
+
+import (
+	"bytes"
+	"context"
+	"dfs/client/api"
+	"dfs/hashutil"
+	"dfs/metadata"
+	"dfs/network"
+	"dfs/types"
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestNodes(n int) []*types.Node {
+	nodes := make([]*types.Node, n)
+
+	for i := range nodes {
+		nodes[i] = &types.Node{ID: types.NewNodeID()}
+	}
+
+	return nodes
+}
+
+func TestConvergentWrites(t *testing.T) {
+	t.Run("identical segments are stored once", func(t *testing.T) {
+		ts := httptest.NewServer(metadata.NewServer().Handler())
+		defer ts.Close()
+
+		client := api.NewClient(ts.URL, "test")
+		tr := network.NewMemoryTransport()
+		nodes := newTestNodes(80)
+
+		nn := network.NewNetwork(
+			network.WithUnsignedReceipts(),
+			network.WithApiClient(client),
+			network.WithNodes(nodes),
+			network.WithTransport(tr),
+			network.WithConvergenceKey(bytes.Repeat([]byte{7}, 32)),
+		)
+
+		data := []byte("the same build artifact")
+
+		var segments []*types.Segment
+
+		for _, name := range []string{"builds/1", "builds/2"} {
+			obj := types.NewObject(name)
+
+			if err := client.PutObject(&obj); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			segment := types.NewSegment(obj.ID, uint64(len(data)), 0)
+
+			if err := nn.WriteSegment(&segment, bytes.NewReader(data), nil); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			segments = append(segments, &segment)
+		}
+
+		if !bytes.Equal(segments[0].ContentKey, segments[1].ContentKey) {
+			t.Fatalf("expected equal content keys")
+		}
+
+		if segments[0].Pieces[0].ID != segments[1].Pieces[0].ID {
+			t.Fatalf("expected second segment to reference the pieces of the first")
+		}
+
+		if err := nn.DeleteObject("builds/1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var buf bytes.Buffer
+
+		if err := nn.ReadSegment(segments[1], &buf, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !bytes.Equal(buf.Bytes(), data) {
+			t.Fatalf("expected %s, got %s", data, buf.Bytes())
+		}
+
+		if err := nn.DeleteObject("builds/2"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		piece := segments[1].Pieces[0]
+		node, _ := nn.GetNode(piece.NodeID)
+
+		if _, err := tr.Stat(context.Background(), node, piece.ID); !errors.Is(err, types.ErrPieceNotFound) {
+			t.Fatalf("expected pieces to be deleted, got %v", err)
+		}
+	})
+
+	t.Run("segments that don't hold the data are not shared", func(t *testing.T) {
+		ts := httptest.NewServer(metadata.NewServer().Handler())
+		defer ts.Close()
+
+		client := api.NewClient(ts.URL, "test")
+		tr := network.NewMemoryTransport()
+		nodes := newTestNodes(80)
+		key := bytes.Repeat([]byte{7}, 32)
+
+		nn := network.NewNetwork(
+			network.WithUnsignedReceipts(),
+			network.WithApiClient(client),
+			network.WithNodes(nodes),
+			network.WithTransport(tr),
+			network.WithConvergenceKey(key),
+		)
+
+		data := []byte("the same build artifact")
+		poison := []byte("a poisoned build output")
+
+		writeSegment := func(nn *network.Network, name string, data []byte) *types.Segment {
+			obj := types.NewObject(name)
+
+			if err := client.PutObject(&obj); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			segment := types.NewSegment(obj.ID, uint64(len(data)), 0)
+
+			if err := nn.WriteSegment(&segment, bytes.NewReader(data), nil); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			return &segment
+		}
+
+		// someone stores other data under the key the data will have
+		plain := network.NewNetwork(network.WithApiClient(client), network.WithNodes(nodes), network.WithTransport(tr), network.WithUnsignedReceipts())
+		poisoned := writeSegment(plain, "builds/poison", poison)
+
+		contentKey, err := hashutil.KeyedBlake3(key, data)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		obj := types.NewObject("builds/poison-2")
+
+		if err := client.PutObject(&obj); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		claim := *poisoned
+		claim.ID = types.NewSegmentID()
+		claim.ObjectID = obj.ID
+		claim.ContentKey = contentKey
+
+		if err := client.CreateSegment(&claim); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		segment := writeSegment(nn, "builds/1", data)
+
+		if segment.Pieces[0].ID == poisoned.Pieces[0].ID {
+			t.Fatalf("expected the segment not to reference the poisoned pieces")
+		}
+
+		var buf bytes.Buffer
+
+		if err := nn.ReadSegment(segment, &buf, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !bytes.Equal(buf.Bytes(), data) {
+			t.Fatalf("expected %s, got %s", data, buf.Bytes())
+		}
+	})
+}
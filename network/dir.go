@@ -0,0 +1,96 @@
+package network
+
+import (
+	"context"
+	"dfs/hashutil"
+	"dfs/types"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DirTransport stores pieces in a local directory, one sub directory per
+// node. It is useful to run a whole network on a single machine.
+type DirTransport struct {
+	dir string
+}
+
+func NewDirTransport(dir string) *DirTransport {
+	return &DirTransport{dir: dir}
+}
+
+func (t *DirTransport) path(node *types.Node, id types.PieceID) string {
+	return filepath.Join(t.dir, node.ID.String(), id.String())
+}
+
+func notFound(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return types.ErrPieceNotFound
+	}
+
+	return err
+}
+
+// Put stores the piece. The directory has no node to delete expired pieces,
+// so expiresAt is ignored, or to sign the receipt.
+func (t *DirTransport) Put(ctx context.Context, node *types.Node, id types.PieceID, data []byte, expiresAt time.Time) (*types.PieceReceipt, error) {
+	path := t.path(node, id)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return nil, err
+	}
+
+	return &types.PieceReceipt{PieceID: id, Hash: hashutil.Blake3(data), Size: int64(len(data))}, nil
+}
+
+func (t *DirTransport) Get(ctx context.Context, node *types.Node, id types.PieceID) ([]byte, error) {
+	data, err := os.ReadFile(t.path(node, id))
+
+	return data, notFound(err)
+}
+
+func (t *DirTransport) GetRange(ctx context.Context, node *types.Node, id types.PieceID, offset, length int64) ([]byte, error) {
+	f, err := os.Open(t.path(node, id))
+
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	defer f.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var r io.Reader = f
+	if length > 0 {
+		r = io.LimitReader(f, length)
+	}
+
+	return io.ReadAll(r)
+}
+
+func (t *DirTransport) Delete(ctx context.Context, node *types.Node, id types.PieceID) error {
+	return notFound(os.Remove(t.path(node, id)))
+}
+
+func (t *DirTransport) Stat(ctx context.Context, node *types.Node, id types.PieceID) (*types.PieceInfo, error) {
+	fi, err := os.Stat(t.path(node, id))
+
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	return &types.PieceInfo{
+		ID:        id,
+		Size:      fi.Size(),
+		CreatedAt: fi.ModTime(),
+	}, nil
+}
@@ -0,0 +1,99 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"dfs/hashutil"
+	"dfs/types"
+)
+
+// exitBatch is the number of transfers asked for at once during an exit.
+const exitBatch = 100
+
+// Exit runs the graceful exit of the storage node with the given ID. It
+// announces the exit to the metadata server and transfers the pieces it is
+// handed, reading them with read, until none are left. progress, if not nil,
+// is called with the status after every batch.
+//
+// Pieces that can't be transferred are reported as failed and handed out
+// again, the metadata server gives up on them after a few attempts.
+func (nn *Network) Exit(id types.NodeID, read func(types.PieceID) ([]byte, error), progress func(*types.ExitStatus)) (*types.ExitStatus, error) {
+	status, err := nn.api.StartExit(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for status.FinishedAt.IsZero() {
+		transfers, err := nn.api.ExitTransfers(id, exitBatch)
+
+		if err != nil {
+			return status, err
+		}
+
+		// pieces were left but there is nowhere to transfer them
+		if len(transfers) == 0 {
+			status, err = nn.api.ExitStatus(id)
+
+			if err == nil && status.FinishedAt.IsZero() {
+				err = types.ErrNotEnoughNodesAvailable
+			}
+
+			return status, err
+		}
+
+		results := make([]*types.ExitResult, len(transfers))
+
+		for i, t := range transfers {
+			results[i] = &types.ExitResult{PieceID: t.Piece.ID}
+
+			receipt, err := nn.transfer(t, read)
+
+			if err != nil {
+				results[i].Error = err.Error()
+				continue
+			}
+
+			results[i].Receipt = receipt
+		}
+
+		status, err = nn.api.ReportExit(id, results)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if progress != nil {
+			progress(status)
+		}
+	}
+
+	return status, nil
+}
+
+// transfer sends a piece of the exiting node to the target of the transfer
+// and returns the receipt the target signed for it.
+func (nn *Network) transfer(t *types.ExitTransfer, read func(types.PieceID) ([]byte, error)) (*types.PieceReceipt, error) {
+	data, err := read(t.Piece.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// don't spread pieces that were corrupted on this node
+	if !bytes.Equal(hashutil.Blake3(data), t.Piece.Hash) {
+		return nil, types.ErrPieceHashMismatch
+	}
+
+	receipt, err := nn.transport.Put(withOrder(context.Background(), t.Piece.Order), t.Target, t.Piece.ID, data, t.ExpiresAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := nn.verifyReceipt(t.Target, t.Piece, receipt, int64(len(data))); err != nil {
+		return nil, err
+	}
+
+	return receipt, nil
+}
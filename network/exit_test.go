@@ -0,0 +1,116 @@
+package network_test
+
+import (
+	"bytes"
+	"dfs/network"
+	"dfs/types"
+	"io"
+	"testing"
+)
+
+func TestExit(t *testing.T) {
+	t.Run("transfers the pieces of an exiting node to other nodes", func(t *testing.T) {
+		client, nn, nodes := startOrderedNetwork(t, 84)
+		data := []byte("hello world")
+
+		obj := types.NewObject("photos/cat.jpg")
+		obj.Size = uint64(len(data))
+		obj.Segments = types.NewSegments(obj.ID, obj.Size)
+
+		if err := client.PutObject(&obj); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := nn.WriteObject(&obj, bytes.NewReader(data), nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		stored, err := client.GetObject(obj.Name)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		byID := make(map[types.NodeID]*orderedNode, len(nodes))
+
+		for _, n := range nodes {
+			byID[n.ID] = n
+		}
+
+		piece := stored.Segments[0].Pieces[0]
+		exiting := byID[piece.NodeID]
+
+		read := func(id types.PieceID) ([]byte, error) {
+			f, err := exiting.store.Open(id)
+
+			if err != nil {
+				return nil, err
+			}
+
+			defer f.Close()
+
+			return io.ReadAll(f)
+		}
+
+		exitNet := network.NewNetwork(network.WithApiClient(client), network.WithTransport(network.NewHTTPTransport(nil)))
+
+		status, err := exitNet.Exit(exiting.ID, read, nil)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if status.Pieces != 1 || status.Transferred != 1 || status.Failed != 0 {
+			t.Fatalf("expected the piece to be transferred, got %+v", status)
+		}
+
+		stored, err = client.GetObject(obj.Name)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		moved := stored.Segments[0].Pieces[0]
+
+		if moved.ID != piece.ID || moved.NodeID == exiting.ID {
+			t.Fatalf("expected the piece to be moved, got %+v", moved)
+		}
+
+		if _, err := byID[moved.NodeID].store.Stat(moved.ID); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// the exiting node gets no new pieces
+		if err := nn.RefreshNodes(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		other := types.NewObject("photos/dog.jpg")
+		other.Size = uint64(len(data))
+		other.Segments = types.NewSegments(other.ID, other.Size)
+
+		if err := client.PutObject(&other); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := nn.WriteObject(&other, bytes.NewReader(data), nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for _, p := range other.Segments[0].Pieces {
+			if p.NodeID == exiting.ID {
+				t.Fatalf("expected no piece on the exiting node")
+			}
+		}
+
+		var buf bytes.Buffer
+
+		if err := nn.ReadObject(stored, &buf, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !bytes.Equal(buf.Bytes(), data) {
+			t.Fatalf("expected %s, got %s", data, buf.Bytes())
+		}
+	})
+}
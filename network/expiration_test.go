@@ -0,0 +1,72 @@
+package network_test
+
+import (
+	"bytes"
+	"context"
+	"dfs/client/api"
+	"dfs/metadata"
+	"dfs/network"
+	"dfs/types"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestExpiringWrites(t *testing.T) {
+	t.Run("pieces expire with their object and are not shared", func(t *testing.T) {
+		ts := httptest.NewServer(metadata.NewServer().Handler())
+		defer ts.Close()
+
+		client := api.NewClient(ts.URL, "test")
+		tr := network.NewMemoryTransport()
+		nodes := newTestNodes(80)
+
+		nn := network.NewNetwork(
+			network.WithUnsignedReceipts(),
+			network.WithApiClient(client),
+			network.WithNodes(nodes),
+			network.WithTransport(tr),
+			network.WithConvergenceKey(bytes.Repeat([]byte{7}, 32)),
+		)
+
+		data := []byte("a cached build artifact")
+		expiresAt := time.Now().Add(7 * 24 * time.Hour).Truncate(time.Second)
+
+		obj := types.NewObject("cache/artifact")
+		obj.Size = uint64(len(data))
+		obj.ExpiresAt = expiresAt
+		obj.Segments = types.NewSegments(obj.ID, obj.Size)
+
+		if err := client.PutObject(&obj); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := nn.WriteObject(&obj, bytes.NewReader(data), nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		segment := obj.Segments[0]
+
+		if segment.ContentKey != nil {
+			t.Fatalf("expected the segment of an expiring object not to be content addressed")
+		}
+
+		for _, piece := range segment.Pieces {
+			node, err := nn.GetNode(piece.NodeID)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			info, err := tr.Stat(context.Background(), node, piece.ID)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !info.ExpiresAt.Equal(expiresAt) {
+				t.Fatalf("expected piece to expire at %v, got %v", expiresAt, info.ExpiresAt)
+			}
+		}
+	})
+}
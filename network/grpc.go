@@ -0,0 +1,220 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"dfs/hashutil"
+	"dfs/node/nodepb"
+	"dfs/types"
+	"io"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// grpcChunkSize is the amount of piece data sent per upload message.
+const grpcChunkSize = 256 * types.ONE_KILOBYTE
+
+// GRPCTransport talks to storage nodes over their gRPC piece service. One
+// connection is kept per node address and shared by all requests to it.
+type GRPCTransport struct {
+	mu    sync.Mutex
+	conns map[string]*grpc.ClientConn
+	opts  []grpc.DialOption
+}
+
+func NewGRPCTransport(opts ...grpc.DialOption) *GRPCTransport {
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		}
+	}
+
+	return &GRPCTransport{
+		conns: make(map[string]*grpc.ClientConn),
+		opts:  opts,
+	}
+}
+
+func (t *GRPCTransport) client(node *types.Node) (nodepb.PieceServiceClient, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	conn, ok := t.conns[node.GRPCAddr]
+
+	if !ok {
+		var err error
+		conn, err = grpc.NewClient(node.GRPCAddr, t.opts...)
+
+		if err != nil {
+			return nil, err
+		}
+
+		t.conns[node.GRPCAddr] = conn
+	}
+
+	return nodepb.NewPieceServiceClient(conn), nil
+}
+
+func grpcError(err error) error {
+	switch status.Code(err) {
+	case codes.NotFound:
+		return types.ErrPieceNotFound
+	case codes.ResourceExhausted:
+		return types.ErrNodeFull
+	case codes.AlreadyExists:
+		return types.ErrPieceExists
+	case codes.PermissionDenied:
+		return types.ErrOrderRejected
+	case codes.DataLoss:
+		return types.ErrPieceMismatch
+	}
+
+	return err
+}
+
+func (t *GRPCTransport) Put(ctx context.Context, node *types.Node, id types.PieceID, data []byte, expiresAt time.Time) (*types.PieceReceipt, error) {
+	client, err := t.client(node)
+
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := client.Upload(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &nodepb.UploadRequest{
+		PieceId:   id.String(),
+		ExpiresAt: types.UnixSeconds(expiresAt),
+		Order:     orderFrom(ctx),
+		Size:      int64(len(data)),
+		Hash:      hashutil.Blake3(data),
+	}
+
+	for {
+		n := min(len(data), grpcChunkSize)
+		msg.Data = data[:n]
+		data = data[n:]
+
+		if err := stream.Send(msg); err != nil {
+			// the real error is reported by CloseAndRecv
+			break
+		}
+
+		if len(data) == 0 {
+			break
+		}
+
+		msg = &nodepb.UploadRequest{}
+	}
+
+	res, err := stream.CloseAndRecv()
+
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &types.PieceReceipt{
+		PieceID:   id,
+		Hash:      res.Hash,
+		Size:      res.Size,
+		Signature: res.Signature,
+	}, nil
+}
+
+func (t *GRPCTransport) Get(ctx context.Context, node *types.Node, id types.PieceID) ([]byte, error) {
+	return t.GetRange(ctx, node, id, 0, 0)
+}
+
+// GetRange reads length bytes of the piece starting at offset. A length of
+// zero reads to the end of the piece.
+func (t *GRPCTransport) GetRange(ctx context.Context, node *types.Node, id types.PieceID, offset, length int64) ([]byte, error) {
+	client, err := t.client(node)
+
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := client.Download(ctx, &nodepb.DownloadRequest{
+		PieceId: id.String(),
+		Offset:  offset,
+		Length:  length,
+		Order:   orderFrom(ctx),
+	})
+
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	var buf bytes.Buffer
+
+	for {
+		msg, err := stream.Recv()
+
+		if err == io.EOF {
+			return buf.Bytes(), nil
+		}
+
+		if err != nil {
+			return nil, grpcError(err)
+		}
+
+		buf.Write(msg.Data)
+	}
+}
+
+func (t *GRPCTransport) Delete(ctx context.Context, node *types.Node, id types.PieceID) error {
+	client, err := t.client(node)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Delete(ctx, &nodepb.DeleteRequest{PieceId: id.String(), Order: orderFrom(ctx)})
+
+	return grpcError(err)
+}
+
+func (t *GRPCTransport) Stat(ctx context.Context, node *types.Node, id types.PieceID) (*types.PieceInfo, error) {
+	client, err := t.client(node)
+
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := client.Stat(ctx, &nodepb.StatRequest{PieceId: id.String(), Order: orderFrom(ctx)})
+
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &types.PieceInfo{
+		ID:        id,
+		Size:      res.Size,
+		CreatedAt: time.Unix(res.CreatedAt, 0),
+		ExpiresAt: types.UnixTime(res.ExpiresAt),
+	}, nil
+}
+
+func (t *GRPCTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var firstErr error
+
+	for addr, conn := range t.conns {
+		if err := conn.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(t.conns, addr)
+	}
+
+	return firstErr
+}
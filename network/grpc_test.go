@@ -0,0 +1,138 @@
+package network_test
+
+import (
+	"bytes"
+	"context"
+	"dfs/hashutil"
+	"dfs/network"
+	"dfs/node"
+	"dfs/node/piecestore"
+	"dfs/types"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+func startGRPCNode(t *testing.T) *types.Node {
+	t.Helper()
+
+	store, err := piecestore.New(t.TempDir())
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	g := grpc.NewServer()
+	node.NewServer(node.WithStore(store)).RegisterGRPC(g)
+
+	go g.Serve(lis)
+	t.Cleanup(g.Stop)
+
+	return &types.Node{
+		ID:       types.NewNodeID(),
+		GRPCAddr: lis.Addr().String(),
+	}
+}
+
+func TestGRPCTransport(t *testing.T) {
+	t.Run("can put, stat, get and delete a piece", func(t *testing.T) {
+		n := startGRPCNode(t)
+		tr := network.NewGRPCTransport()
+		defer tr.Close()
+
+		ctx := context.Background()
+		id := types.NewPieceID()
+
+		// larger than one stream message
+		data := bytes.Repeat([]byte("0123456789"), 100*types.ONE_KILOBYTE)
+		expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+
+		if _, err := tr.Put(ctx, n, id, data, expiresAt); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		info, err := tr.Stat(ctx, n, id)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if info.Size != int64(len(data)) {
+			t.Fatalf("expected size %d, got %d", len(data), info.Size)
+		}
+
+		if !info.ExpiresAt.Equal(expiresAt) {
+			t.Fatalf("expected the piece to expire at %v, got %v", expiresAt, info.ExpiresAt)
+		}
+
+		result, err := tr.Get(ctx, n, id)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !bytes.Equal(result, data) {
+			t.Fatalf("expected data to be equal")
+		}
+
+		result, err = tr.GetRange(ctx, n, id, 5, 10)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !bytes.Equal(result, data[5:15]) {
+			t.Fatalf("expected %s, got %s", data[5:15], result)
+		}
+
+		if err := tr.Delete(ctx, n, id); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		_, err = tr.Get(ctx, n, id)
+
+		if !errors.Is(err, types.ErrPieceNotFound) {
+			t.Fatalf("expected %v, got %v", types.ErrPieceNotFound, err)
+		}
+	})
+
+	t.Run("network uses gRPC for nodes with a gRPC address", func(t *testing.T) {
+		n := startGRPCNode(t)
+
+		nn := network.NewNetwork(
+			network.WithUnsignedReceipts(),
+			network.WithNodes([]*types.Node{n}),
+		)
+
+		data := []byte("hello world")
+
+		piece := &types.Piece{
+			ID:     types.NewPieceID(),
+			Hash:   hashutil.Blake3(data),
+			NodeID: n.ID,
+		}
+
+		if err := nn.WritePiece(piece, data); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		result, err := nn.ReadPiece(piece)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !bytes.Equal(result, data) {
+			t.Fatalf("expected data to be equal")
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package network_test
+
+import (
+	"bytes"
+	"dfs/client/api"
+	"dfs/hashutil"
+	"dfs/metadata"
+	"dfs/network"
+	"dfs/types"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContentHash(t *testing.T) {
+	ts := httptest.NewServer(metadata.NewServer().Handler())
+	defer ts.Close()
+
+	client := api.NewClient(ts.URL, "test")
+
+	nn := network.NewNetwork(
+		network.WithUnsignedReceipts(),
+		network.WithApiClient(client),
+		network.WithNodes(newTestNodes(80)),
+		network.WithTransport(network.NewMemoryTransport()),
+	)
+
+	data := bytes.Repeat([]byte("hello world "), 1000)
+
+	obj := types.NewObject("hello.txt")
+	obj.Size = uint64(len(data))
+	obj.Segments = types.NewSegments(obj.ID, obj.Size)
+
+	if err := client.PutObject(&obj); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := nn.WriteObject(&obj, bytes.NewReader(data), nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	t.Run("records the hash of the uploaded data", func(t *testing.T) {
+		stored, err := client.GetObject("hello.txt")
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !bytes.Equal(stored.ContentHash, hashutil.Blake3(data)) {
+			t.Fatalf("expected content hash %x, got %x", hashutil.Blake3(data), stored.ContentHash)
+		}
+
+		if !stored.ModifiedAt.Equal(stored.CreatedAt) {
+			t.Fatalf("expected recording the hash not to modify the object")
+		}
+
+		var buf bytes.Buffer
+
+		if err := nn.ReadObject(stored, &buf, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("detects data that does not match the hash", func(t *testing.T) {
+		stored, err := client.GetObject("hello.txt")
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		stored.ContentHash = hashutil.Blake3([]byte("something else"))
+
+		if err := nn.ReadObject(stored, io.Discard, nil); !errors.Is(err, types.ErrContentHashMismatch) {
+			t.Fatalf("expected %v, got %v", types.ErrContentHashMismatch, err)
+		}
+
+		if err := nn.ReadObjectRange(stored, io.Discard, 0, stored.Size, nil); !errors.Is(err, types.ErrContentHashMismatch) {
+			t.Fatalf("expected %v, got %v", types.ErrContentHashMismatch, err)
+		}
+
+		// partial reads can't be verified
+		if err := nn.ReadObjectRange(stored, io.Discard, 1, stored.Size-1, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
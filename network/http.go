@@ -0,0 +1,213 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"dfs/hashutil"
+	"dfs/types"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HTTPTransport talks to storage nodes over their HTTP /pieces API.
+type HTTPTransport struct {
+	client *http.Client
+}
+
+func NewHTTPTransport(client *http.Client) *HTTPTransport {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &HTTPTransport{client: client}
+}
+
+func pieceURL(node *types.Node, id types.PieceID) string {
+	return node.HttpAddr + "/pieces/" + id.String()
+}
+
+// newRequest creates a request carrying the order of ctx, if any.
+func newRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if order := orderFrom(ctx); order != "" {
+		req.Header.Set("X-Piece-Order", order)
+	}
+
+	return req, nil
+}
+
+func (t *HTTPTransport) do(ctx context.Context, method, url string, body io.Reader) (*http.Response, error) {
+	req, err := newRequest(ctx, method, url, body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return t.client.Do(req)
+}
+
+func (t *HTTPTransport) Put(ctx context.Context, node *types.Node, id types.PieceID, data []byte, expiresAt time.Time) (*types.PieceReceipt, error) {
+	req, err := newRequest(ctx, "POST", pieceURL(node, id), bytes.NewReader(data))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !expiresAt.IsZero() {
+		req.Header.Set("X-Piece-Expires-At", strconv.FormatInt(expiresAt.Unix(), 10))
+	}
+
+	// the node only stores the piece if it arrives as it was sent
+	req.Header.Set("X-Piece-Hash", hex.EncodeToString(hashutil.Blake3(data)))
+
+	res, err := t.client.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusInsufficientStorage:
+		return nil, types.ErrNodeFull
+	case http.StatusConflict:
+		return nil, types.ErrPieceExists
+	case http.StatusForbidden, http.StatusRequestEntityTooLarge:
+		return nil, types.ErrOrderRejected
+	case http.StatusUnprocessableEntity:
+		return nil, types.ErrPieceMismatch
+	default:
+		return nil, types.ErrCouldNotWritePiece
+	}
+
+	var receipt types.PieceReceipt
+
+	if err := json.NewDecoder(res.Body).Decode(&receipt); err != nil {
+		return nil, err
+	}
+
+	return &receipt, nil
+}
+
+func (t *HTTPTransport) Get(ctx context.Context, node *types.Node, id types.PieceID) ([]byte, error) {
+	return t.GetRange(ctx, node, id, 0, 0)
+}
+
+func (t *HTTPTransport) GetRange(ctx context.Context, node *types.Node, id types.PieceID, offset, length int64) ([]byte, error) {
+	req, err := newRequest(ctx, "GET", pieceURL(node, id), nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if length > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	} else if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	res, err := t.client.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		data, err := io.ReadAll(res.Body)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// the node ignored the range, cut it out ourselves
+		return sliceRange(data, offset, length), nil
+	case http.StatusPartialContent:
+		return io.ReadAll(res.Body)
+	case http.StatusNotFound:
+		return nil, types.ErrPieceNotFound
+	case http.StatusForbidden:
+		return nil, types.ErrOrderRejected
+	default:
+		return nil, types.ErrCouldNotReadPiece
+	}
+}
+
+func sliceRange(data []byte, offset, length int64) []byte {
+	if offset >= int64(len(data)) {
+		return nil
+	}
+
+	data = data[offset:]
+
+	if length > 0 && length < int64(len(data)) {
+		data = data[:length]
+	}
+
+	return data
+}
+
+func (t *HTTPTransport) Delete(ctx context.Context, node *types.Node, id types.PieceID) error {
+	res, err := t.do(ctx, "DELETE", pieceURL(node, id), nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return types.ErrPieceNotFound
+	case http.StatusForbidden:
+		return types.ErrOrderRejected
+	default:
+		return fmt.Errorf("could not delete piece: %s", res.Status)
+	}
+}
+
+func (t *HTTPTransport) Stat(ctx context.Context, node *types.Node, id types.PieceID) (*types.PieceInfo, error) {
+	res, err := t.do(ctx, "HEAD", pieceURL(node, id), nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, types.ErrPieceNotFound
+	case http.StatusForbidden:
+		return nil, types.ErrOrderRejected
+	default:
+		return nil, types.ErrCouldNotReadPiece
+	}
+
+	createdAt, _ := strconv.ParseInt(res.Header.Get("X-Piece-Created-At"), 10, 64)
+	expiresAt, _ := strconv.ParseInt(res.Header.Get("X-Piece-Expires-At"), 10, 64)
+
+	return &types.PieceInfo{
+		ID:        id,
+		Size:      res.ContentLength,
+		CreatedAt: time.Unix(createdAt, 0),
+		ExpiresAt: types.UnixTime(expiresAt),
+	}, nil
+}
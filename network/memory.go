@@ -0,0 +1,102 @@
+package network
+
+import (
+	"context"
+	"dfs/hashutil"
+	"dfs/types"
+	"sync"
+	"time"
+)
+
+type memoryPiece struct {
+	data      []byte
+	createdAt time.Time
+	expiresAt time.Time
+}
+
+// MemoryTransport keeps pieces in memory, keyed by node and piece ID. It is
+// meant for tests.
+type MemoryTransport struct {
+	mu     sync.RWMutex
+	pieces map[types.NodeID]map[types.PieceID]memoryPiece
+}
+
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{
+		pieces: make(map[types.NodeID]map[types.PieceID]memoryPiece),
+	}
+}
+
+// Put stores the piece, expired pieces are only reported by Stat, not deleted.
+// There is no node to sign the receipt.
+func (t *MemoryTransport) Put(ctx context.Context, node *types.Node, id types.PieceID, data []byte, expiresAt time.Time) (*types.PieceReceipt, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pieces[node.ID] == nil {
+		t.pieces[node.ID] = make(map[types.PieceID]memoryPiece)
+	}
+
+	t.pieces[node.ID][id] = memoryPiece{
+		data:      append([]byte(nil), data...),
+		createdAt: time.Now(),
+		expiresAt: expiresAt,
+	}
+
+	return &types.PieceReceipt{PieceID: id, Hash: hashutil.Blake3(data), Size: int64(len(data))}, nil
+}
+
+func (t *MemoryTransport) get(node *types.Node, id types.PieceID) (memoryPiece, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	p, ok := t.pieces[node.ID][id]
+
+	if !ok {
+		return p, types.ErrPieceNotFound
+	}
+
+	return p, nil
+}
+
+func (t *MemoryTransport) Get(ctx context.Context, node *types.Node, id types.PieceID) ([]byte, error) {
+	return t.GetRange(ctx, node, id, 0, 0)
+}
+
+func (t *MemoryTransport) GetRange(ctx context.Context, node *types.Node, id types.PieceID, offset, length int64) ([]byte, error) {
+	p, err := t.get(node, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(nil), sliceRange(p.data, offset, length)...), nil
+}
+
+func (t *MemoryTransport) Delete(ctx context.Context, node *types.Node, id types.PieceID) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.pieces[node.ID][id]; !ok {
+		return types.ErrPieceNotFound
+	}
+
+	delete(t.pieces[node.ID], id)
+
+	return nil
+}
+
+func (t *MemoryTransport) Stat(ctx context.Context, node *types.Node, id types.PieceID) (*types.PieceInfo, error) {
+	p, err := t.get(node, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.PieceInfo{
+		ID:        id,
+		Size:      int64(len(p.data)),
+		CreatedAt: p.createdAt,
+		ExpiresAt: p.expiresAt,
+	}, nil
+}
@@ -2,36 +2,69 @@ package network
 
 import (
 	"bytes"
+	"context"
 	"dfs/client/api"
+	"dfs/compression"
 	"dfs/erasure"
 	"dfs/hashutil"
+	"dfs/identity"
+	"dfs/orders"
 	"dfs/progress"
 	"dfs/types"
+	"errors"
+	"hash"
 	"io"
 	"math/rand"
-	"net/http"
+	"sync"
+	"time"
 )
 
 type Network struct {
-	api   *api.Client
+	api       *api.Client
+	transport Transport
+
+	mu    sync.RWMutex
 	nodes []*types.Node
+
+	convergenceKey []byte
+
+	unsignedReceipts bool
 }
 
+// RandomNodesList returns n random nodes that are not full.
 func (nn *Network) RandomNodesList(n int) ([]*types.Node, error) {
+	return nn.RandomNodesWithRoom(n, 0)
+}
+
+// RandomNodesWithRoom returns n random nodes that had room for size more
+// bytes when they last reported their capacity. Exiting nodes are left out.
+func (nn *Network) RandomNodesWithRoom(n int, size uint64) ([]*types.Node, error) {
+	nn.mu.RLock()
+	defer nn.mu.RUnlock()
+
+	newList := make([]*types.Node, 0, len(nn.nodes))
 
-	if len(nn.nodes) < n {
+	for _, node := range nn.nodes {
+		if node.HasRoom(size) && !node.Exiting {
+			newList = append(newList, node)
+		}
+	}
+
+	if len(newList) < n {
 		return nil, types.ErrNotEnoughNodesAvailable
 	}
-	newList := make([]*types.Node, len(nn.nodes))
 
-	rand.Shuffle(len(nn.nodes), func(i, j int) {
-		newList[j], newList[i] = nn.nodes[i], nn.nodes[j]
+	rand.Shuffle(len(newList), func(i, j int) {
+		newList[i], newList[j] = newList[j], newList[i]
 	})
 
 	return newList[:n], nil
 }
 
 func (n *Network) GetNode(nodeID types.NodeID) (*types.Node, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
 	var found *types.Node
 
 	for _, node := range n.nodes {
@@ -48,6 +81,30 @@ func (n *Network) GetNode(nodeID types.NodeID) (*types.Node, error) {
 	return found, nil
 }
 
+// RefreshNodes replaces the known nodes with the ones registered on the
+// metadata server.
+func (nn *Network) RefreshNodes() error {
+	nodes, err := nn.api.ListNodes()
+
+	if err != nil {
+		return err
+	}
+
+	nn.mu.Lock()
+	nn.nodes = nodes
+	nn.mu.Unlock()
+
+	return nil
+}
+
+// NodeCount returns the number of known nodes.
+func (nn *Network) NodeCount() int {
+	nn.mu.RLock()
+	defer nn.mu.RUnlock()
+
+	return len(nn.nodes)
+}
+
 func WithApiClient(api *api.Client) func(*Network) {
 	return func(nn *Network) {
 		nn.api = api
@@ -60,6 +117,32 @@ func WithNodes(nodes []*types.Node) func(*Network) {
 	}
 }
 
+// WithConvergenceKey enables content addressed segments. Segments are keyed
+// by the Blake3 hash of their plaintext keyed with key, which must be 32
+// bytes, and data that is already stored in the same bucket is referenced
+// instead of uploaded once it was read back and found to match.
+func WithConvergenceKey(key []byte) func(*Network) {
+	return func(nn *Network) {
+		nn.convergenceKey = key
+	}
+}
+
+// WithUnsignedReceipts accepts piece receipts from nodes without an
+// identity. Only networks whose nodes are all run by the client, such as a
+// local network, should accept them: without a signature a node can claim to
+// store pieces it never stored.
+func WithUnsignedReceipts() func(*Network) {
+	return func(nn *Network) {
+		nn.unsignedReceipts = true
+	}
+}
+
+func WithTransport(t Transport) func(*Network) {
+	return func(nn *Network) {
+		nn.transport = t
+	}
+}
+
 func NewNetwork(opts ...func(*Network)) *Network {
 	nn := &Network{
 		nodes: make([]*types.Node, 0),
@@ -69,18 +152,32 @@ func NewNetwork(opts ...func(*Network)) *Network {
 		opt(nn)
 	}
 
+	if nn.transport == nil {
+		nn.transport = NewNodeTransport(NewHTTPTransport(nil), NewGRPCTransport())
+	}
+
 	return nn
 }
 
+// WriteObject uploads the segments of the object from r and records the
+// Blake3 hash of the data read as its content hash.
 func (nn *Network) WriteObject(obj *types.Object, r io.Reader, progress progress.BytesReadWithTotal) error {
+	h := hashutil.NewBlake3()
+	r = io.TeeReader(r, h)
+
 	var totalBytesRead uint64 = 0
 	var segmentProgress = func(bytesRead uint64) error {
 		totalBytesRead += bytesRead
-		progress(totalBytesRead, obj.Size)
-		return nil
+		if progress == nil {
+			return nil
+		}
+		return progress(totalBytesRead, obj.Size)
 	}
 
 	for _, segment := range obj.Segments {
+		segment.Compression = obj.Compression
+		segment.ExpiresAt = obj.ExpiresAt
+
 		err := nn.WriteSegment(segment, r, segmentProgress)
 
 		if err != nil {
@@ -88,25 +185,94 @@ func (nn *Network) WriteObject(obj *types.Object, r io.Reader, progress progress
 		}
 	}
 
+	obj.ContentHash = h.Sum(nil)
+
+	_, err := nn.api.UpdateObject(&types.UpdateObjectRequest{Name: obj.Name, ContentHash: obj.ContentHash})
+
+	return err
+}
+
+// hashWriter hashes what is written to w and checks it against the content
+// hash of an object once all of it was written.
+type hashWriter struct {
+	w    io.Writer
+	h    hash.Hash
+	want []byte
+}
+
+func newHashWriter(w io.Writer, obj *types.Object) *hashWriter {
+	return &hashWriter{w: w, h: hashutil.NewBlake3(), want: obj.ContentHash}
+}
+
+func (hw *hashWriter) Write(p []byte) (int, error) {
+	n, err := hw.w.Write(p)
+	hw.h.Write(p[:n])
+	return n, err
+}
+
+func (hw *hashWriter) verify() error {
+	if hw.want != nil && !bytes.Equal(hw.h.Sum(nil), hw.want) {
+		return types.ErrContentHashMismatch
+	}
+
 	return nil
 }
 
 func (nn *Network) WriteSegment(segment *types.Segment, r io.Reader, pc progress.BytesRead) error {
 
 	// check there are enough nodes available
-	randomNodes, err := nn.RandomNodesList(80)
+	if _, err := nn.RandomNodesList(types.DATA_SHARDS + types.PARITY_SHARDS); err != nil {
+		return err
+	}
+
+	data, err := io.ReadAll(&progressReader{r: io.LimitReader(r, int64(segment.Size)), pc: pc})
 
 	if err != nil {
 		return err
 	}
 
-	data, err := io.ReadAll(io.LimitReader(r, int64(segment.Size)))
+	if uint64(len(data)) != segment.Size {
+		return io.ErrUnexpectedEOF
+	}
+
+	// pieces that expire can't be shared with objects that don't
+	if nn.convergenceKey != nil && segment.ExpiresAt.IsZero() {
+		segment.ContentKey, err = hashutil.KeyedBlake3(nn.convergenceKey, data)
+
+		if err != nil {
+			return err
+		}
+
+		existing, err := nn.api.LookupSegment(segment.ObjectID, segment.ContentKey)
+
+		if err != nil && !errors.Is(err, types.ErrSegmentNotFound) {
+			return err
+		}
+
+		// the data is already stored, only reference it. Content keys are
+		// chosen by whoever stored the segment first, so it is only used if
+		// it holds the data, otherwise the data is stored without a key
+		if err == nil {
+			if nn.holds(existing, data) {
+				segment.Pieces = existing.Pieces
+				segment.Compression = existing.Compression
+				segment.EncodedSize = existing.EncodedSize
+				return nn.api.CreateSegment(segment)
+			}
+
+			segment.ContentKey = nil
+		}
+	}
+
+	segment.Compression, data, err = compression.Compress(segment.Compression, data)
 
 	if err != nil {
 		return err
 	}
 
-	enc := erasure.NewReedSolomonEncoder(29, 51)
+	segment.EncodedSize = uint64(len(data))
+
+	enc := erasure.NewReedSolomonEncoder(types.DATA_SHARDS, types.PARITY_SHARDS)
 
 	shards, err := enc.Encode(data)
 
@@ -114,85 +280,231 @@ func (nn *Network) WriteSegment(segment *types.Segment, r io.Reader, pc progress
 		return err
 	}
 
+	// all shards have the same size
+	randomNodes, err := nn.RandomNodesWithRoom(len(shards), uint64(len(shards[0])))
+
+	if err != nil {
+		return err
+	}
+
+	pieces := make([]*types.Piece, len(shards))
+
 	for i, shard := range shards {
-		piece := &types.Piece{
+		pieces[i] = &types.Piece{
 			ID:       types.NewPieceID(),
 			Hash:     hashutil.Blake3(shard),
 			Position: uint(i),
 			NodeID:   randomNodes[i].ID,
 		}
+	}
 
-		segment.Pieces = append(segment.Pieces, piece)
+	if err := nn.orderPieces(segment.ObjectID, pieces, orders.ActionPut, int64(len(shards[0]))); err != nil {
+		return err
 	}
 
+	// pieces are only recorded once their node signed for them
 	for i, shard := range shards {
-		err = nn.WritePiece(segment.Pieces[i], shard)
+		err = nn.writePiece(pieces[i], shard, segment.ExpiresAt)
 
 		if err != nil {
 			return err
 		}
+
+		segment.Pieces = append(segment.Pieces, pieces[i])
 	}
 
+	uploaded := segment.Pieces
+
 	err = nn.api.CreateSegment(segment)
 
 	if err != nil {
 		return err
 	}
 
+	// another upload of the same content won the race, our pieces are unused
+	if len(segment.Pieces) > 0 && segment.Pieces[0].ID != uploaded[0].ID {
+		if err := nn.orderPieces(segment.ObjectID, uploaded, orders.ActionDelete, 0); err == nil {
+			nn.deletePieces(uploaded)
+		}
+	}
+
 	return nil
 }
 
-func (nn *Network) WritePiece(piece *types.Piece, data []byte) error {
-	node, err := nn.GetNode(piece.NodeID)
+// orderPieces sets orders for action on the pieces of the object if any of
+// them is stored on a node that requires orders.
+func (nn *Network) orderPieces(objectID types.ObjectID, pieces []*types.Piece, action orders.Action, maxSize int64) error {
+	required := false
+
+	for _, piece := range pieces {
+		if node, err := nn.GetNode(piece.NodeID); err == nil && node.RequiresOrders {
+			required = true
+			break
+		}
+	}
+
+	if !required {
+		return nil
+	}
+
+	ordered, err := nn.api.CreateOrders(objectID, &types.OrderRequest{
+		Action:  string(action),
+		Pieces:  pieces,
+		MaxSize: maxSize,
+	})
 
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequest("POST", node.HttpAddr+"/pieces/"+piece.ID.String(), bytes.NewBuffer(data))
+	for i, piece := range pieces {
+		piece.Order = ordered[i].Order
+	}
+
+	return nil
+}
+
+func (nn *Network) WritePiece(piece *types.Piece, data []byte) error {
+	return nn.writePiece(piece, data, time.Time{})
+}
+
+func (nn *Network) writePiece(piece *types.Piece, data []byte, expiresAt time.Time) error {
+	node, err := nn.GetNode(piece.NodeID)
 
 	if err != nil {
 		return err
 	}
 
-	res, err := http.DefaultClient.Do(req)
+	receipt, err := nn.transport.Put(withOrder(context.Background(), piece.Order), node, piece.ID, data, expiresAt)
 
 	if err != nil {
 		return err
 	}
 
-	defer res.Body.Close()
+	return nn.verifyReceipt(node, piece, receipt, int64(len(data)))
+}
+
+// verifyReceipt checks that the node stored the piece as it was sent and
+// signed the receipt with its identity. Nodes without an identity are only
+// trusted with WithUnsignedReceipts.
+func (nn *Network) verifyReceipt(node *types.Node, piece *types.Piece, receipt *types.PieceReceipt, size int64) error {
+	if receipt.PieceID != piece.ID || receipt.Size != size || !bytes.Equal(receipt.Hash, piece.Hash) {
+		return types.ErrInvalidReceipt
+	}
 
-	return nil
+	if len(node.PublicKey) == 0 {
+		if nn.unsignedReceipts {
+			return nil
+		}
+
+		return types.ErrInvalidReceipt
+	}
+
+	if !identity.Verify(node.ID, node.PublicKey) {
+		return types.ErrInvalidIdentity
+	}
+
+	return identity.VerifyReceipt(receipt, node.PublicKey)
 }
 
 func (nn *Network) ReadObject(obj *types.Object, w io.Writer, progress progress.BytesReadWithTotal) error {
 	var totalBytesRead uint64 = 0
 	var segmentProgress = func(bytesRead uint64) error {
 		totalBytesRead += bytesRead
-		progress(totalBytesRead, obj.Size)
-		return nil
+		if progress == nil {
+			return nil
+		}
+		return progress(totalBytesRead, obj.Size)
 	}
 
+	hw := newHashWriter(w, obj)
+
 	for _, segment := range obj.Segments {
 
-		err := nn.ReadSegment(segment, w, segmentProgress)
+		err := nn.ReadSegment(segment, hw, segmentProgress)
 
 		if err != nil {
 			return err
 		}
 	}
 
+	// the data is already written, a mismatch can only be reported
+	return hw.verify()
+}
+
+// ReadObjectRange writes length bytes of the object starting at offset to w.
+// Only the segments overlapping the range are fetched.
+func (nn *Network) ReadObjectRange(obj *types.Object, w io.Writer, offset, length uint64, progress progress.BytesReadWithTotal) error {
+	var totalBytesRead uint64 = 0
+	var rangeProgress = func(bytesRead uint64) error {
+		totalBytesRead += bytesRead
+		if progress == nil {
+			return nil
+		}
+		return progress(totalBytesRead, length)
+	}
+
+	end := offset + length
+	var segmentStart uint64 = 0
+
+	// reads of the whole object are verified like ReadObject
+	var hw *hashWriter
+
+	if offset == 0 && length == obj.Size {
+		hw = newHashWriter(w, obj)
+		w = hw
+	}
+
+	for _, segment := range obj.Segments {
+		segmentEnd := segmentStart + segment.Size
+
+		if segmentEnd > offset && segmentStart < end {
+			var buf bytes.Buffer
+
+			if err := nn.ReadSegment(segment, &buf, nil); err != nil {
+				return err
+			}
+
+			from := max(offset, segmentStart) - segmentStart
+			to := min(end, segmentEnd) - segmentStart
+
+			if err := writeWithProgress(w, buf.Bytes()[from:to], rangeProgress); err != nil {
+				return err
+			}
+		}
+
+		segmentStart = segmentEnd
+	}
+
+	if hw != nil {
+		return hw.verify()
+	}
+
 	return nil
 }
 
+// holds reports whether the segment reads back as data.
+func (nn *Network) holds(segment *types.Segment, data []byte) bool {
+	if segment.Size != uint64(len(data)) {
+		return false
+	}
+
+	var buf bytes.Buffer
+
+	if err := nn.ReadSegment(segment, &buf, nil); err != nil {
+		return false
+	}
+
+	return bytes.Equal(buf.Bytes(), data)
+}
+
 func (nn *Network) ReadSegment(segment *types.Segment, w io.Writer, pc progress.BytesRead) error {
 
-	var segData [][]byte = make([][]byte, 80)
+	var segData [][]byte = make([][]byte, types.DATA_SHARDS+types.PARITY_SHARDS)
 
 	var successPiecesCount uint = 0
 	for _, piece := range segment.Pieces {
-		if successPiecesCount == 29 {
+		if successPiecesCount == types.DATA_SHARDS {
 			break
 		}
 		data, err := nn.ReadPiece(piece)
@@ -205,11 +517,11 @@ func (nn *Network) ReadSegment(segment *types.Segment, w io.Writer, pc progress.
 		successPiecesCount++
 	}
 
-	if successPiecesCount < 29 {
+	if successPiecesCount < types.DATA_SHARDS {
 		return types.ErrNotEnoughPieces
 	}
 
-	enc := erasure.NewReedSolomonEncoder(29, 51)
+	enc := erasure.NewReedSolomonEncoder(types.DATA_SHARDS, types.PARITY_SHARDS)
 
 	data, err := enc.Reconstruct(segData)
 
@@ -217,13 +529,26 @@ func (nn *Network) ReadSegment(segment *types.Segment, w io.Writer, pc progress.
 		return err
 	}
 
-	_, err = w.Write(data[:segment.Size])
+	encodedSize := segment.EncodedSize
+	if encodedSize == 0 {
+		encodedSize = segment.Size
+	}
+
+	if encodedSize > uint64(len(data)) {
+		return io.ErrUnexpectedEOF
+	}
+
+	data, err = compression.Decompress(segment.Compression, data[:encodedSize], segment.Size)
 
 	if err != nil {
 		return err
 	}
 
-	return nil
+	if segment.Size > uint64(len(data)) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return writeWithProgress(w, data[:segment.Size], pc)
 }
 
 func (nn *Network) ReadPiece(piece *types.Piece) ([]byte, error) {
@@ -233,23 +558,74 @@ func (nn *Network) ReadPiece(piece *types.Piece) ([]byte, error) {
 		return nil, err
 	}
 
-	res, err := http.Get(node.HttpAddr + "/pieces/" + piece.ID.String())
+	data, err := nn.transport.Get(withOrder(context.Background(), piece.Order), node, piece.ID)
 
 	if err != nil {
 		return nil, err
 	}
 
-	defer res.Body.Close()
+	if hash := hashutil.Blake3(data); !bytes.Equal(hash, piece.Hash) {
+		return nil, types.ErrPieceHashMismatch
+	}
+
+	return data, nil
+}
 
-	data, err := io.ReadAll(res.Body)
+func (nn *Network) DeletePiece(piece *types.Piece) error {
+	node, err := nn.GetNode(piece.NodeID)
+
+	if err != nil {
+		return err
+	}
+
+	return nn.transport.Delete(withOrder(context.Background(), piece.Order), node, piece.ID)
+}
+
+func (nn *Network) StatPiece(piece *types.Piece) (*types.PieceInfo, error) {
+	node, err := nn.GetNode(piece.NodeID)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if hash := hashutil.Blake3(data); !bytes.Equal(hash, piece.Hash) {
-		return nil, types.ErrPieceHashMismatch
+	return nn.transport.Stat(withOrder(context.Background(), piece.Order), node, piece.ID)
+}
+
+// DeleteObject deletes the object from the metadata server and removes the
+// pieces no other object references from the storage nodes.
+func (nn *Network) DeleteObject(name string) error {
+	pieces, err := nn.api.DeleteObject(name)
+
+	if err != nil {
+		return err
 	}
 
-	return data, nil
+	return nn.deletePieces(pieces)
+}
+
+// ReplaceObject moves src over dst on the metadata server and removes the
+// pieces of the replaced object no other object references.
+func (nn *Network) ReplaceObject(src, dst string) (*types.Object, error) {
+	obj, pieces, err := nn.api.ReplaceObject(src, dst)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return obj, nn.deletePieces(pieces)
+}
+
+func (nn *Network) deletePieces(pieces []*types.Piece) error {
+	var errs []error
+
+	for _, piece := range pieces {
+		err := nn.DeletePiece(piece)
+
+		// pieces that are already gone need no deleting
+		if err != nil && !errors.Is(err, types.ErrPieceNotFound) {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
 }
@@ -2,17 +2,39 @@ package network_test
 
 import (
 	"bytes"
+	"crypto/ed25519"
 	"dfs/client/api"
 	"dfs/erasure"
 	"dfs/hashutil"
+	"dfs/identity"
 	"dfs/network"
+	"dfs/node"
+	"dfs/node/piecestore"
 	"dfs/types"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
 	"testing"
 
 	"github.com/h2non/gock"
 )
 
+// pieceReceipt answers a mocked upload with the receipt of the uploaded
+// piece.
+func pieceReceipt(res *http.Response) *http.Response {
+	data, _ := io.ReadAll(res.Request.Body)
+	id, _ := types.ParsePieceID(path.Base(res.Request.URL.Path))
+
+	body, _ := json.Marshal(types.PieceReceipt{PieceID: id, Hash: hashutil.Blake3(data), Size: int64(len(data))})
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	return res
+}
+
 func TestRandomNodesList(t *testing.T) {
 	t.Run("can get random nodes list", func(t *testing.T) {
 		nodes := []*types.Node{
@@ -31,6 +53,7 @@ func TestRandomNodesList(t *testing.T) {
 		}
 
 		nn := network.NewNetwork(
+			network.WithUnsignedReceipts(),
 			network.WithNodes(nodes),
 		)
 
@@ -50,6 +73,35 @@ func TestRandomNodesList(t *testing.T) {
 			}
 		}
 	})
+
+	t.Run("skips nodes without room", func(t *testing.T) {
+		nodes := []*types.Node{
+			{ID: types.NewNodeID(), HttpAddr: "http://node1", Capacity: 100, Free: 100},
+			{ID: types.NewNodeID(), HttpAddr: "http://node2", Capacity: 100, Free: 10},
+			{ID: types.NewNodeID(), HttpAddr: "http://node3"},
+		}
+
+		nn := network.NewNetwork(
+			network.WithUnsignedReceipts(),
+			network.WithNodes(nodes),
+		)
+
+		list, err := nn.RandomNodesWithRoom(2, 50)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for _, node := range list {
+			if node.ID == nodes[1].ID {
+				t.Fatalf("expected the full node to be skipped")
+			}
+		}
+
+		if _, err := nn.RandomNodesWithRoom(3, 50); !errors.Is(err, types.ErrNotEnoughNodesAvailable) {
+			t.Fatalf("expected ErrNotEnoughNodesAvailable, got %v", err)
+		}
+	})
 }
 
 func TestWriteSegment(t *testing.T) {
@@ -96,14 +148,15 @@ func TestWriteSegment(t *testing.T) {
 			Reply(200).
 			JSON(`{"status":"ok"}`)
 
-		for i, shard := range shards {
-			gock.New(fmt.Sprintf("http://node-%d", i)).
-				Post("/pieces").
-				Reply(200).
-				Body(bytes.NewBuffer(shard))
-		}
+		// hosts are matched as regular expressions, this answers all nodes
+		gock.New("http://node-").
+			Post("/pieces").
+			Times(len(shards)).
+			Reply(200).
+			Map(pieceReceipt)
 
 		nn := network.NewNetwork(
+			network.WithUnsignedReceipts(),
 			network.WithApiClient(
 				api.NewClient("http://localhost:8080", "test"),
 			),
@@ -129,7 +182,7 @@ func TestWritePiece(t *testing.T) {
 		gock.New("http://localhost:9090").
 			Post("/pieces").
 			Reply(200).
-			Body(bytes.NewBuffer(data))
+			Map(pieceReceipt)
 
 		nodes := []*types.Node{
 			{
@@ -138,6 +191,7 @@ func TestWritePiece(t *testing.T) {
 			}}
 
 		nn := network.NewNetwork(
+			network.WithUnsignedReceipts(),
 			network.WithNodes(nodes),
 		)
 
@@ -154,6 +208,81 @@ func TestWritePiece(t *testing.T) {
 			t.Fatalf("unexpected error: %v", err)
 		}
 	})
+
+	t.Run("rejects receipts of nodes without an identity", func(t *testing.T) {
+		data := []byte("hello world")
+
+		store, err := piecestore.New(t.TempDir())
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		ts := httptest.NewServer(node.NewServer(node.WithStore(store)).Handler())
+		defer ts.Close()
+
+		nodes := []*types.Node{{ID: types.NewNodeID(), HttpAddr: ts.URL}}
+
+		piece := &types.Piece{
+			ID:     types.NewPieceID(),
+			Hash:   hashutil.Blake3(data),
+			NodeID: nodes[0].ID,
+		}
+
+		if err := network.NewNetwork(network.WithNodes(nodes)).WritePiece(piece, data); !errors.Is(err, types.ErrInvalidReceipt) {
+			t.Fatalf("expected %v, got %v", types.ErrInvalidReceipt, err)
+		}
+
+		if err := network.NewNetwork(network.WithNodes(nodes), network.WithUnsignedReceipts()).WritePiece(piece, data); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("rejects receipts not signed by the node", func(t *testing.T) {
+		data := []byte("hello world")
+
+		_, key, err := ed25519.GenerateKey(nil)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		other, _, err := ed25519.GenerateKey(nil)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		store, err := piecestore.New(t.TempDir())
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		ts := httptest.NewServer(node.NewServer(node.WithStore(store), node.WithIdentity(key)).Handler())
+		defer ts.Close()
+
+		// the node is registered with another key than it signs with
+		nodes := []*types.Node{{ID: identity.NodeID(other), HttpAddr: ts.URL, PublicKey: other}}
+		nn := network.NewNetwork(network.WithNodes(nodes))
+
+		piece := &types.Piece{
+			ID:     types.NewPieceID(),
+			Hash:   hashutil.Blake3(data),
+			NodeID: nodes[0].ID,
+		}
+
+		if err := nn.WritePiece(piece, data); !errors.Is(err, types.ErrInvalidReceipt) {
+			t.Fatalf("expected %v, got %v", types.ErrInvalidReceipt, err)
+		}
+
+		// and nodes can't claim the ID of another
+		nodes[0].PublicKey = ed25519.PublicKey(key[32:])
+
+		if err := nn.WritePiece(piece, data); !errors.Is(err, types.ErrInvalidIdentity) {
+			t.Fatalf("expected %v, got %v", types.ErrInvalidIdentity, err)
+		}
+	})
 }
 
 func TestReadObject(t *testing.T) {
@@ -211,6 +340,7 @@ func TestReadObject(t *testing.T) {
 		}
 
 		nn := network.NewNetwork(
+			network.WithUnsignedReceipts(),
 			network.WithNodes(nodes),
 		)
 
@@ -275,6 +405,7 @@ func TestReadSegment(t *testing.T) {
 		}
 
 		nn := network.NewNetwork(
+			network.WithUnsignedReceipts(),
 			network.WithNodes(nodes),
 		)
 
@@ -316,6 +447,7 @@ func TestReadPiece(t *testing.T) {
 		}
 
 		nn := network.NewNetwork(
+			network.WithUnsignedReceipts(),
 			network.WithNodes(nodes),
 		)
 
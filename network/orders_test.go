@@ -0,0 +1,220 @@
+package network_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"dfs/client/api"
+	"dfs/identity"
+	"dfs/metadata"
+	"dfs/network"
+	"dfs/node"
+	"dfs/node/piecestore"
+	"dfs/orders"
+	"dfs/types"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// orderedNode is a storage node that requires orders, with the key it signs
+// its usage reports with.
+type orderedNode struct {
+	*types.Node
+
+	srv   *node.Server
+	store *piecestore.Store
+	key   ed25519.PrivateKey
+}
+
+// startOrderedNetwork starts a metadata server that signs orders and n HTTP
+// storage nodes registered with it that require them.
+func startOrderedNetwork(t *testing.T, n int) (*api.Client, *network.Network, []*orderedNode) {
+	t.Helper()
+
+	_, priv, err := ed25519.GenerateKey(nil)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ts := httptest.NewServer(metadata.NewServer(metadata.WithOrderKey(priv)).Handler())
+	t.Cleanup(ts.Close)
+
+	client := api.NewClient(ts.URL, "test")
+
+	orderKey, err := client.OrderKey()
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	nodes := make([]*types.Node, n)
+	ordered := make([]*orderedNode, len(nodes))
+
+	for i := range nodes {
+		store, err := piecestore.New(t.TempDir())
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		pub, key, err := ed25519.GenerateKey(nil)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		id := identity.NodeID(pub)
+		srv := node.NewServer(node.WithStore(store), node.WithIdentity(key), node.WithOrderKey(orderKey))
+
+		hs := httptest.NewServer(srv.Handler())
+		t.Cleanup(hs.Close)
+
+		nodes[i] = &types.Node{ID: id, HttpAddr: hs.URL, RequiresOrders: true, PublicKey: pub}
+		ordered[i] = &orderedNode{Node: nodes[i], srv: srv, store: store, key: key}
+
+		if err := client.RegisterNode(nodes[i]); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	nn := network.NewNetwork(
+		network.WithApiClient(client),
+		network.WithNodes(nodes),
+		network.WithTransport(network.NewHTTPTransport(nil)),
+	)
+
+	return client, nn, ordered
+}
+
+func TestOrders(t *testing.T) {
+	data := []byte("hello world")
+
+	put := func(t *testing.T, client *api.Client, nn *network.Network, name string) *types.Object {
+		obj := types.NewObject(name)
+		obj.Size = uint64(len(data))
+		obj.Segments = types.NewSegments(obj.ID, obj.Size)
+
+		if err := client.PutObject(&obj); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := nn.WriteObject(&obj, bytes.NewReader(data), nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		stored, err := client.GetObject(obj.Name)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var buf bytes.Buffer
+
+		if err := nn.ReadObject(stored, &buf, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !bytes.Equal(buf.Bytes(), data) {
+			t.Fatalf("expected %s, got %s", data, buf.Bytes())
+		}
+
+		return stored
+	}
+
+	t.Run("writes, reads and deletes objects on nodes that require orders", func(t *testing.T) {
+		client, nn, nodes := startOrderedNetwork(t, 80)
+		obj := put(t, client, nn, "ordered")
+
+		// the pieces are in use, nobody may delete them but DeleteObject
+		_, err := client.CreateOrders(obj.ID, &types.OrderRequest{
+			Action: "delete",
+			Pieces: obj.Segments[0].Pieces,
+		})
+
+		if err == nil {
+			t.Fatalf("expected delete orders for referenced pieces to be refused")
+		}
+
+		if err := nn.DeleteObject(obj.Name); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for _, n := range nodes {
+			if used := n.store.Used(); used != 0 {
+				t.Fatalf("expected the pieces to be deleted, %d bytes are left", used)
+			}
+		}
+	})
+
+	t.Run("settles the traffic nodes served per bucket", func(t *testing.T) {
+		client, nn, nodes := startOrderedNetwork(t, 80)
+		obj := put(t, client, nn, "photos/cat.jpg")
+
+		// orders are settled once they expired
+		later := time.Now().Add(2 * time.Hour)
+		served := int64(0)
+
+		for _, n := range nodes {
+			settlements := n.srv.Unsettled(later)
+
+			if len(settlements) == 0 {
+				continue
+			}
+
+			report := &types.UsageReport{NodeID: n.ID, Settlements: settlements}
+			orders.SignReport(report, n.key)
+
+			resp, err := client.SettleUsage(report)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if resp.Accepted != len(settlements) || resp.Rejected != 0 {
+				t.Fatalf("expected all settlements to be accepted, got %+v", resp)
+			}
+
+			n.srv.Settled(settlements)
+
+			if resp, err := client.SettleUsage(report); err != nil || resp.Rejected != len(settlements) {
+				t.Fatalf("expected settlements to be rejected the second time, got %+v, %v", resp, err)
+			}
+
+			// other nodes can't settle in the name of this one
+			report.NodeID = nodes[0].ID
+
+			if n != nodes[0] {
+				if _, err := client.SettleUsage(report); err == nil {
+					t.Fatalf("expected a report signed by another node to be rejected")
+				}
+			}
+
+			for _, settlement := range settlements {
+				served += settlement.Bytes
+			}
+		}
+
+		rollups, err := client.Bandwidth(&types.BandwidthRequest{Bucket: "photos"})
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		pieceSize := obj.Segments[0].PieceSize()
+		ingress, egress := int64(0), int64(0)
+
+		for _, rollup := range rollups {
+			ingress += rollup.Ingress
+			egress += rollup.Egress
+		}
+
+		if ingress != 80*pieceSize {
+			t.Fatalf("expected %d bytes uploaded, got %d", 80*pieceSize, ingress)
+		}
+
+		if egress < types.DATA_SHARDS*pieceSize || ingress+egress != served {
+			t.Fatalf("expected the downloaded pieces to be accounted, got %d bytes", egress)
+		}
+	})
+}
@@ -0,0 +1,49 @@
+package network
+
+import (
+	"dfs/progress"
+	"io"
+)
+
+// progressChunkSize is the granularity in which reads are reported when data
+// is written out in one piece.
+const progressChunkSize = 1024 * 1024
+
+// progressReader reports every read from r to pc.
+type progressReader struct {
+	r  io.Reader
+	pc progress.BytesRead
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+
+	if n > 0 && pr.pc != nil {
+		if perr := pr.pc(uint64(n)); perr != nil {
+			return n, perr
+		}
+	}
+
+	return n, err
+}
+
+// writeWithProgress writes data to w in chunks, reporting each one to pc.
+func writeWithProgress(w io.Writer, data []byte, pc progress.BytesRead) error {
+	for len(data) > 0 {
+		n := min(len(data), progressChunkSize)
+
+		if _, err := w.Write(data[:n]); err != nil {
+			return err
+		}
+
+		if pc != nil {
+			if err := pc(uint64(n)); err != nil {
+				return err
+			}
+		}
+
+		data = data[n:]
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package network
+
+import (
+	"context"
+	"dfs/types"
+	"time"
+)
+
+// Transport moves piece data between the client and storage nodes.
+type Transport interface {
+	// Put stores the piece on the node and returns its receipt. A non zero
+	// expiresAt tells the node to delete the piece at that time.
+	Put(ctx context.Context, node *types.Node, id types.PieceID, data []byte, expiresAt time.Time) (*types.PieceReceipt, error)
+	Get(ctx context.Context, node *types.Node, id types.PieceID) ([]byte, error)
+	// GetRange reads length bytes of the piece starting at offset. A length
+	// of zero reads to the end of the piece.
+	GetRange(ctx context.Context, node *types.Node, id types.PieceID, offset, length int64) ([]byte, error)
+	Delete(ctx context.Context, node *types.Node, id types.PieceID) error
+	Stat(ctx context.Context, node *types.Node, id types.PieceID) (*types.PieceInfo, error)
+}
+
+type orderKey struct{}
+
+// withOrder returns a context carrying the signed order that transports send
+// along with a piece request.
+func withOrder(ctx context.Context, order string) context.Context {
+	if order == "" {
+		return ctx
+	}
+
+	return context.WithValue(ctx, orderKey{}, order)
+}
+
+func orderFrom(ctx context.Context) string {
+	order, _ := ctx.Value(orderKey{}).(string)
+	return order
+}
+
+// nodeTransport picks the gRPC transport for nodes that expose a gRPC
+// address and falls back to HTTP for all others.
+type nodeTransport struct {
+	http Transport
+	grpc Transport
+}
+
+func NewNodeTransport(http, grpc Transport) Transport {
+	return &nodeTransport{
+		http: http,
+		grpc: grpc,
+	}
+}
+
+func (t *nodeTransport) pick(node *types.Node) Transport {
+	if node.GRPCAddr != "" {
+		return t.grpc
+	}
+
+	return t.http
+}
+
+func (t *nodeTransport) Put(ctx context.Context, node *types.Node, id types.PieceID, data []byte, expiresAt time.Time) (*types.PieceReceipt, error) {
+	return t.pick(node).Put(ctx, node, id, data, expiresAt)
+}
+
+func (t *nodeTransport) Get(ctx context.Context, node *types.Node, id types.PieceID) ([]byte, error) {
+	return t.pick(node).Get(ctx, node, id)
+}
+
+func (t *nodeTransport) GetRange(ctx context.Context, node *types.Node, id types.PieceID, offset, length int64) ([]byte, error) {
+	return t.pick(node).GetRange(ctx, node, id, offset, length)
+}
+
+func (t *nodeTransport) Delete(ctx context.Context, node *types.Node, id types.PieceID) error {
+	return t.pick(node).Delete(ctx, node, id)
+}
+
+func (t *nodeTransport) Stat(ctx context.Context, node *types.Node, id types.PieceID) (*types.PieceInfo, error) {
+	return t.pick(node).Stat(ctx, node, id)
+}
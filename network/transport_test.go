@@ -0,0 +1,155 @@
+package network_test
+
+import (
+	"bytes"
+	"context"
+	"dfs/erasure"
+	"dfs/hashutil"
+	"dfs/network"
+	"dfs/node"
+	"dfs/node/piecestore"
+	"dfs/types"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testTransport(t *testing.T, tr network.Transport, n *types.Node) {
+	ctx := context.Background()
+	id := types.NewPieceID()
+	data := []byte("hello world")
+
+	receipt, err := tr.Put(ctx, n, id, data, time.Time{})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if receipt.PieceID != id || receipt.Size != int64(len(data)) || !bytes.Equal(receipt.Hash, hashutil.Blake3(data)) {
+		t.Fatalf("expected a receipt for the piece, got %+v", receipt)
+	}
+
+	result, err := tr.Get(ctx, n, id)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !bytes.Equal(result, data) {
+		t.Fatalf("expected %s, got %s", data, result)
+	}
+
+	result, err = tr.GetRange(ctx, n, id, 6, 3)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if string(result) != "wor" {
+		t.Fatalf("expected wor, got %s", result)
+	}
+
+	info, err := tr.Stat(ctx, n, id)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if info.Size != int64(len(data)) {
+		t.Fatalf("expected size %d, got %d", len(data), info.Size)
+	}
+
+	if err := tr.Delete(ctx, n, id); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := tr.Stat(ctx, n, id); !errors.Is(err, types.ErrPieceNotFound) {
+		t.Fatalf("expected %v, got %v", types.ErrPieceNotFound, err)
+	}
+
+	if _, err := tr.Get(ctx, n, id); !errors.Is(err, types.ErrPieceNotFound) {
+		t.Fatalf("expected %v, got %v", types.ErrPieceNotFound, err)
+	}
+}
+
+func TestTransports(t *testing.T) {
+	t.Run("memory transport", func(t *testing.T) {
+		testTransport(t, network.NewMemoryTransport(), &types.Node{ID: types.NewNodeID()})
+	})
+
+	t.Run("dir transport", func(t *testing.T) {
+		testTransport(t, network.NewDirTransport(t.TempDir()), &types.Node{ID: types.NewNodeID()})
+	})
+
+	t.Run("http transport", func(t *testing.T) {
+		store, err := piecestore.New(t.TempDir())
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		ts := httptest.NewServer(node.NewServer(node.WithStore(store)).Handler())
+		defer ts.Close()
+
+		testTransport(t, network.NewHTTPTransport(nil), &types.Node{ID: types.NewNodeID(), HttpAddr: ts.URL})
+	})
+}
+
+func TestReadSegmentWithTransport(t *testing.T) {
+	t.Run("can read segment from memory transport", func(t *testing.T) {
+		enc := erasure.NewReedSolomonEncoder(29, 51)
+
+		data := []byte("hello world")
+
+		shards, err := enc.Encode(data)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		tr := network.NewMemoryTransport()
+
+		segment := &types.Segment{
+			ID:   types.NewSegmentID(),
+			Size: uint64(len(data)),
+		}
+
+		nodes := []*types.Node{}
+
+		for i, shard := range shards {
+			node := &types.Node{ID: types.NewNodeID()}
+			nodes = append(nodes, node)
+
+			piece := &types.Piece{
+				ID:       types.NewPieceID(),
+				Hash:     hashutil.Blake3(shard),
+				Position: uint(i),
+				NodeID:   node.ID,
+			}
+
+			// leave the first ten pieces missing
+			if i >= 10 {
+				tr.Put(context.Background(), node, piece.ID, shard, time.Time{})
+			}
+
+			segment.Pieces = append(segment.Pieces, piece)
+		}
+
+		nn := network.NewNetwork(
+			network.WithUnsignedReceipts(),
+			network.WithNodes(nodes),
+			network.WithTransport(tr),
+		)
+
+		var buf bytes.Buffer
+
+		if err := nn.ReadSegment(segment, &buf, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !bytes.Equal(buf.Bytes(), data) {
+			t.Fatalf("expected %s, got %s", data, buf.Bytes())
+		}
+	})
+}
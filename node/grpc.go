@@ -0,0 +1,221 @@
+package node
+
+import (
+	"context"
+	"dfs/node/nodepb"
+	"dfs/orders"
+	"dfs/types"
+	"errors"
+	"io"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// chunkSize is the amount of piece data sent per download message.
+const chunkSize = 256 * types.ONE_KILOBYTE
+
+func (s *Server) RegisterGRPC(g *grpc.Server) {
+	nodepb.RegisterPieceServiceServer(g, s)
+}
+
+func grpcError(err error) error {
+	if errors.Is(err, types.ErrPieceNotFound) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+
+	if errors.Is(err, types.ErrNodeFull) {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+
+	if errors.Is(err, types.ErrPieceExists) {
+		return status.Error(codes.AlreadyExists, err.Error())
+	}
+
+	if errors.Is(err, types.ErrOrderRejected) || errors.Is(err, types.ErrPieceTooLarge) {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	if errors.Is(err, types.ErrPieceMismatch) {
+		return status.Error(codes.DataLoss, err.Error())
+	}
+
+	return status.Error(codes.Internal, err.Error())
+}
+
+func parsePieceID(s string) (types.PieceID, error) {
+	id, err := types.ParsePieceID(s)
+
+	if err != nil {
+		return id, status.Error(codes.InvalidArgument, "invalid piece id")
+	}
+
+	return id, nil
+}
+
+// uploadReader turns the data messages of an upload stream into an io.Reader.
+type uploadReader struct {
+	stream nodepb.PieceService_UploadServer
+	buf    []byte
+}
+
+func (r *uploadReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		msg, err := r.stream.Recv()
+
+		if err != nil {
+			return 0, err
+		}
+
+		r.buf = msg.Data
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+
+	return n, nil
+}
+
+func (s *Server) Upload(stream nodepb.PieceService_UploadServer) error {
+	first, err := stream.Recv()
+
+	if err != nil {
+		return err
+	}
+
+	id, err := parsePieceID(first.PieceId)
+
+	if err != nil {
+		return err
+	}
+
+	order, r, err := s.checkPut(first.Order, id, &uploadReader{stream: stream, buf: first.Data})
+
+	if err != nil {
+		return grpcError(err)
+	}
+
+	// the declared size is only meaningful along with a hash
+	declared := int64(-1)
+
+	if len(first.Hash) > 0 {
+		declared = first.Size
+	}
+
+	size, hash, err := s.store.WriteUpload(id, r, s.upload(first.Order, order, types.UnixTime(first.ExpiresAt), declared, first.Hash))
+
+	if err != nil {
+		return grpcError(err)
+	}
+
+	s.record(first.Order, order, size)
+
+	receipt := s.receipt(id, hash, size)
+
+	return stream.SendAndClose(&nodepb.UploadResponse{
+		Size:      receipt.Size,
+		Hash:      receipt.Hash,
+		Signature: receipt.Signature,
+	})
+}
+
+func (s *Server) Download(req *nodepb.DownloadRequest, stream nodepb.PieceService_DownloadServer) error {
+	id, err := parsePieceID(req.PieceId)
+
+	if err != nil {
+		return err
+	}
+
+	if req.Offset < 0 || req.Length < 0 {
+		return status.Error(codes.InvalidArgument, "invalid range")
+	}
+
+	order, err := s.checkOrder(req.Order, id, orders.ActionGet)
+
+	if err != nil {
+		return grpcError(err)
+	}
+
+	f, err := s.store.Open(id)
+
+	if err != nil {
+		return grpcError(err)
+	}
+
+	defer f.Close()
+
+	var r io.Reader = io.NewSectionReader(f, req.Offset, 1<<62)
+	if req.Length > 0 {
+		r = io.LimitReader(r, req.Length)
+	}
+
+	buf := make([]byte, chunkSize)
+	sent := int64(0)
+
+	defer func() {
+		s.record(req.Order, order, sent)
+	}()
+
+	for {
+		n, err := io.ReadFull(r, buf)
+
+		if n > 0 {
+			if err := stream.Send(&nodepb.DownloadResponse{Data: buf[:n]}); err != nil {
+				return err
+			}
+
+			sent += int64(n)
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+
+		if err != nil {
+			return grpcError(err)
+		}
+	}
+}
+
+func (s *Server) Delete(ctx context.Context, req *nodepb.DeleteRequest) (*nodepb.DeleteResponse, error) {
+	id, err := parsePieceID(req.PieceId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.checkOrder(req.Order, id, orders.ActionDelete); err != nil {
+		return nil, grpcError(err)
+	}
+
+	if err := s.store.Delete(id); err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &nodepb.DeleteResponse{}, nil
+}
+
+func (s *Server) Stat(ctx context.Context, req *nodepb.StatRequest) (*nodepb.StatResponse, error) {
+	id, err := parsePieceID(req.PieceId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.checkOrder(req.Order, id, orders.ActionGet); err != nil {
+		return nil, grpcError(err)
+	}
+
+	info, err := s.store.Stat(id)
+
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &nodepb.StatResponse{
+		Size:      info.Size,
+		CreatedAt: info.CreatedAt.Unix(),
+		ExpiresAt: types.UnixSeconds(info.ExpiresAt),
+	}, nil
+}
@@ -0,0 +1,213 @@
+package node
+
+import (
+	"dfs/orders"
+	"dfs/types"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (s *Server) Handler() http.Handler {
+	r := gin.New()
+	r.Use(gin.Recovery())
+
+	r.POST("/pieces/:id", s.handlePutPiece)
+	r.GET("/pieces/:id", s.handleGetPiece)
+	r.HEAD("/pieces/:id", s.handleGetPiece)
+	r.DELETE("/pieces/:id", s.handleDeletePiece)
+	r.GET("/capacity", s.handleCapacity)
+
+	return r
+}
+
+// orderHeader carries the signed order of a request, hashHeader the hex
+// encoded Blake3 hash of an uploaded piece.
+const (
+	orderHeader = "X-Piece-Order"
+	hashHeader  = "X-Piece-Hash"
+)
+
+// abortOrder answers a request whose order was rejected, or whose upload is
+// not allowed by it.
+func abortOrder(c *gin.Context, err error) {
+	status := http.StatusForbidden
+
+	switch {
+	case errors.Is(err, types.ErrPieceExists):
+		status = http.StatusConflict
+	case errors.Is(err, types.ErrPieceTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	}
+
+	c.JSON(status, gin.H{"error": err.Error()})
+}
+
+func pieceID(c *gin.Context) (types.PieceID, bool) {
+	id, err := types.ParsePieceID(c.Param("id"))
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid piece id"})
+		return id, false
+	}
+
+	return id, true
+}
+
+func (s *Server) handlePutPiece(c *gin.Context) {
+	id, ok := pieceID(c)
+	if !ok {
+		return
+	}
+
+	encoded := c.GetHeader(orderHeader)
+
+	order, body, err := s.checkPut(encoded, id, c.Request.Body)
+
+	if err != nil {
+		abortOrder(c, err)
+		return
+	}
+
+	// refuse pieces that won't fit before reading them
+	if !s.store.HasRoom(max(c.Request.ContentLength, 0)) {
+		c.JSON(http.StatusInsufficientStorage, gin.H{"error": types.ErrNodeFull.Error()})
+		return
+	}
+
+	var expiresAt int64
+
+	if header := c.GetHeader("X-Piece-Expires-At"); header != "" {
+		expiresAt, err = strconv.ParseInt(header, 10, 64)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid expiration time"})
+			return
+		}
+	}
+
+	// clients declare the hash of the piece, and its size with the
+	// content length, so that a broken upload is never stored
+	var declared []byte
+
+	if header := c.GetHeader(hashHeader); header != "" {
+		declared, err = hex.DecodeString(header)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid piece hash"})
+			return
+		}
+	}
+
+	size, hash, err := s.store.WriteUpload(id, body, s.upload(encoded, order, types.UnixTime(expiresAt), c.Request.ContentLength, declared))
+
+	if errors.Is(err, types.ErrNodeFull) {
+		c.JSON(http.StatusInsufficientStorage, gin.H{"error": err.Error()})
+		return
+	}
+
+	if errors.Is(err, types.ErrPieceMismatch) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	if errors.Is(err, types.ErrPieceTooLarge) {
+		abortOrder(c, err)
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.record(encoded, order, size)
+
+	c.JSON(http.StatusOK, s.receipt(id, hash, size))
+}
+
+func (s *Server) handleGetPiece(c *gin.Context) {
+	id, ok := pieceID(c)
+	if !ok {
+		return
+	}
+
+	encoded := c.GetHeader(orderHeader)
+
+	order, err := s.checkOrder(encoded, id, orders.ActionGet)
+
+	if err != nil {
+		abortOrder(c, err)
+		return
+	}
+
+	f, err := s.store.Open(id)
+
+	if errors.Is(err, types.ErrPieceNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	defer f.Close()
+
+	info, err := s.store.Stat(id)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("X-Piece-Created-At", strconv.FormatInt(info.CreatedAt.Unix(), 10))
+
+	if !info.ExpiresAt.IsZero() {
+		c.Header("X-Piece-Expires-At", strconv.FormatInt(info.ExpiresAt.Unix(), 10))
+	}
+
+	// ServeContent takes care of HEAD and Range requests.
+	http.ServeContent(c.Writer, c.Request, "", info.CreatedAt, f)
+
+	s.record(encoded, order, int64(c.Writer.Size()))
+}
+
+func (s *Server) handleDeletePiece(c *gin.Context) {
+	id, ok := pieceID(c)
+	if !ok {
+		return
+	}
+
+	if _, err := s.checkOrder(c.GetHeader(orderHeader), id, orders.ActionDelete); err != nil {
+		abortOrder(c, err)
+		return
+	}
+
+	err := s.store.Delete(id)
+
+	if errors.Is(err, types.ErrPieceNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func (s *Server) handleCapacity(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"capacity": s.store.Capacity(),
+		"used":     s.store.Used(),
+		"free":     s.store.Free(),
+	})
+}
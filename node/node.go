@@ -0,0 +1,145 @@
+package node
+
+import (
+	"crypto/ed25519"
+	"dfs/identity"
+	"dfs/node/nodepb"
+	"dfs/node/piecestore"
+	"dfs/orders"
+	"dfs/types"
+	"errors"
+	"io"
+	"time"
+)
+
+// Server is a storage node. It serves the pieces kept in its store over both
+// the HTTP /pieces API and the gRPC piece service.
+type Server struct {
+	nodepb.UnimplementedPieceServiceServer
+
+	store *piecestore.Store
+
+	id       types.NodeID
+	key      ed25519.PrivateKey
+	orderKey ed25519.PublicKey
+
+	usage usage
+}
+
+func WithStore(store *piecestore.Store) func(*Server) {
+	return func(s *Server) {
+		s.store = store
+	}
+}
+
+// WithIdentity makes key the identity of the node, its ID is derived from
+// it. The node signs the receipts of the pieces it stores with key.
+func WithIdentity(key ed25519.PrivateKey) func(*Server) {
+	return func(s *Server) {
+		s.id = identity.NodeID(key.Public().(ed25519.PublicKey))
+		s.key = key
+	}
+}
+
+// WithOrderKey makes the node only serve requests that carry an order signed
+// with the private half of key. Orders name the node by its ID, so the node
+// needs an identity too.
+func WithOrderKey(key ed25519.PublicKey) func(*Server) {
+	return func(s *Server) {
+		s.orderKey = key
+	}
+}
+
+// ID returns the ID of the node, zero if it has no identity.
+func (s *Server) ID() types.NodeID {
+	return s.id
+}
+
+// receipt returns the receipt for a piece the node stored, signed if the node
+// has an identity.
+func (s *Server) receipt(id types.PieceID, hash []byte, size int64) *types.PieceReceipt {
+	r := &types.PieceReceipt{PieceID: id, Hash: hash, Size: size}
+
+	if s.key != nil {
+		identity.SignReceipt(r, s.key)
+	}
+
+	return r
+}
+
+func NewServer(opts ...func(*Server)) *Server {
+	s := &Server{usage: usage{served: map[string]*served{}}}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// checkOrder verifies the order sent for action on the piece. Nodes without
+// an order key accept every request and return a nil order.
+func (s *Server) checkOrder(encoded string, id types.PieceID, action orders.Action) (*orders.Order, error) {
+	if s.orderKey == nil {
+		return nil, nil
+	}
+
+	if encoded == "" {
+		return nil, types.ErrOrderRejected
+	}
+
+	o, err := orders.Check(encoded, s.orderKey, s.id, id, action, time.Now())
+
+	if err != nil {
+		return nil, errors.Join(types.ErrOrderRejected, err)
+	}
+
+	return o, nil
+}
+
+// upload describes a piece being uploaded with the given order to the store.
+func (s *Server) upload(encoded string, order *orders.Order, expiresAt time.Time, size int64, hash []byte) piecestore.Upload {
+	up := piecestore.Upload{ExpiresAt: expiresAt, Size: size, Hash: hash}
+
+	if order != nil {
+		up.Order = encoded
+		up.Satellite = s.orderKey
+	}
+
+	return up
+}
+
+// checkPut checks the order of an upload and wraps r so that reading more
+// than the order allows fails. Pieces can't be overwritten with an order,
+// that would let any client that may upload replace the data of others.
+func (s *Server) checkPut(encoded string, id types.PieceID, r io.Reader) (*orders.Order, io.Reader, error) {
+	o, err := s.checkOrder(encoded, id, orders.ActionPut)
+
+	if err != nil || o == nil {
+		return nil, r, err
+	}
+
+	if _, err := s.store.Stat(id); err == nil {
+		return nil, nil, types.ErrPieceExists
+	}
+
+	return o, &limitReader{r: r, n: o.MaxSize}, nil
+}
+
+// limitReader fails with types.ErrPieceTooLarge once more than n bytes were
+// read.
+type limitReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+
+	if l.n < 0 {
+		return n, types.ErrPieceTooLarge
+	}
+
+	return n, err
+}
@@ -0,0 +1,728 @@
+package node_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"dfs/hashutil"
+	"dfs/node"
+	"dfs/node/piecestore"
+	"dfs/orders"
+	"dfs/types"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	store, err := piecestore.New(t.TempDir())
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ts := httptest.NewServer(node.NewServer(node.WithStore(store)).Handler())
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+func TestHTTPPieces(t *testing.T) {
+	t.Run("can write, read and delete a piece", func(t *testing.T) {
+		ts := newTestServer(t)
+		url := ts.URL + "/pieces/" + types.NewPieceID().String()
+		data := []byte("hello world")
+
+		res, err := http.Post(url, "application/octet-stream", bytes.NewReader(data))
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", res.StatusCode)
+		}
+
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Header.Set("Range", "bytes=6-")
+
+		res, err = http.DefaultClient.Do(req)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusPartialContent || string(body) != "world" {
+			t.Fatalf("expected partial content \"world\", got %d %q", res.StatusCode, body)
+		}
+
+		req, _ = http.NewRequest("DELETE", url, nil)
+
+		res, err = http.DefaultClient.Do(req)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		res.Body.Close()
+
+		res, err = http.Get(url)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusNotFound {
+			t.Fatalf("expected status 404, got %d", res.StatusCode)
+		}
+	})
+
+	t.Run("rejects invalid piece ids", func(t *testing.T) {
+		ts := newTestServer(t)
+
+		res, err := http.Get(ts.URL + "/pieces/not-a-uuid")
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d", res.StatusCode)
+		}
+	})
+}
+
+func TestDurableWrites(t *testing.T) {
+	t.Run("refuses pieces that don't match their declared hash", func(t *testing.T) {
+		store, err := piecestore.New(t.TempDir())
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		ts := httptest.NewServer(node.NewServer(node.WithStore(store)).Handler())
+		defer ts.Close()
+
+		id := types.NewPieceID()
+		req, _ := http.NewRequest("POST", ts.URL+"/pieces/"+id.String(), bytes.NewReader([]byte("hello w0rld")))
+		req.Header.Set("X-Piece-Hash", hex.EncodeToString(hashutil.Blake3([]byte("hello world"))))
+
+		res, err := http.DefaultClient.Do(req)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusUnprocessableEntity {
+			t.Fatalf("expected status 422, got %d", res.StatusCode)
+		}
+
+		if _, err := store.Stat(id); !errors.Is(err, types.ErrPieceNotFound) {
+			t.Fatalf("expected %v, got %v", types.ErrPieceNotFound, err)
+		}
+
+		if store.Used() != 0 {
+			t.Fatalf("expected the refused piece to free its space, %d bytes used", store.Used())
+		}
+	})
+
+	t.Run("keeps the metadata of the data an interrupted overwrite left", func(t *testing.T) {
+		first, second := []byte("first version"), []byte("second version")
+
+		// an overwrite crashing before or after the new data was renamed
+		// into place leaves the new metadata pending
+		for _, data := range [][]byte{first, second} {
+			dir := t.TempDir()
+
+			store, err := piecestore.New(dir)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			id := types.NewPieceID()
+			name := id.String()
+			path := filepath.Join(dir, name[:2], name)
+
+			if _, _, err := store.Write(id, bytes.NewReader(first), time.Time{}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			old, err := os.ReadFile(path + ".meta")
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if _, _, err := store.Write(id, bytes.NewReader(second), time.Time{}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if err := store.Close(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if err := os.Rename(path+".meta", path+".meta.new"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for file, content := range map[string][]byte{path: data, path + ".meta": old} {
+				if err := os.WriteFile(file, content, 0o644); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			// a crash leaves the old piece in the index, rebuilt from its metadata
+			if err := os.Remove(filepath.Join(dir, "pieces.db")); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			store, err = piecestore.New(dir)
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if hash, err := store.Hash(id); err != nil || !bytes.Equal(hash, hashutil.Blake3(data)) {
+				t.Fatalf("expected the hash of %s, got %x, %v", data, hash, err)
+			}
+
+			if corrupted, err := piecestore.NewScanner(store).Scan(); err != nil || len(corrupted) != 0 {
+				t.Fatalf("expected no corrupted pieces, got %v, %v", corrupted, err)
+			}
+
+			if _, err := os.Stat(path + ".meta.new"); !errors.Is(err, fs.ErrNotExist) {
+				t.Fatalf("expected the pending metadata to be settled, got %v", err)
+			}
+
+			store.Close()
+		}
+	})
+
+	t.Run("removes what interrupted writes left behind on open", func(t *testing.T) {
+		dir := t.TempDir()
+
+		store, err := piecestore.New(dir)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		kept := types.NewPieceID()
+
+		if _, _, err := store.Write(kept, bytes.NewReader([]byte("hello world")), time.Time{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		name := kept.String()
+		lost := types.NewPieceID().String()
+		leftovers := []string{
+			filepath.Join(dir, name[:2], name+".123.tmp"),
+			filepath.Join(dir, lost[:2], lost+".meta"),
+		}
+
+		for _, path := range leftovers {
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if err := os.WriteFile(path, []byte("partial"), 0o644); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		if err := store.Close(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		store, err = piecestore.New(dir)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for _, path := range leftovers {
+			if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+				t.Fatalf("expected %s to be removed, got %v", path, err)
+			}
+		}
+
+		if store.Used() != int64(len("hello world")) {
+			t.Fatalf("expected only the piece to be counted, %d bytes used", store.Used())
+		}
+
+		if hash, err := store.Hash(kept); err != nil || hash == nil {
+			t.Fatalf("expected the hash of the piece to be kept, got %x, %v", hash, err)
+		}
+	})
+}
+
+func TestCapacity(t *testing.T) {
+	t.Run("rejects pieces once the store is full", func(t *testing.T) {
+		store, err := piecestore.New(t.TempDir(), piecestore.WithCapacity(16))
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		ts := httptest.NewServer(node.NewServer(node.WithStore(store)).Handler())
+		t.Cleanup(ts.Close)
+
+		url := ts.URL + "/pieces/" + types.NewPieceID().String()
+
+		res, err := http.Post(url, "application/octet-stream", bytes.NewReader(make([]byte, 10)))
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", res.StatusCode)
+		}
+
+		res, err = http.Post(ts.URL+"/pieces/"+types.NewPieceID().String(), "application/octet-stream", bytes.NewReader(make([]byte, 10)))
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusInsufficientStorage {
+			t.Fatalf("expected status 507, got %d", res.StatusCode)
+		}
+
+		if store.Used() != 10 || store.Free() != 6 {
+			t.Fatalf("expected 10 bytes used and 6 free, got %d and %d", store.Used(), store.Free())
+		}
+
+		req, _ := http.NewRequest("DELETE", url, nil)
+
+		res, err = http.DefaultClient.Do(req)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		res.Body.Close()
+
+		if store.Used() != 0 {
+			t.Fatalf("expected deleting to free the space, %d bytes used", store.Used())
+		}
+	})
+
+	t.Run("counts the pieces already stored on open", func(t *testing.T) {
+		dir := t.TempDir()
+
+		store, err := piecestore.New(dir)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		id := types.NewPieceID()
+
+		if _, _, err := store.Write(id, bytes.NewReader(make([]byte, 100)), time.Time{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// writing a piece again replaces it
+		if _, _, err := store.Write(id, bytes.NewReader(make([]byte, 50)), time.Time{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if store.Used() != 50 {
+			t.Fatalf("expected 50 bytes used, got %d", store.Used())
+		}
+
+		if err := store.Close(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		store, err = piecestore.New(dir, piecestore.WithCapacity(60))
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if store.Used() != 50 {
+			t.Fatalf("expected 50 bytes used after reopening, got %d", store.Used())
+		}
+
+		_, _, err = store.Write(types.NewPieceID(), bytes.NewReader(make([]byte, 20)), time.Time{})
+
+		if !errors.Is(err, types.ErrNodeFull) {
+			t.Fatalf("expected ErrNodeFull, got %v", err)
+		}
+
+		if store.Used() != 50 {
+			t.Fatalf("expected a rejected piece to free its space, %d bytes used", store.Used())
+		}
+	})
+}
+
+func TestExpiration(t *testing.T) {
+	t.Run("deletes pieces once they expire", func(t *testing.T) {
+		store, err := piecestore.New(t.TempDir())
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+		temp := types.NewPieceID()
+		kept := types.NewPieceID()
+
+		if _, _, err := store.Write(temp, bytes.NewReader([]byte("temporary")), expiresAt); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, _, err := store.Write(kept, bytes.NewReader([]byte("kept")), time.Time{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		info, err := store.Stat(temp)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !info.ExpiresAt.Equal(expiresAt) {
+			t.Fatalf("expected the piece to expire at %v, got %v", expiresAt, info.ExpiresAt)
+		}
+
+		if n, err := store.DeleteExpired(time.Now()); err != nil || n != 0 {
+			t.Fatalf("expected no piece to expire yet, got %d, %v", n, err)
+		}
+
+		if n, err := store.DeleteExpired(expiresAt); err != nil || n != 1 {
+			t.Fatalf("expected 1 piece to expire, got %d, %v", n, err)
+		}
+
+		if _, err := store.Stat(temp); !errors.Is(err, types.ErrPieceNotFound) {
+			t.Fatalf("expected %v, got %v", types.ErrPieceNotFound, err)
+		}
+
+		if _, err := store.Stat(kept); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if store.Used() != int64(len("kept")) {
+			t.Fatalf("expected only the kept piece to be counted, %d bytes used", store.Used())
+		}
+	})
+
+	t.Run("stops serving pieces once they expire", func(t *testing.T) {
+		store, err := piecestore.New(t.TempDir())
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		id := types.NewPieceID()
+		expiresAt := time.Now().Add(100 * time.Millisecond)
+
+		if _, _, err := store.Write(id, bytes.NewReader([]byte("temporary")), expiresAt); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		f, err := store.Open(id)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		f.Close()
+
+		time.Sleep(time.Until(expiresAt))
+
+		if _, err := store.Open(id); !errors.Is(err, types.ErrPieceNotFound) {
+			t.Fatalf("expected %v, got %v", types.ErrPieceNotFound, err)
+		}
+	})
+}
+
+func TestPieceIndex(t *testing.T) {
+	t.Run("finds pieces by expiration and creation time", func(t *testing.T) {
+		store, err := piecestore.New(t.TempDir())
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		now := time.Now().Truncate(time.Second)
+		later := types.NewPieceID()
+		sooner := types.NewPieceID()
+		kept := types.NewPieceID()
+
+		if _, _, err := store.Write(later, bytes.NewReader([]byte("later")), now.Add(2*time.Hour)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, _, err := store.Write(sooner, bytes.NewReader([]byte("sooner")), now.Add(time.Hour)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, _, err := store.Write(kept, bytes.NewReader([]byte("kept")), time.Time{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expiring, err := store.ExpiringUntil(now.Add(2 * time.Hour))
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(expiring) != 2 || expiring[0].ID != sooner || expiring[1].ID != later {
+			t.Fatalf("expected the expiring pieces soonest first, got %+v", expiring)
+		}
+
+		created, err := store.CreatedUntil(time.Now())
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(created) != 3 || created[0].ID != later || created[2].ID != kept {
+			t.Fatalf("expected all pieces oldest first, got %+v", created)
+		}
+	})
+
+	t.Run("rebuilds a lost index from the pieces on disk", func(t *testing.T) {
+		dir := t.TempDir()
+
+		store, err := piecestore.New(dir)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+		id := types.NewPieceID()
+
+		_, hash, err := store.Write(id, bytes.NewReader([]byte("hello world")), expiresAt)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := store.Close(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := os.WriteFile(filepath.Join(dir, "pieces.db"), []byte("garbage"), 0o644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := piecestore.New(dir); err == nil {
+			t.Fatalf("expected a damaged index to fail to open")
+		}
+
+		if n, err := piecestore.Rebuild(dir); err != nil || n != 1 {
+			t.Fatalf("expected 1 piece in the index, got %d, %v", n, err)
+		}
+
+		store, err = piecestore.New(dir)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		defer store.Close()
+
+		info, err := store.Stat(id)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !info.ExpiresAt.Equal(expiresAt) || !bytes.Equal(info.Hash, hash) || info.Size != int64(len("hello world")) {
+			t.Fatalf("expected the metadata of the piece to be kept, got %+v", info)
+		}
+
+		if n, err := store.DeleteExpired(expiresAt); err != nil || n != 1 {
+			t.Fatalf("expected 1 piece to expire, got %d, %v", n, err)
+		}
+	})
+}
+
+func TestScanner(t *testing.T) {
+	t.Run("quarantines pieces that no longer match their hash", func(t *testing.T) {
+		dir := t.TempDir()
+
+		store, err := piecestore.New(dir)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		rotten := types.NewPieceID()
+		healthy := types.NewPieceID()
+
+		for _, id := range []types.PieceID{rotten, healthy} {
+			if _, _, err := store.Write(id, bytes.NewReader([]byte("hello world")), time.Time{}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		name := rotten.String()
+
+		if err := os.WriteFile(filepath.Join(dir, name[:2], name), []byte("hello w0rld"), 0o644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		corrupted, err := piecestore.NewScanner(store, piecestore.WithScanRate(types.ONE_MEGABYTE)).Scan()
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(corrupted) != 1 || corrupted[0] != rotten {
+			t.Fatalf("expected %s to be corrupted, got %v", rotten, corrupted)
+		}
+
+		if _, err := store.Stat(rotten); !errors.Is(err, types.ErrPieceNotFound) {
+			t.Fatalf("expected %v, got %v", types.ErrPieceNotFound, err)
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, "quarantine", name)); err != nil {
+			t.Fatalf("expected the piece to be quarantined: %v", err)
+		}
+
+		if store.Used() != int64(len("hello world")) {
+			t.Fatalf("expected only the healthy piece to be counted, %d bytes used", store.Used())
+		}
+
+		if corrupted, err := piecestore.NewScanner(store).Scan(); err != nil || len(corrupted) != 0 {
+			t.Fatalf("expected no corrupted pieces left, got %v, %v", corrupted, err)
+		}
+	})
+}
+
+func TestOrders(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, nodeKey, err := ed25519.GenerateKey(nil)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	store, err := piecestore.New(t.TempDir())
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	srv := node.NewServer(node.WithStore(store), node.WithIdentity(nodeKey), node.WithOrderKey(pub))
+	nodeID := srv.ID()
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	sign := func(id types.PieceID, nodeID types.NodeID, action orders.Action, maxSize int64) string {
+		return orders.Sign(&orders.Order{
+			PieceID: id,
+			NodeID:  nodeID,
+			Action:  action,
+			MaxSize: maxSize,
+			Expires: time.Now().Add(time.Hour),
+		}, priv)
+	}
+
+	send := func(method string, id types.PieceID, order string, body []byte) int {
+		req, _ := http.NewRequest(method, ts.URL+"/pieces/"+id.String(), bytes.NewReader(body))
+
+		if order != "" {
+			req.Header.Set("X-Piece-Order", order)
+		}
+
+		res, err := http.DefaultClient.Do(req)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		res.Body.Close()
+
+		return res.StatusCode
+	}
+
+	data := []byte("hello world")
+
+	t.Run("serves requests with a valid order", func(t *testing.T) {
+		id := types.NewPieceID()
+
+		if status := send("POST", id, sign(id, nodeID, orders.ActionPut, int64(len(data))), data); status != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", status)
+		}
+
+		if status := send("GET", id, sign(id, nodeID, orders.ActionGet, 0), nil); status != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", status)
+		}
+
+		if status := send("DELETE", id, sign(id, nodeID, orders.ActionDelete, 0), nil); status != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", status)
+		}
+	})
+
+	t.Run("rejects missing and mismatched orders", func(t *testing.T) {
+		id := types.NewPieceID()
+
+		if status := send("POST", id, "", data); status != http.StatusForbidden {
+			t.Fatalf("expected status 403, got %d", status)
+		}
+
+		if status := send("POST", id, sign(id, types.NewNodeID(), orders.ActionPut, 100), data); status != http.StatusForbidden {
+			t.Fatalf("expected status 403 for another node, got %d", status)
+		}
+
+		if status := send("POST", id, sign(types.NewPieceID(), nodeID, orders.ActionPut, 100), data); status != http.StatusForbidden {
+			t.Fatalf("expected status 403 for another piece, got %d", status)
+		}
+
+		if status := send("POST", id, sign(id, nodeID, orders.ActionPut, 100), data); status != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", status)
+		}
+
+		if status := send("GET", id, sign(id, nodeID, orders.ActionDelete, 0), nil); status != http.StatusForbidden {
+			t.Fatalf("expected status 403 for another action, got %d", status)
+		}
+
+		if status := send("DELETE", id, "", nil); status != http.StatusForbidden {
+			t.Fatalf("expected status 403, got %d", status)
+		}
+	})
+
+	t.Run("refuses to overwrite pieces and uploads larger than the order", func(t *testing.T) {
+		id := types.NewPieceID()
+
+		if status := send("POST", id, sign(id, nodeID, orders.ActionPut, 5), data); status != http.StatusRequestEntityTooLarge {
+			t.Fatalf("expected status 413, got %d", status)
+		}
+
+		if status := send("POST", id, sign(id, nodeID, orders.ActionPut, 100), data); status != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", status)
+		}
+
+		if status := send("POST", id, sign(id, nodeID, orders.ActionPut, 100), []byte("replaced")); status != http.StatusConflict {
+			t.Fatalf("expected status 409, got %d", status)
+		}
+	})
+}
@@ -0,0 +1,5 @@
+// Package nodepb holds the protobuf messages and gRPC service of the storage
+// node piece service, generated from piece.proto.
+package nodepb
+
+//go:generate protoc -I ../.. --go_out=../.. --go_opt=paths=source_relative --go-grpc_out=../.. --go-grpc_opt=paths=source_relative node/nodepb/piece.proto
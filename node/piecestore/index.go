@@ -0,0 +1,190 @@
+package piecestore
+
+import (
+	"bytes"
+	"dfs/types"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// indexFile is the name of the piece index below the store directory.
+const indexFile = "pieces.db"
+
+var (
+	piecesBucket  = []byte("pieces")
+	expiresBucket = []byte("expires")
+	createdBucket = []byte("created")
+)
+
+// index keeps the metadata of every piece in a bolt database, keyed by piece
+// ID. The expires and created buckets order the pieces by time, their keys
+// are the big endian unix nanoseconds followed by the piece ID.
+type index struct {
+	db *bolt.DB
+}
+
+func openIndex(path string) (*index, error) {
+	db, err := bolt.Open(path, 0o644, &bolt.Options{Timeout: time.Second})
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{piecesBucket, expiresBucket, createdBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &index{db: db}, nil
+}
+
+func (x *index) close() error {
+	return x.db.Close()
+}
+
+func timeKey(t time.Time, id types.PieceID) []byte {
+	key := binary.BigEndian.AppendUint64(nil, uint64(t.UnixNano()))
+	return append(key, id[:]...)
+}
+
+// put records the piece, replacing what was recorded for it before.
+func (x *index) put(info *types.PieceInfo) error {
+	value, err := json.Marshal(info)
+
+	if err != nil {
+		return err
+	}
+
+	return x.db.Update(func(tx *bolt.Tx) error {
+		if err := remove(tx, info.ID); err != nil {
+			return err
+		}
+
+		if err := tx.Bucket(piecesBucket).Put(info.ID[:], value); err != nil {
+			return err
+		}
+
+		if !info.ExpiresAt.IsZero() {
+			if err := tx.Bucket(expiresBucket).Put(timeKey(info.ExpiresAt, info.ID), nil); err != nil {
+				return err
+			}
+		}
+
+		return tx.Bucket(createdBucket).Put(timeKey(info.CreatedAt, info.ID), nil)
+	})
+}
+
+// remove deletes the piece and its time keys in tx.
+func remove(tx *bolt.Tx, id types.PieceID) error {
+	pieces := tx.Bucket(piecesBucket)
+	value := pieces.Get(id[:])
+
+	if value == nil {
+		return nil
+	}
+
+	var info types.PieceInfo
+
+	if err := json.Unmarshal(value, &info); err != nil {
+		return err
+	}
+
+	if !info.ExpiresAt.IsZero() {
+		if err := tx.Bucket(expiresBucket).Delete(timeKey(info.ExpiresAt, id)); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Bucket(createdBucket).Delete(timeKey(info.CreatedAt, id)); err != nil {
+		return err
+	}
+
+	return pieces.Delete(id[:])
+}
+
+func (x *index) delete(id types.PieceID) error {
+	return x.db.Update(func(tx *bolt.Tx) error {
+		return remove(tx, id)
+	})
+}
+
+// get returns the recorded metadata of the piece, types.ErrPieceNotFound if
+// there is none.
+func (x *index) get(id types.PieceID) (*types.PieceInfo, error) {
+	var info *types.PieceInfo
+
+	err := x.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(piecesBucket).Get(id[:])
+
+		if value == nil {
+			return types.ErrPieceNotFound
+		}
+
+		info = &types.PieceInfo{}
+		return json.Unmarshal(value, info)
+	})
+
+	return info, err
+}
+
+// ids returns the IDs of all recorded pieces.
+func (x *index) ids() ([]types.PieceID, error) {
+	var ids []types.PieceID
+
+	err := x.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(piecesBucket).ForEach(func(k, _ []byte) error {
+			var id types.PieceID
+			copy(id[:], k)
+			ids = append(ids, id)
+			return nil
+		})
+	})
+
+	return ids, err
+}
+
+// until returns the pieces of the time ordered bucket whose time is at or
+// before t, oldest first.
+func (x *index) until(bucket []byte, t time.Time) ([]*types.PieceInfo, error) {
+	var infos []*types.PieceInfo
+
+	end := binary.BigEndian.AppendUint64(nil, uint64(t.UnixNano()))
+
+	err := x.db.View(func(tx *bolt.Tx) error {
+		pieces := tx.Bucket(piecesBucket)
+		c := tx.Bucket(bucket).Cursor()
+
+		for k, _ := c.First(); k != nil && bytes.Compare(k[:8], end) <= 0; k, _ = c.Next() {
+			value := pieces.Get(k[8:])
+
+			if value == nil {
+				continue
+			}
+
+			var info types.PieceInfo
+
+			if err := json.Unmarshal(value, &info); err != nil {
+				return err
+			}
+
+			infos = append(infos, &info)
+		}
+
+		return nil
+	})
+
+	return infos, err
+}
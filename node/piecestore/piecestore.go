@@ -0,0 +1,705 @@
+package piecestore
+
+import (
+	"bytes"
+	"dfs/types"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zeebo/blake3"
+)
+
+// Store keeps piece data as plain files below a directory, fanned out by the
+// first two characters of the piece ID. The metadata of a piece, its size,
+// hash, creation and expiration time and the order it was uploaded with, is
+// kept next to it in a file with the metaSuffix and recorded in the index,
+// which finds pieces by expiration and creation time. The files are what
+// counts, the index is brought in line with them when the store is opened.
+//
+// Pieces are written to a temporary file that is synced and renamed into
+// place once complete, so a crash never leaves a partial piece behind.
+type Store struct {
+	dir      string
+	capacity int64
+	index    *index
+
+	mu   sync.Mutex
+	used int64
+}
+
+// WithCapacity limits the store to bytes of piece data. Writes that would
+// exceed it fail with types.ErrNodeFull.
+func WithCapacity(bytes int64) func(*Store) {
+	return func(s *Store) {
+		s.capacity = bytes
+	}
+}
+
+// New opens the store in dir, adding up the pieces already kept there and
+// removing what interrupted writes left behind. Pieces missing from the index
+// are added to it, so a lost index is rebuilt.
+func New(dir string, opts ...func(*Store)) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &Store{dir: dir}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	x, err := openIndex(filepath.Join(dir, indexFile))
+
+	if err != nil {
+		return nil, fmt.Errorf("could not open the piece index: %w", err)
+	}
+
+	s.index = x
+
+	used, pieces, err := s.scan()
+
+	if err == nil {
+		err = s.settle()
+	}
+
+	if err == nil {
+		err = s.reconcile(pieces)
+	}
+
+	if err != nil {
+		x.close()
+		return nil, err
+	}
+
+	s.used = used
+
+	return s, nil
+}
+
+// Rebuild replaces the piece index in dir with one built from the pieces on
+// disk and returns how many pieces it holds. It is for indexes that were
+// damaged, the store must not be open.
+func Rebuild(dir string) (int, error) {
+	if err := os.Remove(filepath.Join(dir, indexFile)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, err
+	}
+
+	s, err := New(dir)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer s.Close()
+
+	ids, err := s.index.ids()
+
+	return len(ids), err
+}
+
+// Close closes the index.
+func (s *Store) Close() error {
+	return s.index.close()
+}
+
+const (
+	metaSuffix = ".meta"
+	tempSuffix = ".tmp"
+
+	// pendingSuffix is the metadata of a piece being written, renamed to the
+	// metaSuffix once the piece is in place.
+	pendingSuffix = ".meta.new"
+
+	// expiresSuffix and hashSuffix are the files the expiration and hash of
+	// a piece were kept in before there was a metadata file.
+	expiresSuffix = ".expires"
+	hashSuffix    = ".hash"
+)
+
+// scan returns the size and IDs of the pieces in the fan out directories. It
+// removes temporary files and the metadata of pieces that are gone.
+func (s *Store) scan() (int64, map[types.PieceID]bool, error) {
+	var used int64
+
+	dirs, err := os.ReadDir(s.dir)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	ids := make(map[types.PieceID]bool)
+
+	for _, d := range dirs {
+		if !d.IsDir() || len(d.Name()) != 2 {
+			continue
+		}
+
+		dir := filepath.Join(s.dir, d.Name())
+
+		entries, err := os.ReadDir(dir)
+
+		if err != nil {
+			return 0, nil, err
+		}
+
+		pieces := make(map[string]bool, len(entries))
+
+		for _, entry := range entries {
+			fi, err := entry.Info()
+
+			if err != nil {
+				return 0, nil, err
+			}
+
+			if id, err := types.ParsePieceID(entry.Name()); err == nil && fi.Mode().IsRegular() {
+				pieces[entry.Name()] = true
+				ids[id] = true
+				used += fi.Size()
+			}
+		}
+
+		for _, entry := range entries {
+			name := entry.Name()
+			piece := name
+
+			for _, suffix := range []string{pendingSuffix, metaSuffix, expiresSuffix, hashSuffix} {
+				piece = strings.TrimSuffix(piece, suffix)
+			}
+
+			if strings.HasSuffix(name, tempSuffix) || piece != name && !pieces[piece] {
+				if err := os.Remove(filepath.Join(dir, name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+					return 0, nil, err
+				}
+			}
+		}
+	}
+
+	return used, ids, nil
+}
+
+// settle finishes the writes that were interrupted between renaming a piece
+// into place and renaming its metadata. The pending metadata is kept if it
+// matches the piece on disk, otherwise the piece is the one written before.
+func (s *Store) settle() error {
+	pending, err := filepath.Glob(filepath.Join(s.dir, "*", "*"+pendingSuffix))
+
+	if err != nil {
+		return err
+	}
+
+	for _, name := range pending {
+		path := strings.TrimSuffix(name, pendingSuffix)
+		info, err := readInfo(name)
+
+		if err != nil {
+			return err
+		}
+
+		ok, err := matches(path, info)
+
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			if err := os.Remove(name); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := os.Rename(name, path+metaSuffix); err != nil {
+			return err
+		}
+
+		if err := s.index.put(info); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// matches reports whether the file at path has the size and hash of info.
+func matches(path string, info *types.PieceInfo) (bool, error) {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return false, err
+	}
+
+	defer f.Close()
+
+	hasher := blake3.New()
+	n, err := io.Copy(hasher, f)
+
+	if err != nil {
+		return false, err
+	}
+
+	return n == info.Size && bytes.Equal(hasher.Sum(nil), info.Hash), nil
+}
+
+// reconcile brings the index in line with the pieces on disk. Pieces that
+// are gone are dropped from it, pieces it misses are added from their
+// metadata files.
+func (s *Store) reconcile(pieces map[types.PieceID]bool) error {
+	indexed, err := s.index.ids()
+
+	if err != nil {
+		return err
+	}
+
+	known := make(map[types.PieceID]bool, len(indexed))
+
+	for _, id := range indexed {
+		known[id] = true
+
+		if !pieces[id] {
+			if err := s.index.delete(id); err != nil {
+				return err
+			}
+		}
+	}
+
+	for id := range pieces {
+		if known[id] {
+			continue
+		}
+
+		info, err := s.readMeta(id)
+
+		if err != nil {
+			return err
+		}
+
+		if err := s.index.put(info); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readMeta reads the metadata file of the piece. Pieces stored before there
+// were metadata files get one made up from the file and the expiration and
+// hash kept next to it.
+func (s *Store) readMeta(id types.PieceID) (*types.PieceInfo, error) {
+	path := s.path(id)
+
+	info, err := readInfo(path + metaSuffix)
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		return info, err
+	}
+
+	fi, err := os.Stat(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	info = &types.PieceInfo{ID: id, Size: fi.Size(), CreatedAt: fi.ModTime()}
+
+	if data, err := os.ReadFile(path + expiresSuffix); err == nil {
+		sec, err := strconv.ParseInt(string(data), 10, 64)
+
+		if err != nil {
+			return nil, err
+		}
+
+		info.ExpiresAt = time.Unix(sec, 0)
+	}
+
+	if data, err := os.ReadFile(path + hashSuffix); err == nil {
+		info.Hash, _ = hex.DecodeString(string(data))
+	}
+
+	if err := writeInfo(path+metaSuffix, info); err != nil {
+		return nil, err
+	}
+
+	for _, suffix := range []string{expiresSuffix, hashSuffix} {
+		if err := os.Remove(path + suffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	return info, nil
+}
+
+func readInfo(path string) (*types.PieceInfo, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var info types.PieceInfo
+
+	return &info, json.Unmarshal(data, &info)
+}
+
+func writeInfo(path string, info *types.PieceInfo) error {
+	data, err := json.Marshal(info)
+
+	if err != nil {
+		return err
+	}
+
+	return writeFile(path, data)
+}
+
+// Capacity is the number of bytes the store may hold, 0 if it is not limited.
+func (s *Store) Capacity() int64 {
+	return s.capacity
+}
+
+// Used is the number of bytes of piece data in the store.
+func (s *Store) Used() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.used
+}
+
+// Free is the number of bytes left, only meaningful if the capacity is
+// limited.
+func (s *Store) Free() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return max(s.capacity-s.used, 0)
+}
+
+// HasRoom reports whether size more bytes fit in the store.
+func (s *Store) HasRoom(size int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.capacity == 0 || s.used+size <= s.capacity
+}
+
+// reserve takes n bytes of the capacity for a piece being written.
+func (s *Store) reserve(n int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.capacity > 0 && s.used+n > s.capacity {
+		return types.ErrNodeFull
+	}
+
+	s.used += n
+
+	return nil
+}
+
+func (s *Store) release(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.used -= n
+}
+
+// quotaWriter reserves capacity for everything written to the piece file.
+type quotaWriter struct {
+	f        *os.File
+	store    *Store
+	reserved int64
+}
+
+func (w *quotaWriter) Write(p []byte) (int, error) {
+	if err := w.store.reserve(int64(len(p))); err != nil {
+		return 0, err
+	}
+
+	n, err := w.f.Write(p)
+	w.store.release(int64(len(p) - n))
+	w.reserved += int64(n)
+
+	return n, err
+}
+
+func (s *Store) path(id types.PieceID) string {
+	name := id.String()
+	return filepath.Join(s.dir, name[:2], name)
+}
+
+// Upload is what is known about a piece before it is written.
+type Upload struct {
+	// ExpiresAt is when DeleteExpired deletes the piece, zero if never.
+	ExpiresAt time.Time
+
+	// Size and Hash are what the client declared, the piece is only stored
+	// if its data matches them. A negative Size or nil Hash is not checked.
+	Size int64
+	Hash []byte
+
+	// Order is the order the piece was uploaded with and Satellite the key
+	// of the metadata server that signed it.
+	Order     string
+	Satellite []byte
+}
+
+// Write stores the contents of r as the piece and returns its size and Blake3
+// hash. A piece with a non zero expiresAt is deleted by DeleteExpired once
+// that time passed.
+func (s *Store) Write(id types.PieceID, r io.Reader, expiresAt time.Time) (int64, []byte, error) {
+	return s.WriteUpload(id, r, Upload{ExpiresAt: expiresAt, Size: -1})
+}
+
+// WriteUpload is Write for uploads that tell more about the piece. It fails
+// with types.ErrPieceMismatch if the piece doesn't match what was declared.
+func (s *Store) WriteUpload(id types.PieceID, r io.Reader, up Upload) (int64, []byte, error) {
+	path := s.path(id)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, nil, err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), id.String()+".*"+tempSuffix)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	hasher := blake3.New()
+	w := &quotaWriter{f: f, store: s}
+
+	// nothing but a complete piece is renamed into place
+	fail := func(err error) (int64, []byte, error) {
+		f.Close()
+		os.Remove(f.Name())
+		s.release(w.reserved)
+		return 0, nil, err
+	}
+
+	n, err := io.Copy(io.MultiWriter(w, hasher), r)
+
+	if err != nil {
+		return fail(err)
+	}
+
+	sum := hasher.Sum(nil)
+
+	if (up.Size >= 0 && n != up.Size) || (up.Hash != nil && !bytes.Equal(sum, up.Hash)) {
+		return fail(types.ErrPieceMismatch)
+	}
+
+	if err := f.Sync(); err != nil {
+		return fail(err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fail(err)
+	}
+
+	info := &types.PieceInfo{
+		ID:        id,
+		Size:      n,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: up.ExpiresAt,
+		Hash:      sum,
+		Order:     up.Order,
+		Satellite: up.Satellite,
+	}
+
+	// the metadata only replaces that of an old piece after the data did,
+	// settle sorts out a crash in between
+	pending := path + pendingSuffix
+
+	if err := writeInfo(pending, info); err != nil {
+		return fail(err)
+	}
+
+	// a piece written again replaces the old data
+	var replaced int64
+
+	if fi, err := os.Stat(path); err == nil {
+		replaced = fi.Size()
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(pending)
+		return fail(err)
+	}
+
+	s.release(replaced)
+
+	if err := os.Rename(pending, path+metaSuffix); err != nil {
+		s.Delete(id)
+		return 0, nil, err
+	}
+
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		return 0, nil, err
+	}
+
+	if err := s.index.put(info); err != nil {
+		s.Delete(id)
+		return 0, nil, err
+	}
+
+	return n, sum, nil
+}
+
+// writeFile replaces the file at path with data, durably and atomically.
+func writeFile(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*"+tempSuffix)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// syncDir makes the entries of dir, like a renamed file, durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+
+	if err != nil {
+		return err
+	}
+
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// Hash returns the hash the piece had when it was written, nil for pieces
+// written before hashes were recorded.
+func (s *Store) Hash(id types.PieceID) ([]byte, error) {
+	info, err := s.index.get(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return info.Hash, nil
+}
+
+// ExpiringUntil returns the pieces that expire at or before t, the first to
+// expire first.
+func (s *Store) ExpiringUntil(t time.Time) ([]*types.PieceInfo, error) {
+	return s.index.until(expiresBucket, t)
+}
+
+// CreatedUntil returns the pieces that were written at or before t, oldest
+// first.
+func (s *Store) CreatedUntil(t time.Time) ([]*types.PieceInfo, error) {
+	return s.index.until(createdBucket, t)
+}
+
+// DeleteExpired deletes the pieces that expired at now and returns how many
+// there were.
+func (s *Store) DeleteExpired(now time.Time) (int, error) {
+	expired, err := s.ExpiringUntil(now)
+
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+
+	for _, info := range expired {
+		if err := s.Delete(info.ID); err != nil && !errors.Is(err, types.ErrPieceNotFound) {
+			return deleted, err
+		}
+
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// Open opens the data of the piece for reading. A piece that has expired is
+// not found, even before DeleteExpired removes it.
+func (s *Store) Open(id types.PieceID) (*os.File, error) {
+	if info, err := s.index.get(id); err == nil && !info.ExpiresAt.IsZero() && !time.Now().Before(info.ExpiresAt) {
+		return nil, types.ErrPieceNotFound
+	}
+
+	f, err := os.Open(s.path(id))
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, types.ErrPieceNotFound
+	}
+
+	return f, err
+}
+
+func (s *Store) Delete(id types.PieceID) error {
+	fi, err := os.Stat(s.path(id))
+
+	if errors.Is(err, fs.ErrNotExist) {
+		// a piece that is gone may have left its metadata behind
+		if err := s.forget(id); err != nil {
+			return err
+		}
+
+		return types.ErrPieceNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(s.path(id))
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return types.ErrPieceNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	s.release(fi.Size())
+
+	return s.forget(id)
+}
+
+// forget removes the metadata of the piece from disk and the index.
+func (s *Store) forget(id types.PieceID) error {
+	for _, suffix := range []string{metaSuffix, pendingSuffix} {
+		if err := os.Remove(s.path(id) + suffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return s.index.delete(id)
+}
+
+func (s *Store) Stat(id types.PieceID) (*types.PieceInfo, error) {
+	return s.index.get(id)
+}
@@ -0,0 +1,173 @@
+package piecestore
+
+import (
+	"bytes"
+	"dfs/hashutil"
+	"dfs/types"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// quarantineDir is where corrupted pieces are moved, below the store
+// directory. They are kept for inspection but no longer served or counted.
+const quarantineDir = "quarantine"
+
+// Pieces returns the IDs of the pieces in the store.
+func (s *Store) Pieces() ([]types.PieceID, error) {
+	return s.index.ids()
+}
+
+// Quarantine moves the piece out of the store.
+func (s *Store) Quarantine(id types.PieceID) error {
+	fi, err := os.Stat(s.path(id))
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return types.ErrPieceNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(s.dir, quarantineDir)
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	if err := os.Rename(s.path(id), filepath.Join(dir, id.String())); err != nil {
+		return err
+	}
+
+	s.release(fi.Size())
+
+	return s.forget(id)
+}
+
+// Scanner re-hashes the pieces of a store to find the ones whose data no
+// longer matches the hash recorded when they were written.
+type Scanner struct {
+	store *Store
+	rate  int64
+}
+
+// WithScanRate limits how many bytes per second the scanner reads, so that
+// it leaves the disk to the piece traffic.
+func WithScanRate(bytesPerSecond int64) func(*Scanner) {
+	return func(sc *Scanner) {
+		sc.rate = bytesPerSecond
+	}
+}
+
+func NewScanner(store *Store, opts ...func(*Scanner)) *Scanner {
+	sc := &Scanner{store: store}
+
+	for _, opt := range opts {
+		opt(sc)
+	}
+
+	return sc
+}
+
+// Scan checks every piece of the store once, quarantines the corrupted ones
+// and returns their IDs. Pieces without a recorded hash are skipped, so are
+// pieces deleted while the scan runs.
+func (sc *Scanner) Scan() ([]types.PieceID, error) {
+	ids, err := sc.store.Pieces()
+
+	if err != nil {
+		return nil, err
+	}
+
+	limit := &rateLimiter{rate: sc.rate, start: time.Now()}
+
+	var corrupted []types.PieceID
+
+	for _, id := range ids {
+		err := sc.verify(id, limit)
+
+		if errors.Is(err, types.ErrPieceNotFound) {
+			continue
+		}
+
+		if errors.Is(err, types.ErrPieceCorrupted) {
+			if err := sc.store.Quarantine(id); err != nil && !errors.Is(err, types.ErrPieceNotFound) {
+				return corrupted, err
+			}
+
+			corrupted = append(corrupted, id)
+			continue
+		}
+
+		if err != nil {
+			return corrupted, err
+		}
+	}
+
+	return corrupted, nil
+}
+
+func (sc *Scanner) verify(id types.PieceID, limit *rateLimiter) error {
+	want, err := sc.store.Hash(id)
+
+	if err != nil || want == nil {
+		return err
+	}
+
+	f, err := sc.store.Open(id)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	h := hashutil.NewBlake3()
+
+	if _, err := io.Copy(h, &limitedReader{r: f, limit: limit}); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(h.Sum(nil), want) {
+		return types.ErrPieceCorrupted
+	}
+
+	return nil
+}
+
+// rateLimiter paces reads to rate bytes per second on average since start.
+// A zero rate does not limit.
+type rateLimiter struct {
+	rate  int64
+	start time.Time
+	read  int64
+}
+
+func (l *rateLimiter) wait(n int) {
+	if l.rate <= 0 {
+		return
+	}
+
+	l.read += int64(n)
+
+	due := l.start.Add(time.Duration(float64(l.read) / float64(l.rate) * float64(time.Second)))
+
+	if d := time.Until(due); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+type limitedReader struct {
+	r     io.Reader
+	limit *rateLimiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.limit.wait(n)
+	return n, err
+}
@@ -0,0 +1,74 @@
+package node
+
+import (
+	"dfs/orders"
+	"dfs/types"
+	"sync"
+	"time"
+)
+
+// usage keeps the traffic the node served for each order until it is
+// settled with the metadata server. It only lives in memory, traffic that
+// was not settled before a restart is lost.
+type usage struct {
+	mu     sync.Mutex
+	served map[string]*served
+}
+
+type served struct {
+	order *orders.Order
+	bytes int64
+}
+
+// record adds n bytes served for the encoded order. Requests without an
+// order are not accounted.
+func (s *Server) record(encoded string, o *orders.Order, n int64) {
+	if o == nil || n <= 0 {
+		return
+	}
+
+	s.usage.mu.Lock()
+	defer s.usage.mu.Unlock()
+
+	entry, ok := s.usage.served[encoded]
+
+	if !ok {
+		entry = &served{order: o}
+		s.usage.served[encoded] = entry
+	}
+
+	entry.bytes += n
+}
+
+// Unsettled returns the traffic of the orders that expired before now and so
+// can't be served any more. Orders too old to be settled are dropped.
+func (s *Server) Unsettled(now time.Time) []*types.Settlement {
+	s.usage.mu.Lock()
+	defer s.usage.mu.Unlock()
+
+	var settlements []*types.Settlement
+
+	for encoded, entry := range s.usage.served {
+		if now.After(entry.order.Expires.Add(orders.SettleWindow)) {
+			delete(s.usage.served, encoded)
+			continue
+		}
+
+		if now.After(entry.order.Expires) {
+			settlements = append(settlements, &types.Settlement{Order: encoded, Bytes: entry.bytes})
+		}
+	}
+
+	return settlements
+}
+
+// Settled forgets the traffic of the settlements once the metadata server
+// accounted it.
+func (s *Server) Settled(settlements []*types.Settlement) {
+	s.usage.mu.Lock()
+	defer s.usage.mu.Unlock()
+
+	for _, settlement := range settlements {
+		delete(s.usage.served, settlement.Order)
+	}
+}
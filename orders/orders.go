@@ -0,0 +1,182 @@
+// Package orders signs and verifies the orders storage nodes require before
+// they accept piece traffic. The metadata server signs an order for every
+// piece a client may upload, download or delete with its order key, nodes
+// check it with the public half.
+//
+// An encoded order is its fields and signature joined by dots, short enough
+// to travel in a request header.
+package orders
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"dfs/types"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrMalformed        = errors.New("malformed order")
+	ErrExpired          = errors.New("order expired")
+	ErrInvalidSignature = errors.New("invalid order signature")
+	ErrMismatch         = errors.New("order does not cover the request")
+)
+
+type Action string
+
+const (
+	ActionPut    Action = "put"
+	ActionGet    Action = "get"
+	ActionDelete Action = "delete"
+)
+
+const version = "v1"
+
+// SettleWindow is how long after it expired the traffic of an order can
+// still be settled.
+const SettleWindow = 24 * time.Hour
+
+// Order allows one action on one piece stored on one node.
+type Order struct {
+	// Serial is unique to every order so that its traffic is settled once.
+	Serial string
+
+	// Bucket is the bucket the traffic of the order is accounted to.
+	Bucket string
+
+	PieceID types.PieceID
+	NodeID  types.NodeID
+	Action  Action
+
+	// MaxSize is the largest piece a put order allows, in bytes.
+	MaxSize int64
+	Expires time.Time
+}
+
+// NewSerial returns a random order serial.
+func NewSerial() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// message is the canonical form of the order that is signed. Bucket names may
+// contain dots, so the bucket is encoded.
+func (o *Order) message() string {
+	return strings.Join([]string{
+		version,
+		o.Serial,
+		base64.RawURLEncoding.EncodeToString([]byte(o.Bucket)),
+		o.PieceID.String(),
+		o.NodeID.String(),
+		string(o.Action),
+		strconv.FormatInt(o.MaxSize, 10),
+		strconv.FormatInt(o.Expires.Unix(), 10),
+	}, ".")
+}
+
+// Sign returns the order signed with key, encoded.
+func Sign(o *Order, key ed25519.PrivateKey) string {
+	msg := o.message()
+	return msg + "." + base64.RawURLEncoding.EncodeToString(ed25519.Sign(key, []byte(msg)))
+}
+
+// Parse reads an encoded order without verifying it, the returned signature
+// is checked with Verify.
+func Parse(s string) (*Order, []byte, error) {
+	parts := strings.Split(s, ".")
+
+	if len(parts) != 9 || parts[0] != version {
+		return nil, nil, ErrMalformed
+	}
+
+	bucket, err := base64.RawURLEncoding.DecodeString(parts[2])
+
+	if err != nil {
+		return nil, nil, ErrMalformed
+	}
+
+	pieceID, err := types.ParsePieceID(parts[3])
+
+	if err != nil {
+		return nil, nil, ErrMalformed
+	}
+
+	nodeID, err := uuid.Parse(parts[4])
+
+	if err != nil {
+		return nil, nil, ErrMalformed
+	}
+
+	maxSize, err1 := strconv.ParseInt(parts[6], 10, 64)
+	expires, err2 := strconv.ParseInt(parts[7], 10, 64)
+
+	if err1 != nil || err2 != nil {
+		return nil, nil, ErrMalformed
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[8])
+
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return nil, nil, ErrMalformed
+	}
+
+	return &Order{
+		Serial:  parts[1],
+		Bucket:  string(bucket),
+		PieceID: pieceID,
+		NodeID:  types.NodeID(nodeID),
+		Action:  Action(parts[5]),
+		MaxSize: maxSize,
+		Expires: time.Unix(expires, 0),
+	}, sig, nil
+}
+
+// VerifySignature checks sig over the order with the public key.
+func VerifySignature(o *Order, sig []byte, key ed25519.PublicKey) error {
+	if len(key) != ed25519.PublicKeySize || !ed25519.Verify(key, []byte(o.message()), sig) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// Verify checks sig over the order with the public key and that the order
+// has not expired at now.
+func Verify(o *Order, sig []byte, key ed25519.PublicKey, now time.Time) error {
+	if err := VerifySignature(o, sig, key); err != nil {
+		return err
+	}
+
+	if now.After(o.Expires) {
+		return ErrExpired
+	}
+
+	return nil
+}
+
+// Check parses and verifies the encoded order and that it allows action on
+// the piece stored on the node.
+func Check(s string, key ed25519.PublicKey, nodeID types.NodeID, pieceID types.PieceID, action Action, now time.Time) (*Order, error) {
+	o, sig, err := Parse(s)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Verify(o, sig, key, now); err != nil {
+		return nil, err
+	}
+
+	if o.NodeID != nodeID || o.PieceID != pieceID || o.Action != action {
+		return nil, ErrMismatch
+	}
+
+	return o, nil
+}
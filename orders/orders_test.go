@@ -0,0 +1,98 @@
+package orders_test
+
+import (
+	"crypto/ed25519"
+	"dfs/orders"
+	"dfs/types"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOrders(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	order := &orders.Order{
+		Serial:  orders.NewSerial(),
+		Bucket:  "photos.example.com",
+		PieceID: types.NewPieceID(),
+		NodeID:  types.NewNodeID(),
+		Action:  orders.ActionPut,
+		MaxSize: 1024,
+		Expires: time.Now().Add(time.Hour).Truncate(time.Second),
+	}
+
+	t.Run("verifies signed orders", func(t *testing.T) {
+		got, err := orders.Check(orders.Sign(order, priv), pub, order.NodeID, order.PieceID, orders.ActionPut, time.Now())
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if *got != *order {
+			t.Fatalf("expected %+v, got %+v", order, got)
+		}
+	})
+
+	t.Run("rejects orders for other pieces, nodes or actions", func(t *testing.T) {
+		encoded := orders.Sign(order, priv)
+
+		if _, err := orders.Check(encoded, pub, order.NodeID, types.NewPieceID(), orders.ActionPut, time.Now()); !errors.Is(err, orders.ErrMismatch) {
+			t.Fatalf("expected %v, got %v", orders.ErrMismatch, err)
+		}
+
+		if _, err := orders.Check(encoded, pub, types.NewNodeID(), order.PieceID, orders.ActionPut, time.Now()); !errors.Is(err, orders.ErrMismatch) {
+			t.Fatalf("expected %v, got %v", orders.ErrMismatch, err)
+		}
+
+		if _, err := orders.Check(encoded, pub, order.NodeID, order.PieceID, orders.ActionDelete, time.Now()); !errors.Is(err, orders.ErrMismatch) {
+			t.Fatalf("expected %v, got %v", orders.ErrMismatch, err)
+		}
+	})
+
+	t.Run("rejects tampered and expired orders", func(t *testing.T) {
+		encoded := orders.Sign(order, priv)
+		tampered := strings.Replace(encoded, ".put.1024.", ".put.4096.", 1)
+
+		if _, err := orders.Check(tampered, pub, order.NodeID, order.PieceID, orders.ActionPut, time.Now()); !errors.Is(err, orders.ErrInvalidSignature) {
+			t.Fatalf("expected %v, got %v", orders.ErrInvalidSignature, err)
+		}
+
+		if _, err := orders.Check(encoded, pub, order.NodeID, order.PieceID, orders.ActionPut, order.Expires.Add(time.Second)); !errors.Is(err, orders.ErrExpired) {
+			t.Fatalf("expected %v, got %v", orders.ErrExpired, err)
+		}
+
+		if _, err := orders.Check("v1.garbage", pub, order.NodeID, order.PieceID, orders.ActionPut, time.Now()); !errors.Is(err, orders.ErrMalformed) {
+			t.Fatalf("expected %v, got %v", orders.ErrMalformed, err)
+		}
+	})
+	t.Run("verifies signed usage reports", func(t *testing.T) {
+		nodePub, nodePriv, err := ed25519.GenerateKey(nil)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		report := &types.UsageReport{
+			NodeID:      order.NodeID,
+			Settlements: []*types.Settlement{{Order: orders.Sign(order, priv), Bytes: 512}},
+		}
+
+		orders.SignReport(report, nodePriv)
+
+		if err := orders.VerifyReport(report, nodePub); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		report.Settlements[0].Bytes = 1024
+
+		if err := orders.VerifyReport(report, nodePub); !errors.Is(err, orders.ErrInvalidSignature) {
+			t.Fatalf("expected %v, got %v", orders.ErrInvalidSignature, err)
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package orders
+
+import (
+	"crypto/ed25519"
+	"dfs/types"
+	"strconv"
+	"strings"
+)
+
+// reportMessage is the canonical form of a usage report that is signed.
+func reportMessage(r *types.UsageReport) []byte {
+	var b strings.Builder
+
+	b.WriteString("report." + version + "\n" + r.NodeID.String() + "\n")
+
+	for _, s := range r.Settlements {
+		b.WriteString(s.Order + " " + strconv.FormatInt(s.Bytes, 10) + "\n")
+	}
+
+	return []byte(b.String())
+}
+
+// SignReport signs the usage report with the key of its node.
+func SignReport(r *types.UsageReport, key ed25519.PrivateKey) {
+	r.Signature = ed25519.Sign(key, reportMessage(r))
+}
+
+// VerifyReport checks the signature of the usage report with the key of its
+// node.
+func VerifyReport(r *types.UsageReport, key ed25519.PublicKey) error {
+	if len(key) != ed25519.PublicKeySize || !ed25519.Verify(key, reportMessage(r), r.Signature) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
@@ -0,0 +1,243 @@
+package s3gw
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxKeys = 1000
+
+type bucketXML struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+type listBucketsResult struct {
+	XMLName xml.Name    `xml:"ListAllMyBucketsResult"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	Owner   owner       `xml:"Owner"`
+	Buckets []bucketXML `xml:"Buckets>Bucket"`
+}
+
+type owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+type objectXML struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         uint64 `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type listObjectsResult struct {
+	XMLName               xml.Name       `xml:"ListBucketResult"`
+	Xmlns                 string         `xml:"xmlns,attr"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	KeyCount              int            `xml:"KeyCount,omitempty"`
+	Marker                string         `xml:"Marker,omitempty"`
+	NextMarker            string         `xml:"NextMarker,omitempty"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	Contents              []objectXML    `xml:"Contents"`
+	CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+}
+
+type locationResult struct {
+	XMLName xml.Name `xml:"LocationConstraint"`
+	Xmlns   string   `xml:"xmlns,attr"`
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+func (g *Gateway) handleListBuckets(c *gin.Context) {
+	buckets, err := g.fs.ListBuckets()
+
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	res := listBucketsResult{Xmlns: xmlns, Owner: owner{ID: "dfs", DisplayName: "dfs"}}
+
+	for _, bucket := range buckets {
+		res.Buckets = append(res.Buckets, bucketXML{
+			Name:         bucket.Name,
+			CreationDate: formatTime(bucket.CreatedAt),
+		})
+	}
+
+	writeXML(c, http.StatusOK, res)
+}
+
+func (g *Gateway) createBucket(c *gin.Context, bucket string) {
+	if _, err := g.fs.CreateBucket(bucket); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.Header("Location", "/"+bucket)
+	c.Status(http.StatusOK)
+}
+
+func (g *Gateway) headBucket(c *gin.Context, bucket string) {
+	if _, err := g.fs.GetBucket(bucket); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func (g *Gateway) getBucketLocation(c *gin.Context, bucket string) {
+	if _, err := g.fs.GetBucket(bucket); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	writeXML(c, http.StatusOK, locationResult{Xmlns: xmlns})
+}
+
+// listObjects serves both versions of ListObjects, v2 is selected with
+// list-type=2.
+func (g *Gateway) listObjects(c *gin.Context, bucket string) {
+	if _, err := g.fs.GetBucket(bucket); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	query := c.Request.URL.Query()
+	v2 := query.Get("list-type") == "2"
+
+	res := listObjectsResult{
+		Xmlns:     xmlns,
+		Name:      bucket,
+		Prefix:    query.Get("prefix"),
+		Delimiter: query.Get("delimiter"),
+		MaxKeys:   maxKeys,
+	}
+
+	if v := query.Get("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+
+		if err != nil || n < 0 {
+			writeError(c, errInvalidArgument)
+			return
+		}
+
+		res.MaxKeys = min(n, maxKeys)
+	}
+
+	after := query.Get("marker")
+
+	if v2 {
+		res.StartAfter = query.Get("start-after")
+		res.ContinuationToken = query.Get("continuation-token")
+		after = res.StartAfter
+
+		if res.ContinuationToken != "" {
+			token, err := base64.RawURLEncoding.DecodeString(res.ContinuationToken)
+
+			if err != nil {
+				writeError(c, errInvalidArgument)
+				return
+			}
+
+			after = string(token)
+		}
+	} else {
+		res.Marker = after
+	}
+
+	objs, err := g.fs.List(objectName(bucket, res.Prefix))
+
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	var last string
+
+	for _, obj := range objs {
+		key := strings.TrimPrefix(obj.Name, bucket+"/")
+
+		// parts of multipart uploads are not objects of the bucket yet
+		if strings.HasPrefix(key, uploadsDir) {
+			continue
+		}
+
+		// a page ending in a common prefix continues after all of its keys
+		if key <= after || (res.Delimiter != "" && strings.HasSuffix(after, res.Delimiter) && strings.HasPrefix(key, after)) {
+			continue
+		}
+
+		// keys below a delimiter after the prefix roll up into one prefix
+		if res.Delimiter != "" {
+			rest := strings.TrimPrefix(key, res.Prefix)
+
+			if i := strings.Index(rest, res.Delimiter); i >= 0 {
+				prefix := res.Prefix + rest[:i+len(res.Delimiter)]
+
+				if prefix == last {
+					continue
+				}
+
+				if len(res.Contents)+len(res.CommonPrefixes) == res.MaxKeys {
+					res.IsTruncated = true
+					break
+				}
+
+				res.CommonPrefixes = append(res.CommonPrefixes, commonPrefix{Prefix: prefix})
+				last = prefix
+				continue
+			}
+		}
+
+		if len(res.Contents)+len(res.CommonPrefixes) == res.MaxKeys {
+			res.IsTruncated = true
+			break
+		}
+
+		res.Contents = append(res.Contents, objectXML{
+			Key:          key,
+			LastModified: formatTime(obj.ModifiedAt),
+			ETag:         obj.ETag(),
+			Size:         obj.Size,
+			StorageClass: "STANDARD",
+		})
+		last = key
+	}
+
+	if res.IsTruncated {
+		if v2 {
+			res.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(last))
+		} else {
+			res.NextMarker = last
+		}
+	}
+
+	if v2 {
+		res.KeyCount = len(res.Contents) + len(res.CommonPrefixes)
+	}
+
+	writeXML(c, http.StatusOK, res)
+}
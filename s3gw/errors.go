@@ -0,0 +1,79 @@
+package s3gw
+
+import (
+	"dfs/types"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// s3Error is an error as S3 reports it to clients.
+type s3Error struct {
+	code    string
+	message string
+	status  int
+}
+
+func (e *s3Error) Error() string {
+	return e.code + ": " + e.message
+}
+
+var (
+	errAccessDenied           = &s3Error{"AccessDenied", "Access Denied", http.StatusForbidden}
+	errAuthorizationMalformed = &s3Error{"AuthorizationHeaderMalformed", "The authorization header is malformed", http.StatusBadRequest}
+	errInvalidAccessKeyID     = &s3Error{"InvalidAccessKeyId", "The access key ID you provided does not exist", http.StatusForbidden}
+	errSignatureDoesNotMatch  = &s3Error{"SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided", http.StatusForbidden}
+	errRequestTimeTooSkewed   = &s3Error{"RequestTimeTooSkewed", "The difference between the request time and the server's time is too large", http.StatusForbidden}
+	errRequestExpired         = &s3Error{"AccessDenied", "Request has expired", http.StatusForbidden}
+	errMissingContentSHA256   = &s3Error{"InvalidRequest", "Missing required header x-amz-content-sha256", http.StatusBadRequest}
+	errContentSHA256Mismatch  = &s3Error{"XAmzContentSHA256Mismatch", "The provided x-amz-content-sha256 header does not match what was computed", http.StatusBadRequest}
+	errIncompleteBody         = &s3Error{"IncompleteBody", "The request body is malformed or incomplete", http.StatusBadRequest}
+	errInvalidArgument        = &s3Error{"InvalidArgument", "Invalid argument", http.StatusBadRequest}
+	errInvalidRequest         = &s3Error{"InvalidRequest", "The request is not valid", http.StatusBadRequest}
+	errNoSuchBucket           = &s3Error{"NoSuchBucket", "The specified bucket does not exist", http.StatusNotFound}
+	errNoSuchKey              = &s3Error{"NoSuchKey", "The specified key does not exist", http.StatusNotFound}
+	errBucketAlreadyOwned     = &s3Error{"BucketAlreadyOwnedByYou", "The bucket you tried to create already exists, and you own it", http.StatusConflict}
+	errInvalidBucketName      = &s3Error{"InvalidBucketName", "The specified bucket is not valid", http.StatusBadRequest}
+	errInvalidRange           = &s3Error{"InvalidRange", "The requested range is not satisfiable", http.StatusRequestedRangeNotSatisfiable}
+	errNoSuchUpload           = &s3Error{"NoSuchUpload", "The specified multipart upload does not exist", http.StatusNotFound}
+	errInvalidPart            = &s3Error{"InvalidPart", "One or more of the specified parts could not be found", http.StatusBadRequest}
+	errInvalidPartOrder       = &s3Error{"InvalidPartOrder", "The list of parts was not in ascending order", http.StatusBadRequest}
+	errMalformedXML           = &s3Error{"MalformedXML", "The XML you provided was not well-formed", http.StatusBadRequest}
+	errMissingContentLength   = &s3Error{"MissingContentLength", "You must provide the Content-Length HTTP header", http.StatusLengthRequired}
+	errQuotaExceeded          = &s3Error{"QuotaExceeded", "The bucket is over its storage or bandwidth limit", http.StatusForbidden}
+	errNotImplemented         = &s3Error{"NotImplemented", "A header or query you provided implies functionality that is not implemented", http.StatusNotImplemented}
+	errInternal               = &s3Error{"InternalError", "We encountered an internal error, please try again", http.StatusInternalServerError}
+)
+
+type errorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource"`
+	RequestID string   `xml:"RequestId"`
+}
+
+// toS3Error maps errors of the FS to their S3 equivalent.
+func toS3Error(err error) *s3Error {
+	var s3err *s3Error
+
+	switch {
+	case errors.As(err, &s3err):
+		return s3err
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return errIncompleteBody
+	case errors.Is(err, types.ErrObjectNotFound):
+		return errNoSuchKey
+	case errors.Is(err, types.ErrBucketNotFound):
+		return errNoSuchBucket
+	case errors.Is(err, types.ErrBucketExists):
+		return errBucketAlreadyOwned
+	case errors.Is(err, types.ErrInvalidBucketName):
+		return errInvalidBucketName
+	case errors.Is(err, types.ErrLimitExceeded):
+		return errQuotaExceeded
+	default:
+		return errInternal
+	}
+}
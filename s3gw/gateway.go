@@ -0,0 +1,187 @@
+// Package s3gw serves a FS over the S3 REST API, so that existing S3 clients
+// and SDKs can use the network. Buckets map to buckets on the metadata server
+// and the object key of a bucket is stored as the file "bucket/key".
+package s3gw
+
+import (
+	"dfs/fs"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+type Gateway struct {
+	fs          *fs.FS
+	credentials map[string]string
+}
+
+// WithCredentials adds an access key the gateway accepts requests signed
+// with.
+func WithCredentials(accessKey, secretKey string) func(*Gateway) {
+	return func(g *Gateway) {
+		g.credentials[accessKey] = secretKey
+	}
+}
+
+func NewGateway(fsys *fs.FS, opts ...func(*Gateway)) *Gateway {
+	g := &Gateway{
+		fs:          fsys,
+		credentials: make(map[string]string),
+	}
+
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	return g
+}
+
+func (g *Gateway) Handler() http.Handler {
+	r := gin.New()
+	r.RedirectTrailingSlash = false
+	r.RedirectFixedPath = false
+	r.Use(gin.Recovery(), g.authenticate)
+
+	r.GET("/", g.handleListBuckets)
+	r.Any("/:bucket", g.handleBucket)
+	r.Any("/:bucket/*key", g.handleObject)
+
+	return r
+}
+
+// authenticate verifies the SigV4 signature of every request and replaces
+// the body with one that checks the signed payload while it is read.
+func (g *Gateway) authenticate(c *gin.Context) {
+	body, err := verifySignature(c.Request, g.credentials)
+
+	if err != nil {
+		writeError(c, err)
+		c.Abort()
+		return
+	}
+
+	c.Request.Body = struct {
+		io.Reader
+		io.Closer
+	}{body, c.Request.Body}
+
+	c.Next()
+}
+
+func writeError(c *gin.Context, err error) {
+	s3err := toS3Error(err)
+
+	if c.Request.Method == http.MethodHead {
+		c.Status(s3err.status)
+		return
+	}
+
+	writeXML(c, s3err.status, errorResponse{
+		Code:      s3err.code,
+		Message:   s3err.message,
+		Resource:  c.Request.URL.Path,
+		RequestID: uuid.NewString(),
+	})
+}
+
+func writeXML(c *gin.Context, status int, v any) {
+	out, err := xml.Marshal(v)
+
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.Data(status, "application/xml", append([]byte(xml.Header), out...))
+}
+
+// objectName is the name of the file that stores key in bucket.
+func objectName(bucket, key string) string {
+	return bucket + "/" + key
+}
+
+func (g *Gateway) handleBucket(c *gin.Context) {
+	bucket := c.Param("bucket")
+	query := c.Request.URL.Query()
+
+	switch c.Request.Method {
+	case http.MethodPut:
+		g.createBucket(c, bucket)
+	case http.MethodHead:
+		g.headBucket(c, bucket)
+	case http.MethodGet:
+		switch {
+		case query.Has("location"):
+			g.getBucketLocation(c, bucket)
+		case query.Has("uploads"), query.Has("versions"), query.Has("policy"), query.Has("acl"):
+			writeError(c, errNotImplemented)
+		default:
+			g.listObjects(c, bucket)
+		}
+	default:
+		writeError(c, errNotImplemented)
+	}
+}
+
+func (g *Gateway) handleObject(c *gin.Context) {
+	bucket := c.Param("bucket")
+	key := strings.TrimPrefix(c.Param("key"), "/")
+
+	// "/bucket/" is the bucket itself
+	if key == "" {
+		g.handleBucket(c)
+		return
+	}
+
+	if _, err := g.fs.GetBucket(bucket); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	query := c.Request.URL.Query()
+
+	switch c.Request.Method {
+	case http.MethodPut:
+		switch {
+		case query.Has("uploadId"):
+			g.uploadPart(c, bucket, key)
+		case c.GetHeader("X-Amz-Copy-Source") != "":
+			g.copyObject(c, bucket, key)
+		default:
+			g.putObject(c, bucket, key)
+		}
+	case http.MethodPost:
+		switch {
+		case query.Has("uploads"):
+			g.createMultipartUpload(c, bucket, key)
+		case query.Has("uploadId"):
+			g.completeMultipartUpload(c, bucket, key)
+		default:
+			writeError(c, errNotImplemented)
+		}
+	case http.MethodGet:
+		if query.Has("uploadId") {
+			g.listParts(c, bucket, key)
+			return
+		}
+
+		g.getObject(c, bucket, key)
+	case http.MethodHead:
+		g.getObject(c, bucket, key)
+	case http.MethodDelete:
+		if query.Has("uploadId") {
+			g.abortMultipartUpload(c, bucket, key)
+			return
+		}
+
+		g.deleteObject(c, bucket, key)
+	default:
+		writeError(c, errNotImplemented)
+	}
+}
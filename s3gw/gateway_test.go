@@ -0,0 +1,386 @@
+package s3gw_test
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"dfs/client/api"
+	"dfs/localnet"
+	"dfs/s3gw"
+	"dfs/types"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	accessKey = "test-access"
+	secretKey = "test-secret"
+)
+
+func mac(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// sign signs r with SigV4 the way S3 clients do, in the header or, if
+// presign is set, in the query.
+func sign(r *http.Request, secret string, body []byte, presign bool) {
+	now := time.Now().UTC()
+	date := now.Format("20060102")
+	amzDate := now.Format("20060102T150405Z")
+	scope := date + "/us-east-1/s3/aws4_request"
+	payloadHash := "UNSIGNED-PAYLOAD"
+
+	if presign {
+		q := r.URL.Query()
+		q.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+		q.Set("X-Amz-Credential", accessKey+"/"+scope)
+		q.Set("X-Amz-Date", amzDate)
+		q.Set("X-Amz-Expires", "300")
+		q.Set("X-Amz-SignedHeaders", "host")
+		r.URL.RawQuery = q.Encode()
+	} else {
+		payloadHash = hexSHA256(body)
+		r.Header.Set("X-Amz-Date", amzDate)
+		r.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	headers := []string{"host"}
+	if !presign {
+		headers = append(headers, "x-amz-content-sha256", "x-amz-date")
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, h := range headers {
+		value := r.Header.Get(h)
+		if h == "host" {
+			value = r.URL.Host
+		}
+		canonicalHeaders.WriteString(h + ":" + value + "\n")
+	}
+
+	var query []string
+	for k, vs := range r.URL.Query() {
+		for _, v := range vs {
+			query = append(query, escape(k)+"="+escape(v))
+		}
+	}
+	sort.Strings(query)
+
+	canonical := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		strings.Join(query, "&"),
+		canonicalHeaders.String(),
+		strings.Join(headers, ";"),
+		payloadHash,
+	}, "\n")
+
+	toSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hexSHA256([]byte(canonical))}, "\n")
+
+	key := mac([]byte("AWS4"+secret), date)
+	key = mac(key, "us-east-1")
+	key = mac(key, "s3")
+	key = mac(key, "aws4_request")
+	signature := hex.EncodeToString(mac(key, toSign))
+
+	if presign {
+		r.URL.RawQuery += "&X-Amz-Signature=" + signature
+		return
+	}
+
+	r.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, strings.Join(headers, ";"), signature))
+}
+
+type testGateway struct {
+	t   *testing.T
+	url string
+	net *localnet.Network
+}
+
+func newTestGateway(t *testing.T) *testGateway {
+	t.Helper()
+
+	net, err := localnet.Start(t.TempDir())
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	t.Cleanup(func() { net.Close() })
+
+	gw := s3gw.NewGateway(net.FS(), s3gw.WithCredentials(accessKey, secretKey))
+
+	ts := httptest.NewServer(gw.Handler())
+	t.Cleanup(ts.Close)
+
+	return &testGateway{t: t, url: ts.URL, net: net}
+}
+
+func (g *testGateway) do(method, path string, body []byte, header http.Header) (*http.Response, []byte) {
+	g.t.Helper()
+
+	r, err := http.NewRequest(method, g.url+path, bytes.NewReader(body))
+
+	if err != nil {
+		g.t.Fatalf("unexpected error: %v", err)
+	}
+
+	for k, vs := range header {
+		r.Header[k] = vs
+	}
+
+	sign(r, secretKey, body, false)
+
+	res, err := http.DefaultClient.Do(r)
+
+	if err != nil {
+		g.t.Fatalf("unexpected error: %v", err)
+	}
+
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+
+	if err != nil {
+		g.t.Fatalf("unexpected error: %v", err)
+	}
+
+	return res, data
+}
+
+func (g *testGateway) expect(status int, method, path string, body []byte, header http.Header) []byte {
+	g.t.Helper()
+
+	res, data := g.do(method, path, body, header)
+
+	if res.StatusCode != status {
+		g.t.Fatalf("%s %s: expected status %d, got %d: %s", method, path, status, res.StatusCode, data)
+	}
+
+	return data
+}
+
+func TestGateway(t *testing.T) {
+	t.Run("can create buckets and put, get and delete objects", func(t *testing.T) {
+		g := newTestGateway(t)
+
+		g.expect(http.StatusOK, http.MethodPut, "/photos", nil, nil)
+		g.expect(http.StatusConflict, http.MethodPut, "/photos", nil, nil)
+		g.expect(http.StatusOK, http.MethodHead, "/photos", nil, nil)
+		g.expect(http.StatusNotFound, http.MethodHead, "/missing", nil, nil)
+
+		data := []byte("hello world")
+		g.expect(http.StatusOK, http.MethodPut, "/photos/2024/cat.jpg", data, nil)
+
+		if got := g.expect(http.StatusOK, http.MethodGet, "/photos/2024/cat.jpg", nil, nil); !bytes.Equal(got, data) {
+			t.Fatalf("expected %q, got %q", data, got)
+		}
+
+		got := g.expect(http.StatusPartialContent, http.MethodGet, "/photos/2024/cat.jpg", nil, http.Header{"Range": {"bytes=6-"}})
+
+		if string(got) != "world" {
+			t.Fatalf("expected %q, got %q", "world", got)
+		}
+
+		g.expect(http.StatusRequestedRangeNotSatisfiable, http.MethodGet, "/photos/2024/cat.jpg", nil, http.Header{"Range": {"bytes=100-"}})
+
+		g.expect(http.StatusNoContent, http.MethodDelete, "/photos/2024/cat.jpg", nil, nil)
+
+		if body := g.expect(http.StatusNotFound, http.MethodGet, "/photos/2024/cat.jpg", nil, nil); !bytes.Contains(body, []byte("<Code>NoSuchKey</Code>")) {
+			t.Fatalf("expected NoSuchKey, got %s", body)
+		}
+
+		g.expect(http.StatusNotFound, http.MethodPut, "/missing/key", data, nil)
+	})
+
+	t.Run("lists objects with prefixes and delimiters", func(t *testing.T) {
+		g := newTestGateway(t)
+
+		g.expect(http.StatusOK, http.MethodPut, "/docs", nil, nil)
+
+		for _, key := range []string{"a.txt", "dir/b.txt", "dir/c.txt", "z.txt"} {
+			g.expect(http.StatusOK, http.MethodPut, "/docs/"+key, []byte(key), nil)
+		}
+
+		body := string(g.expect(http.StatusOK, http.MethodGet, "/docs?list-type=2&delimiter=%2F", nil, nil))
+
+		for _, want := range []string{"<Key>a.txt</Key>", "<Key>z.txt</Key>", "<Prefix>dir/</Prefix>", "<KeyCount>3</KeyCount>"} {
+			if !strings.Contains(body, want) {
+				t.Fatalf("expected %s in %s", want, body)
+			}
+		}
+
+		if strings.Contains(body, "<Key>dir/b.txt</Key>") {
+			t.Fatalf("expected dir/b.txt to be rolled up in %s", body)
+		}
+
+		body = string(g.expect(http.StatusOK, http.MethodGet, "/docs?list-type=2&max-keys=2", nil, nil))
+
+		if !strings.Contains(body, "<IsTruncated>true</IsTruncated>") || !strings.Contains(body, "<NextContinuationToken>") {
+			t.Fatalf("expected a truncated listing, got %s", body)
+		}
+	})
+
+	t.Run("copies objects", func(t *testing.T) {
+		g := newTestGateway(t)
+
+		g.expect(http.StatusOK, http.MethodPut, "/src", nil, nil)
+		g.expect(http.StatusOK, http.MethodPut, "/dst", nil, nil)
+		g.expect(http.StatusOK, http.MethodPut, "/src/file", []byte("data"), nil)
+		g.expect(http.StatusOK, http.MethodPut, "/dst/file", []byte("old"), nil)
+
+		g.expect(http.StatusOK, http.MethodPut, "/dst/file", nil, http.Header{"X-Amz-Copy-Source": {"/src/file"}})
+
+		if got := g.expect(http.StatusOK, http.MethodGet, "/dst/file", nil, nil); string(got) != "data" {
+			t.Fatalf("expected %q, got %q", "data", got)
+		}
+	})
+
+	t.Run("stores content types and user metadata", func(t *testing.T) {
+		g := newTestGateway(t)
+
+		g.expect(http.StatusOK, http.MethodPut, "/docs", nil, nil)
+		g.expect(http.StatusOK, http.MethodPut, "/docs/notes", []byte("# notes"), http.Header{
+			"Content-Type":     {"text/plain"},
+			"X-Amz-Meta-Color": {"blue"},
+		})
+
+		res, _ := g.do(http.MethodHead, "/docs/notes", nil, nil)
+
+		if res.Header.Get("Content-Type") != "text/plain" || res.Header.Get("X-Amz-Meta-Color") != "blue" {
+			t.Fatalf("expected the stored content type and metadata, got %v", res.Header)
+		}
+
+		if _, err := http.ParseTime(res.Header.Get("Last-Modified")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		g.expect(http.StatusOK, http.MethodPut, "/docs/notes", nil, http.Header{
+			"X-Amz-Copy-Source":        {"/docs/notes"},
+			"X-Amz-Metadata-Directive": {"REPLACE"},
+			"Content-Type":             {"text/markdown"},
+		})
+
+		res, _ = g.do(http.MethodHead, "/docs/notes", nil, nil)
+
+		if res.Header.Get("Content-Type") != "text/markdown" || res.Header.Get("X-Amz-Meta-Color") != "" {
+			t.Fatalf("expected replaced metadata, got %v", res.Header)
+		}
+	})
+
+	t.Run("completes multipart uploads", func(t *testing.T) {
+		g := newTestGateway(t)
+
+		g.expect(http.StatusOK, http.MethodPut, "/big", nil, nil)
+
+		body := g.expect(http.StatusOK, http.MethodPost, "/big/file?uploads", nil, nil)
+
+		start := bytes.Index(body, []byte("<UploadId>")) + len("<UploadId>")
+		end := bytes.Index(body, []byte("</UploadId>"))
+		uploadID := string(body[start:end])
+
+		var complete strings.Builder
+		complete.WriteString("<CompleteMultipartUpload>")
+
+		for i, part := range []string{"first,", "second"} {
+			res, data := g.do(http.MethodPut, fmt.Sprintf("/big/file?partNumber=%d&uploadId=%s", i+1, uploadID), []byte(part), nil)
+
+			if res.StatusCode != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", res.StatusCode, data)
+			}
+
+			fmt.Fprintf(&complete, "<Part><PartNumber>%d</PartNumber><ETag>%s</ETag></Part>", i+1, res.Header.Get("ETag"))
+		}
+
+		complete.WriteString("</CompleteMultipartUpload>")
+
+		if list := g.expect(http.StatusOK, http.MethodGet, "/big?list-type=2", nil, nil); bytes.Contains(list, []byte("<Key>")) {
+			t.Fatalf("expected the parts to be hidden from listings, got %s", list)
+		}
+
+		g.expect(http.StatusOK, http.MethodPost, "/big/file?uploadId="+uploadID, []byte(complete.String()), nil)
+
+		if got := g.expect(http.StatusOK, http.MethodGet, "/big/file", nil, nil); string(got) != "first,second" {
+			t.Fatalf("expected %q, got %q", "first,second", got)
+		}
+
+		g.expect(http.StatusNotFound, http.MethodPost, "/big/file?uploadId="+uploadID, []byte(complete.String()), nil)
+	})
+
+	t.Run("counts parts against the limits of the bucket", func(t *testing.T) {
+		g := newTestGateway(t)
+
+		g.expect(http.StatusOK, http.MethodPut, "/small", nil, nil)
+
+		if err := api.NewClient(g.net.MetadataURL, g.net.APIKey).SetLimits("small", types.Limits{Storage: 16}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		body := g.expect(http.StatusOK, http.MethodPost, "/small/file?uploads", nil, nil)
+
+		start := bytes.Index(body, []byte("<UploadId>")) + len("<UploadId>")
+		end := bytes.Index(body, []byte("</UploadId>"))
+		uploadID := string(body[start:end])
+
+		g.expect(http.StatusOK, http.MethodPut, "/small/file?partNumber=1&uploadId="+uploadID, []byte("0123456789"), nil)
+		g.expect(http.StatusForbidden, http.MethodPut, "/small/file?partNumber=2&uploadId="+uploadID, []byte("0123456789"), nil)
+	})
+
+	t.Run("rejects bad signatures and accepts presigned URLs", func(t *testing.T) {
+		g := newTestGateway(t)
+
+		g.expect(http.StatusOK, http.MethodPut, "/bucket", nil, nil)
+		g.expect(http.StatusOK, http.MethodPut, "/bucket/key", []byte("secret"), nil)
+
+		r, _ := http.NewRequest(http.MethodGet, g.url+"/bucket/key", nil)
+		sign(r, "wrong-secret", nil, false)
+
+		res, err := http.DefaultClient.Do(r)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusForbidden {
+			t.Fatalf("expected status 403, got %d", res.StatusCode)
+		}
+
+		r, _ = http.NewRequest(http.MethodGet, g.url+"/bucket/key", nil)
+		sign(r, secretKey, nil, true)
+
+		res, err = http.DefaultClient.Get(r.URL.String())
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		data, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusOK || string(data) != "secret" {
+			t.Fatalf("expected the object, got %d: %s", res.StatusCode, data)
+		}
+	})
+}
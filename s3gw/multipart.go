@@ -0,0 +1,328 @@
+package s3gw
+
+import (
+	"dfs/types"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Multipart uploads are kept as files below uploadsDir in the target bucket
+// until they complete: a marker file naming the target key and one file per
+// part. Keeping them in the bucket counts the parts against its limits and
+// the caveats of the API key. Completing the upload composes the parts
+// without copying any data.
+const (
+	uploadsDir = ".multipart/"
+	maxParts   = 10000
+)
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name `xml:"CompleteMultipartUpload"`
+	Parts   []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	} `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+type partXML struct {
+	PartNumber   int    `xml:"PartNumber"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         uint64 `xml:"Size"`
+}
+
+type listPartsResult struct {
+	XMLName  xml.Name  `xml:"ListPartsResult"`
+	Xmlns    string    `xml:"xmlns,attr"`
+	Bucket   string    `xml:"Bucket"`
+	Key      string    `xml:"Key"`
+	UploadID string    `xml:"UploadId"`
+	Parts    []partXML `xml:"Part"`
+}
+
+func uploadPrefix(bucket, uploadID string) string {
+	return objectName(bucket, uploadsDir+uploadID+"/")
+}
+
+func uploadMarker(uploadID, bucket, key string) string {
+	return uploadPrefix(bucket, uploadID) + "target/" + key
+}
+
+func partName(uploadID, bucket string, partNumber int) string {
+	return fmt.Sprintf("%spart/%05d", uploadPrefix(bucket, uploadID), partNumber)
+}
+
+// checkUpload returns the ID of the upload in the request after checking it
+// is an upload to key in bucket.
+func (g *Gateway) checkUpload(c *gin.Context, bucket, key string) (string, error) {
+	uploadID := c.Query("uploadId")
+
+	if _, err := uuid.Parse(uploadID); err != nil {
+		return "", errNoSuchUpload
+	}
+
+	if _, err := g.fs.StatObject(uploadMarker(uploadID, bucket, key)); err != nil {
+		return "", errNoSuchUpload
+	}
+
+	return uploadID, nil
+}
+
+// parts returns the part files of an upload by part number.
+func (g *Gateway) parts(uploadID, bucket string) (map[int]*types.Object, error) {
+	prefix := uploadPrefix(bucket, uploadID) + "part/"
+
+	objs, err := g.fs.List(prefix)
+
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make(map[int]*types.Object, len(objs))
+
+	for _, obj := range objs {
+		n, err := strconv.Atoi(strings.TrimPrefix(obj.Name, prefix))
+
+		if err == nil {
+			parts[n] = obj
+		}
+	}
+
+	return parts, nil
+}
+
+// deleteUpload removes the parts and the marker of an upload.
+func (g *Gateway) deleteUpload(uploadID, bucket string) error {
+	objs, err := g.fs.List(uploadPrefix(bucket, uploadID))
+
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objs {
+		if err := g.fs.DeleteFile(obj.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *Gateway) createMultipartUpload(c *gin.Context, bucket, key string) {
+	uploadID := uuid.NewString()
+
+	// the marker keeps the content type and metadata for the completed object
+	if _, err := g.fs.WriteFile(uploadMarker(uploadID, bucket, key), strings.NewReader(""), 0, nil, writeOptions(c.Request.Header)...); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	writeXML(c, http.StatusOK, initiateMultipartUploadResult{
+		Xmlns:    xmlns,
+		Bucket:   bucket,
+		Key:      key,
+		UploadID: uploadID,
+	})
+}
+
+func (g *Gateway) uploadPart(c *gin.Context, bucket, key string) {
+	uploadID, err := g.checkUpload(c, bucket, key)
+
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	partNumber, err := strconv.Atoi(c.Query("partNumber"))
+
+	if err != nil || partNumber < 1 || partNumber > maxParts {
+		writeError(c, errInvalidArgument)
+		return
+	}
+
+	size := decodedLength(c.Request)
+
+	if size < 0 {
+		writeError(c, errMissingContentLength)
+		return
+	}
+
+	obj, err := g.fs.WriteFile(partName(uploadID, bucket, partNumber), c.Request.Body, uint64(size), nil)
+
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.Header("ETag", obj.ETag())
+	c.Status(http.StatusOK)
+}
+
+func (g *Gateway) completeMultipartUpload(c *gin.Context, bucket, key string) {
+	uploadID, err := g.checkUpload(c, bucket, key)
+
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	body, err := readAllLimited(c.Request.Body)
+
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	var req completeMultipartUpload
+
+	if err := xml.Unmarshal(body, &req); err != nil || len(req.Parts) == 0 {
+		writeError(c, errMalformedXML)
+		return
+	}
+
+	parts, err := g.parts(uploadID, bucket)
+
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	srcs := make([]string, 0, len(req.Parts))
+
+	for i, part := range req.Parts {
+		if i > 0 && part.PartNumber <= req.Parts[i-1].PartNumber {
+			writeError(c, errInvalidPartOrder)
+			return
+		}
+
+		obj, ok := parts[part.PartNumber]
+
+		if !ok || strings.Trim(part.ETag, `"`) != strings.Trim(obj.ETag(), `"`) {
+			writeError(c, errInvalidPart)
+			return
+		}
+
+		srcs = append(srcs, obj.Name)
+	}
+
+	marker, err := g.fs.StatObject(uploadMarker(uploadID, bucket, key))
+
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	name := objectName(bucket, key)
+
+	obj, err := g.replaceFile(name, func() (*types.Object, error) {
+		return g.fs.ComposeFile(name, srcs)
+	})
+
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	obj, err = g.fs.UpdateFile(&types.UpdateObjectRequest{
+		Name:        name,
+		ContentType: &marker.ContentType,
+		Metadata:    marker.Metadata,
+	})
+
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	// the composed object holds its own references to the pieces
+	if err := g.deleteUpload(uploadID, bucket); err != nil {
+		c.Error(err)
+	}
+
+	writeXML(c, http.StatusOK, completeMultipartUploadResult{
+		Xmlns:    xmlns,
+		Location: "/" + name,
+		Bucket:   bucket,
+		Key:      key,
+		ETag:     obj.ETag(),
+	})
+}
+
+func (g *Gateway) abortMultipartUpload(c *gin.Context, bucket, key string) {
+	uploadID, err := g.checkUpload(c, bucket, key)
+
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if err := g.deleteUpload(uploadID, bucket); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (g *Gateway) listParts(c *gin.Context, bucket, key string) {
+	uploadID, err := g.checkUpload(c, bucket, key)
+
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	parts, err := g.parts(uploadID, bucket)
+
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	res := listPartsResult{
+		Xmlns:    xmlns,
+		Bucket:   bucket,
+		Key:      key,
+		UploadID: uploadID,
+	}
+
+	for n := 1; n <= maxParts && len(res.Parts) < len(parts); n++ {
+		obj, ok := parts[n]
+
+		if !ok {
+			continue
+		}
+
+		res.Parts = append(res.Parts, partXML{
+			PartNumber:   n,
+			LastModified: formatTime(obj.ModifiedAt),
+			ETag:         obj.ETag(),
+			Size:         obj.Size,
+		})
+	}
+
+	writeXML(c, http.StatusOK, res)
+}
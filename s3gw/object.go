@@ -0,0 +1,283 @@
+package s3gw
+
+import (
+	"dfs/fs"
+	"dfs/types"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type copyObjectResult struct {
+	XMLName      xml.Name `xml:"CopyObjectResult"`
+	Xmlns        string   `xml:"xmlns,attr"`
+	ETag         string   `xml:"ETag"`
+	LastModified string   `xml:"LastModified"`
+}
+
+const metaHeaderPrefix = "X-Amz-Meta-"
+
+// objectMetadata returns the content type and the user metadata sent with a
+// request as x-amz-meta-* headers.
+func objectMetadata(h http.Header) (string, map[string]string) {
+	metadata := make(map[string]string)
+
+	for name, values := range h {
+		if key, ok := strings.CutPrefix(name, metaHeaderPrefix); ok {
+			metadata[strings.ToLower(key)] = strings.Join(values, ",")
+		}
+	}
+
+	return h.Get("Content-Type"), metadata
+}
+
+// writeOptions sets the content type and user metadata of the request on an
+// uploaded file.
+func writeOptions(h http.Header) []func(*types.Object) {
+	contentType, metadata := objectMetadata(h)
+	opts := []func(*types.Object){fs.WithContentType(contentType)}
+
+	if len(metadata) > 0 {
+		opts = append(opts, fs.WithMetadata(metadata))
+	}
+
+	return opts
+}
+
+// replaceFile runs op, which creates name, deleting name first if it already
+// exists. S3 overwrites objects, files have to be deleted.
+func (g *Gateway) replaceFile(name string, op func() (*types.Object, error)) (*types.Object, error) {
+	obj, err := op()
+
+	if errors.Is(err, types.ErrObjectExists) {
+		if err := g.fs.DeleteFile(name); err != nil && !errors.Is(err, types.ErrObjectNotFound) {
+			return nil, err
+		}
+
+		obj, err = op()
+	}
+
+	return obj, err
+}
+
+func (g *Gateway) putObject(c *gin.Context, bucket, key string) {
+	size := decodedLength(c.Request)
+
+	if size < 0 {
+		writeError(c, errMissingContentLength)
+		return
+	}
+
+	obj, err := g.fs.WriteFile(objectName(bucket, key), c.Request.Body, uint64(size), nil, writeOptions(c.Request.Header)...)
+
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.Header("ETag", obj.ETag())
+	c.Status(http.StatusOK)
+}
+
+// copySource parses the x-amz-copy-source header, "/bucket/key" with an
+// optional leading slash.
+func copySource(header string) (string, string, error) {
+	header, _, _ = strings.Cut(header, "?")
+
+	source, err := url.PathUnescape(strings.TrimPrefix(header, "/"))
+
+	if err != nil {
+		return "", "", errInvalidArgument
+	}
+
+	bucket, key, ok := strings.Cut(source, "/")
+
+	if !ok || bucket == "" || key == "" {
+		return "", "", errInvalidArgument
+	}
+
+	return bucket, key, nil
+}
+
+func (g *Gateway) copyObject(c *gin.Context, bucket, key string) {
+	srcBucket, srcKey, err := copySource(c.GetHeader("X-Amz-Copy-Source"))
+
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if _, err := g.fs.GetBucket(srcBucket); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	src := objectName(srcBucket, srcKey)
+	dst := objectName(bucket, key)
+	replace := c.GetHeader("X-Amz-Metadata-Directive") == "REPLACE"
+
+	// copying an object onto itself only changes its metadata
+	if src == dst && !replace {
+		writeError(c, errInvalidRequest)
+		return
+	}
+
+	var obj *types.Object
+
+	if src != dst {
+		obj, err = g.replaceFile(dst, func() (*types.Object, error) {
+			return g.fs.CopyFile(src, dst)
+		})
+
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+	}
+
+	if replace {
+		contentType, metadata := objectMetadata(c.Request.Header)
+
+		obj, err = g.fs.UpdateFile(&types.UpdateObjectRequest{
+			Name:        dst,
+			ContentType: &contentType,
+			Metadata:    metadata,
+		})
+
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+	}
+
+	writeXML(c, http.StatusOK, copyObjectResult{
+		Xmlns:        xmlns,
+		ETag:         obj.ETag(),
+		LastModified: formatTime(obj.ModifiedAt),
+	})
+}
+
+// parseRange parses a single byte range of the Range header for an object of
+// size bytes. It returns ok false if the header is absent or not a single
+// byte range, in which case the whole object is served.
+func parseRange(header string, size uint64) (offset, length uint64, ok bool, err error) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false, nil
+	}
+
+	first, last, found := strings.Cut(spec, "-")
+
+	if !found {
+		return 0, 0, false, nil
+	}
+
+	if first == "" {
+		// the last n bytes
+		n, err := strconv.ParseUint(last, 10, 64)
+
+		if err != nil {
+			return 0, 0, false, nil
+		}
+
+		if n == 0 || size == 0 {
+			return 0, 0, false, errInvalidRange
+		}
+
+		n = min(n, size)
+
+		return size - n, n, true, nil
+	}
+
+	start, err := strconv.ParseUint(first, 10, 64)
+
+	if err != nil {
+		return 0, 0, false, nil
+	}
+
+	if start >= size {
+		return 0, 0, false, errInvalidRange
+	}
+
+	end := size - 1
+
+	if last != "" {
+		end, err = strconv.ParseUint(last, 10, 64)
+
+		if err != nil || end < start {
+			return 0, 0, false, nil
+		}
+
+		end = min(end, size-1)
+	}
+
+	return start, end - start + 1, true, nil
+}
+
+// getObject serves GET and HEAD of an object.
+func (g *Gateway) getObject(c *gin.Context, bucket, key string) {
+	obj, err := g.fs.StatObject(objectName(bucket, key))
+
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	offset, length, partial, err := parseRange(c.GetHeader("Range"), obj.Size)
+
+	if err != nil {
+		c.Header("Content-Range", "bytes */"+strconv.FormatUint(obj.Size, 10))
+		writeError(c, err)
+		return
+	}
+
+	status := http.StatusOK
+
+	if partial {
+		status = http.StatusPartialContent
+		c.Header("Content-Range", "bytes "+strconv.FormatUint(offset, 10)+"-"+
+			strconv.FormatUint(offset+length-1, 10)+"/"+strconv.FormatUint(obj.Size, 10))
+	} else {
+		length = obj.Size
+	}
+
+	c.Header("ETag", obj.ETag())
+	c.Header("Accept-Ranges", "bytes")
+	c.Header("Last-Modified", obj.ModifiedAt.UTC().Format(http.TimeFormat))
+	c.Header("Content-Type", obj.MediaType())
+	c.Header("Content-Length", strconv.FormatUint(length, 10))
+
+	for key, value := range obj.Metadata {
+		c.Header(metaHeaderPrefix+key, value)
+	}
+
+	c.Status(status)
+
+	if c.Request.Method == http.MethodHead || length == 0 {
+		c.Writer.WriteHeaderNow()
+		return
+	}
+
+	// the status is already sent, a failed read can only cut the body short
+	if err := g.fs.ReadObjectRange(obj, c.Writer, offset, length); err != nil {
+		c.Error(err)
+	}
+}
+
+func (g *Gateway) deleteObject(c *gin.Context, bucket, key string) {
+	err := g.fs.DeleteFile(objectName(bucket, key))
+
+	// deleting a missing key succeeds in S3
+	if err != nil && !errors.Is(err, types.ErrObjectNotFound) {
+		writeError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,510 @@
+package s3gw
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	signatureAlgorithm = "AWS4-HMAC-SHA256"
+	chunkAlgorithm     = "AWS4-HMAC-SHA256-PAYLOAD"
+	amzDateFormat      = "20060102T150405Z"
+
+	unsignedPayload          = "UNSIGNED-PAYLOAD"
+	streamingPayload         = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	streamingUnsignedTrailer = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+
+	emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	maxClockSkew   = 15 * time.Minute
+	maxPresignTime = 7 * 24 * time.Hour
+	maxChunkSize   = 16 * 1024 * 1024
+)
+
+// signature holds the parsed SigV4 authorization of a request.
+type signature struct {
+	accessKey     string
+	scope         string
+	date          string
+	signedHeaders []string
+	signature     string
+	amzDate       time.Time
+	payloadHash   string
+	presigned     bool
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func signingKey(secret, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+// uriEncode encodes s the way SigV4 expects: everything but unreserved
+// characters is percent encoded, slashes only if encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+func canonicalQuery(query url.Values, skipSignature bool) string {
+	var pairs []string
+
+	for key, values := range query {
+		if skipSignature && key == "X-Amz-Signature" {
+			continue
+		}
+
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, "&")
+}
+
+func headerValue(r *http.Request, name string) string {
+	switch name {
+	case "host":
+		return r.Host
+	case "content-length":
+		if v := r.Header.Get("Content-Length"); v != "" {
+			return v
+		}
+		return strconv.FormatInt(r.ContentLength, 10)
+	case "transfer-encoding":
+		return strings.Join(r.TransferEncoding, ",")
+	}
+
+	values := r.Header.Values(name)
+
+	for i, v := range values {
+		values[i] = strings.Join(strings.Fields(v), " ")
+	}
+
+	return strings.Join(values, ",")
+}
+
+func canonicalRequest(r *http.Request, sig *signature) string {
+	var headers strings.Builder
+
+	for _, name := range sig.signedHeaders {
+		headers.WriteString(name + ":" + headerValue(r, name) + "\n")
+	}
+
+	path := r.URL.Path
+	if path == "" {
+		path = "/"
+	}
+
+	return strings.Join([]string{
+		r.Method,
+		uriEncode(path, false),
+		canonicalQuery(r.URL.Query(), sig.presigned),
+		headers.String(),
+		strings.Join(sig.signedHeaders, ";"),
+		sig.payloadHash,
+	}, "\n")
+}
+
+func stringToSign(sig *signature, canonical string) string {
+	return strings.Join([]string{
+		signatureAlgorithm,
+		sig.amzDate.Format(amzDateFormat),
+		sig.scope,
+		sha256Hex([]byte(canonical)),
+	}, "\n")
+}
+
+// parseCredential splits AKID/date/region/service/aws4_request.
+func parseCredential(sig *signature, credential string) error {
+	parts := strings.Split(credential, "/")
+
+	if len(parts) != 5 || parts[3] != "s3" || parts[4] != "aws4_request" {
+		return errAuthorizationMalformed
+	}
+
+	sig.accessKey = parts[0]
+	sig.date = parts[1]
+	sig.scope = strings.Join(parts[1:], "/")
+
+	return nil
+}
+
+// checkScope rejects signatures that leave the host out of the signed
+// headers or whose credential scope is for another day than the request.
+func checkScope(sig *signature) error {
+	if !slices.Contains(sig.signedHeaders, "host") {
+		return errAuthorizationMalformed
+	}
+
+	if sig.date != sig.amzDate.Format("20060102") {
+		return errAuthorizationMalformed
+	}
+
+	return nil
+}
+
+func parseAuthorizationHeader(r *http.Request) (*signature, error) {
+	auth := r.Header.Get("Authorization")
+
+	if !strings.HasPrefix(auth, signatureAlgorithm+" ") {
+		return nil, errAuthorizationMalformed
+	}
+
+	sig := &signature{}
+
+	for _, field := range strings.Split(strings.TrimPrefix(auth, signatureAlgorithm+" "), ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+
+		if !ok {
+			return nil, errAuthorizationMalformed
+		}
+
+		switch key {
+		case "Credential":
+			if err := parseCredential(sig, value); err != nil {
+				return nil, err
+			}
+		case "SignedHeaders":
+			sig.signedHeaders = strings.Split(value, ";")
+		case "Signature":
+			sig.signature = value
+		}
+	}
+
+	if sig.accessKey == "" || sig.signature == "" || len(sig.signedHeaders) == 0 {
+		return nil, errAuthorizationMalformed
+	}
+
+	date := r.Header.Get("X-Amz-Date")
+	if date == "" {
+		date = r.Header.Get("Date")
+	}
+
+	amzDate, err := time.Parse(amzDateFormat, date)
+
+	if err != nil {
+		return nil, errAuthorizationMalformed
+	}
+
+	sig.amzDate = amzDate
+
+	if err := checkScope(sig); err != nil {
+		return nil, err
+	}
+
+	if d := time.Since(amzDate); d > maxClockSkew || d < -maxClockSkew {
+		return nil, errRequestTimeTooSkewed
+	}
+
+	sig.payloadHash = r.Header.Get("X-Amz-Content-Sha256")
+
+	if sig.payloadHash == "" {
+		return nil, errMissingContentSHA256
+	}
+
+	return sig, nil
+}
+
+func parsePresignedQuery(r *http.Request) (*signature, error) {
+	query := r.URL.Query()
+
+	if query.Get("X-Amz-Algorithm") != signatureAlgorithm {
+		return nil, errAuthorizationMalformed
+	}
+
+	sig := &signature{
+		presigned:     true,
+		signedHeaders: strings.Split(query.Get("X-Amz-SignedHeaders"), ";"),
+		signature:     query.Get("X-Amz-Signature"),
+		payloadHash:   unsignedPayload,
+	}
+
+	if err := parseCredential(sig, query.Get("X-Amz-Credential")); err != nil {
+		return nil, err
+	}
+
+	amzDate, err := time.Parse(amzDateFormat, query.Get("X-Amz-Date"))
+
+	if err != nil {
+		return nil, errAuthorizationMalformed
+	}
+
+	sig.amzDate = amzDate
+
+	if err := checkScope(sig); err != nil {
+		return nil, err
+	}
+
+	expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+
+	if err != nil || expires < 0 || time.Duration(expires)*time.Second > maxPresignTime {
+		return nil, errAuthorizationMalformed
+	}
+
+	if time.Now().After(amzDate.Add(time.Duration(expires) * time.Second)) {
+		return nil, errRequestExpired
+	}
+
+	return sig, nil
+}
+
+// verifySignature checks the SigV4 signature of r against the secret keys and
+// returns the request body wrapped so that the payload is verified as it is
+// read.
+func verifySignature(r *http.Request, secrets map[string]string) (io.Reader, error) {
+	var sig *signature
+	var err error
+
+	switch {
+	case r.Header.Get("Authorization") != "":
+		sig, err = parseAuthorizationHeader(r)
+	case r.URL.Query().Get("X-Amz-Algorithm") != "":
+		sig, err = parsePresignedQuery(r)
+	default:
+		return nil, errAccessDenied
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	secret, ok := secrets[sig.accessKey]
+
+	if !ok {
+		return nil, errInvalidAccessKeyID
+	}
+
+	parts := strings.Split(sig.scope, "/")
+	key := signingKey(secret, sig.date, parts[1], parts[2])
+	expected := hex.EncodeToString(hmacSHA256(key, stringToSign(sig, canonicalRequest(r, sig))))
+
+	if !hmac.Equal([]byte(expected), []byte(sig.signature)) {
+		return nil, errSignatureDoesNotMatch
+	}
+
+	switch sig.payloadHash {
+	case unsignedPayload:
+		return r.Body, nil
+	case streamingPayload:
+		return newChunkedReader(r.Body, sig, key, expected), nil
+	case streamingUnsignedTrailer:
+		return newChunkedReader(r.Body, nil, nil, ""), nil
+	}
+
+	if len(sig.payloadHash) != sha256.Size*2 {
+		return nil, errInvalidArgument
+	}
+
+	return &hashReader{r: r.Body, hash: sha256.New(), expected: sig.payloadHash}, nil
+}
+
+// hashReader fails the final read if the body does not match its declared
+// SHA256.
+type hashReader struct {
+	r        io.Reader
+	hash     hash.Hash
+	expected string
+}
+
+func (h *hashReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	h.hash.Write(p[:n])
+
+	if err == io.EOF && hex.EncodeToString(h.hash.Sum(nil)) != h.expected {
+		return n, errContentSHA256Mismatch
+	}
+
+	return n, err
+}
+
+// chunkedReader decodes an aws-chunked body. If sig is set every chunk
+// signature is verified, chained from the seed signature of the request.
+type chunkedReader struct {
+	r       *bufio.Reader
+	sig     *signature
+	key     []byte
+	prevSig string
+	buf     []byte
+	done    bool
+}
+
+func newChunkedReader(r io.Reader, sig *signature, key []byte, seed string) *chunkedReader {
+	return &chunkedReader{
+		r:       bufio.NewReader(r),
+		sig:     sig,
+		key:     key,
+		prevSig: seed,
+	}
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	for len(c.buf) == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+
+		if err := c.nextChunk(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+
+	return n, nil
+}
+
+func (c *chunkedReader) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+
+	if err == io.EOF {
+		return "", io.ErrUnexpectedEOF
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (c *chunkedReader) nextChunk() error {
+	header, err := c.readLine()
+
+	if err != nil {
+		return err
+	}
+
+	sizeHex, ext, _ := strings.Cut(header, ";")
+
+	size, err := strconv.ParseInt(sizeHex, 16, 64)
+
+	if err != nil || size < 0 || size > maxChunkSize {
+		return errIncompleteBody
+	}
+
+	data := make([]byte, size)
+
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return errIncompleteBody
+	}
+
+	if c.sig != nil {
+		chunkSig := strings.TrimPrefix(ext, "chunk-signature=")
+
+		toSign := strings.Join([]string{
+			chunkAlgorithm,
+			c.sig.amzDate.Format(amzDateFormat),
+			c.sig.scope,
+			c.prevSig,
+			emptySHA256,
+			sha256Hex(data),
+		}, "\n")
+
+		expected := hex.EncodeToString(hmacSHA256(c.key, toSign))
+
+		if !hmac.Equal([]byte(expected), []byte(chunkSig)) {
+			return errSignatureDoesNotMatch
+		}
+
+		c.prevSig = expected
+	}
+
+	if size == 0 {
+		// skip trailing headers up to the final empty line
+		for {
+			line, err := c.readLine()
+
+			if err != nil {
+				return err
+			}
+
+			if line == "" {
+				break
+			}
+		}
+
+		c.done = true
+		return nil
+	}
+
+	if line, err := c.readLine(); err != nil || line != "" {
+		return errIncompleteBody
+	}
+
+	c.buf = data
+
+	return nil
+}
+
+// decodedLength returns the payload size of the request, which for chunked
+// uploads is sent separately from the Content-Length of the encoded body.
+func decodedLength(r *http.Request) int64 {
+	if v := r.Header.Get("X-Amz-Decoded-Content-Length"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err == nil {
+			return n
+		}
+	}
+
+	if strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked") {
+		return -1
+	}
+
+	return r.ContentLength
+}
+
+// readAllLimited reads a small request document such as the multipart
+// completion XML.
+func readAllLimited(r io.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if _, err := io.Copy(&buf, io.LimitReader(r, 1024*1024)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
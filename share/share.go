@@ -0,0 +1,153 @@
+// Package share signs and verifies download links that give access to a
+// single object without an API key. A link carries a Grant signed with an
+// Ed25519 key whose public half is registered on the metadata server, where
+// it can be revoked by its ID.
+package share
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformed        = errors.New("malformed share link")
+	ErrExpired          = errors.New("share link expired")
+	ErrInvalidSignature = errors.New("invalid share link signature")
+	ErrKeyRevoked       = errors.New("share key revoked")
+)
+
+// Query parameters of a share link.
+const (
+	ParamExpires   = "dfs-expires"
+	ParamRange     = "dfs-range"
+	ParamRate      = "dfs-rate"
+	ParamKey       = "dfs-key"
+	ParamSignature = "dfs-signature"
+)
+
+// Grant is what a share link allows.
+type Grant struct {
+	// Object is the name of the shared object.
+	Object  string
+	Expires time.Time
+
+	// Offset and Length restrict the link to a byte range of the object, a
+	// zero Length shares the whole object.
+	Offset uint64
+	Length uint64
+
+	// RateLimit caps the download speed in bytes per second, zero is
+	// unlimited.
+	RateLimit int64
+
+	// KeyID is the ID of the share key that signs the link.
+	KeyID string
+}
+
+func (g *Grant) rangeParam() string {
+	if g.Length == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%d-%d", g.Offset, g.Offset+g.Length-1)
+}
+
+// message is the canonical form of the grant that is signed.
+func (g *Grant) message() []byte {
+	return []byte(strings.Join([]string{
+		"dfs-share-v1",
+		g.Object,
+		strconv.FormatInt(g.Expires.Unix(), 10),
+		g.rangeParam(),
+		strconv.FormatInt(g.RateLimit, 10),
+		g.KeyID,
+	}, "\n"))
+}
+
+// Sign returns the query of a link for the grant signed with key.
+func Sign(g *Grant, key ed25519.PrivateKey) url.Values {
+	q := url.Values{}
+	q.Set(ParamExpires, strconv.FormatInt(g.Expires.Unix(), 10))
+
+	if r := g.rangeParam(); r != "" {
+		q.Set(ParamRange, r)
+	}
+
+	if g.RateLimit > 0 {
+		q.Set(ParamRate, strconv.FormatInt(g.RateLimit, 10))
+	}
+
+	q.Set(ParamKey, g.KeyID)
+	q.Set(ParamSignature, base64.RawURLEncoding.EncodeToString(ed25519.Sign(key, g.message())))
+
+	return q
+}
+
+// IsSigned reports whether the query carries a share link signature.
+func IsSigned(q url.Values) bool {
+	return q.Has(ParamSignature)
+}
+
+// Parse reads the grant for object from the query of a link without
+// verifying it, the returned signature is checked with Verify.
+func Parse(object string, q url.Values) (*Grant, []byte, error) {
+	g := &Grant{Object: object, KeyID: q.Get(ParamKey)}
+
+	expires, err := strconv.ParseInt(q.Get(ParamExpires), 10, 64)
+
+	if err != nil || g.KeyID == "" {
+		return nil, nil, ErrMalformed
+	}
+
+	g.Expires = time.Unix(expires, 0)
+
+	if r := q.Get(ParamRange); r != "" {
+		first, last, ok := strings.Cut(r, "-")
+
+		start, err1 := strconv.ParseUint(first, 10, 64)
+		end, err2 := strconv.ParseUint(last, 10, 64)
+
+		if !ok || err1 != nil || err2 != nil || end < start {
+			return nil, nil, ErrMalformed
+		}
+
+		g.Offset = start
+		g.Length = end - start + 1
+	}
+
+	if r := q.Get(ParamRate); r != "" {
+		g.RateLimit, err = strconv.ParseInt(r, 10, 64)
+
+		if err != nil || g.RateLimit < 0 {
+			return nil, nil, ErrMalformed
+		}
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(q.Get(ParamSignature))
+
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return nil, nil, ErrMalformed
+	}
+
+	return g, sig, nil
+}
+
+// Verify checks sig over the grant with the public key and that the grant
+// has not expired at now.
+func Verify(g *Grant, sig []byte, key ed25519.PublicKey, now time.Time) error {
+	if len(key) != ed25519.PublicKeySize || !ed25519.Verify(key, g.message(), sig) {
+		return ErrInvalidSignature
+	}
+
+	if now.After(g.Expires) {
+		return ErrExpired
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package share_test
+
+import (
+	"crypto/ed25519"
+	"dfs/share"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestShare(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	grant := &share.Grant{
+		Object:    "bucket/report.pdf",
+		Expires:   time.Now().Add(time.Hour).Truncate(time.Second),
+		Offset:    10,
+		Length:    90,
+		RateLimit: 1024,
+		KeyID:     "key",
+	}
+
+	t.Run("verifies signed grants", func(t *testing.T) {
+		got, sig, err := share.Parse(grant.Object, share.Sign(grant, priv))
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if *got != *grant {
+			t.Fatalf("expected %+v, got %+v", grant, got)
+		}
+
+		if err := share.Verify(got, sig, pub, time.Now()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("rejects links for other objects or ranges", func(t *testing.T) {
+		q := share.Sign(grant, priv)
+
+		got, sig, err := share.Parse("bucket/other.pdf", q)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := share.Verify(got, sig, pub, time.Now()); !errors.Is(err, share.ErrInvalidSignature) {
+			t.Fatalf("expected %v, got %v", share.ErrInvalidSignature, err)
+		}
+
+		q.Set(share.ParamRange, "0-99")
+
+		got, sig, err = share.Parse(grant.Object, q)
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := share.Verify(got, sig, pub, time.Now()); !errors.Is(err, share.ErrInvalidSignature) {
+			t.Fatalf("expected %v, got %v", share.ErrInvalidSignature, err)
+		}
+	})
+
+	t.Run("rejects expired links", func(t *testing.T) {
+		got, sig, err := share.Parse(grant.Object, share.Sign(grant, priv))
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := share.Verify(got, sig, pub, grant.Expires.Add(time.Second)); !errors.Is(err, share.ErrExpired) {
+			t.Fatalf("expected %v, got %v", share.ErrExpired, err)
+		}
+	})
+}
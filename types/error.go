@@ -6,7 +6,61 @@ var ErrCouldNotGetObjectFromAPI = errors.New("could not get object from API")
 var ErrCouldNotPutObjectToAPI = errors.New("could not put object to API")
 
 var ErrPieceHashMismatch = errors.New("piece hash mismatch")
+var ErrContentHashMismatch = errors.New("object content hash mismatch")
 var ErrNotEnoughPieces = errors.New("not enough pieces")
 
 var ErrNodeNotFound = errors.New("node not found")
 var ErrNotEnoughNodesAvailable = errors.New("not enough nodes available")
+
+var ErrPieceNotFound = errors.New("piece not found")
+var ErrCouldNotWritePiece = errors.New("could not write piece")
+var ErrCouldNotReadPiece = errors.New("could not read piece")
+
+var ErrObjectNotFound = errors.New("object not found")
+var ErrObjectExists = errors.New("object already exists")
+var ErrSameObject = errors.New("source and destination are the same object")
+var ErrSegmentNotFound = errors.New("segment not found")
+var ErrCouldNotDeleteObjectFromAPI = errors.New("could not delete object from API")
+var ErrCouldNotCopyObject = errors.New("could not copy object")
+var ErrCouldNotUpdateObject = errors.New("could not update object")
+var ErrCouldNotListObjects = errors.New("could not list objects")
+var ErrCouldNotRegisterNode = errors.New("could not register node")
+var ErrCouldNotListNodes = errors.New("could not list nodes")
+var ErrCouldNotReportCapacity = errors.New("could not report capacity")
+var ErrNodeFull = errors.New("storage node is full")
+var ErrOrderRejected = errors.New("order rejected by storage node")
+var ErrPieceExists = errors.New("piece already exists")
+var ErrPieceMismatch = errors.New("piece does not match its declared size and hash")
+var ErrPieceCorrupted = errors.New("piece data does not match its hash")
+var ErrCouldNotReportLostPieces = errors.New("could not report lost pieces")
+var ErrCouldNotListRepairs = errors.New("could not list segments to repair")
+var ErrPieceTooLarge = errors.New("piece larger than its order allows")
+var ErrCouldNotCreateOrders = errors.New("could not create orders")
+var ErrOrdersDisabled = errors.New("orders are not enabled")
+var ErrInvalidReport = errors.New("invalid usage report signature")
+var ErrNodeKeyMismatch = errors.New("node is registered with another key")
+var ErrInvalidIdentity = errors.New("node id is not derived from its key")
+var ErrInvalidReceipt = errors.New("invalid piece receipt")
+var ErrNodeNotExiting = errors.New("node is not exiting")
+var ErrCouldNotStartExit = errors.New("could not start graceful exit")
+var ErrCouldNotGetExitStatus = errors.New("could not get graceful exit status")
+var ErrCouldNotGetTransfers = errors.New("could not get pieces to transfer")
+var ErrCouldNotReportTransfers = errors.New("could not report transferred pieces")
+var ErrCouldNotSettleUsage = errors.New("could not settle usage")
+var ErrCouldNotGetBandwidth = errors.New("could not get bandwidth usage")
+var ErrCouldNotGetStorageUsage = errors.New("could not get storage usage")
+var ErrCouldNotSetLimits = errors.New("could not set limits")
+var ErrCouldNotGetLimits = errors.New("could not get limits")
+var ErrLimitExceeded = errors.New("bucket is over its limits")
+var ErrBucketNotFound = errors.New("bucket not found")
+var ErrBucketExists = errors.New("bucket already exists")
+var ErrInvalidBucketName = errors.New("invalid bucket name")
+var ErrCouldNotCreateBucket = errors.New("could not create bucket")
+var ErrCouldNotListBuckets = errors.New("could not list buckets")
+var ErrShareKeyNotFound = errors.New("share key not found")
+var ErrCouldNotRegisterShareKey = errors.New("could not register share key")
+var ErrCouldNotGetShareKey = errors.New("could not get share key")
+var ErrCouldNotRevokeShareKey = errors.New("could not revoke share key")
+var ErrInvalidShareKey = errors.New("invalid share key")
+var ErrUnauthorized = errors.New("invalid api key")
+var ErrForbidden = errors.New("api key does not allow the request")
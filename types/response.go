@@ -1,5 +1,7 @@
 package types
 
+import "time"
+
 type GetObjectRequest struct {
 	Name string `json:"name"`
 }
@@ -7,3 +9,161 @@ type GetObjectRequest struct {
 type GetObjectResponse struct {
 	Object Object `json:"object"`
 }
+
+type DeleteObjectRequest struct {
+	Name string `json:"name"`
+}
+
+// DeleteObjectResponse lists the pieces that are no longer referenced by any
+// object and can be removed from the storage nodes, with the orders to do so
+// if the server signs orders.
+type DeleteObjectResponse struct {
+	Pieces []*Piece `json:"pieces"`
+}
+
+// LookupSegmentRequest looks up a shared segment for an object being
+// written, segments are only shared within the bucket of the object.
+type LookupSegmentRequest struct {
+	ObjectID   ObjectID `json:"object_id"`
+	ContentKey []byte   `json:"content_key"`
+}
+
+type SegmentResponse struct {
+	Segment *Segment `json:"segment"`
+}
+
+type CopyObjectRequest struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+}
+
+// ReplaceObjectResponse is the object moved over the destination and the
+// pieces of the replaced object that can be removed from the storage nodes.
+type ReplaceObjectResponse struct {
+	Object Object   `json:"object"`
+	Pieces []*Piece `json:"pieces"`
+}
+
+// UpdateObjectRequest changes the metadata of an object without rewriting its
+// data. Nil fields are left as they are, a non nil Metadata replaces all
+// metadata.
+type UpdateObjectRequest struct {
+	Name        string            `json:"name"`
+	ContentType *string           `json:"content_type,omitempty"`
+	Metadata    map[string]string `json:"metadata"`
+
+	// ContentHash records the hash of the contents once they are written, it
+	// doesn't count as a modification.
+	ContentHash []byte `json:"content_hash,omitempty"`
+}
+
+type ListObjectsRequest struct {
+	Prefix string `json:"prefix"`
+}
+
+// ListObjectsResponse lists objects without their segments.
+type ListObjectsResponse struct {
+	Objects []*Object `json:"objects"`
+}
+
+type ListNodesResponse struct {
+	Nodes []*Node `json:"nodes"`
+}
+
+// ComposeObjectRequest creates Destination from the segments of Sources, in
+// order.
+type ComposeObjectRequest struct {
+	Sources     []string `json:"sources"`
+	Destination string   `json:"destination"`
+}
+
+type CreateBucketRequest struct {
+	Name string `json:"name"`
+}
+
+type ListBucketsResponse struct {
+	Buckets []*Bucket `json:"buckets"`
+}
+
+// ReportCapacityRequest is sent by storage nodes to report how much room they
+// have left.
+type ReportCapacityRequest struct {
+	Capacity uint64 `json:"capacity"`
+	Free     uint64 `json:"free"`
+}
+
+type RegisterShareKeyRequest struct {
+	PublicKey []byte `json:"public_key"`
+}
+
+// OrderRequest asks for orders for pieces of an object. Action is "put" or
+// "delete", MaxSize limits the size of uploaded pieces.
+type OrderRequest struct {
+	Action  string   `json:"action"`
+	Pieces  []*Piece `json:"pieces"`
+	MaxSize int64    `json:"max_size,omitempty"`
+}
+
+// OrderResponse holds the requested pieces with their orders set.
+type OrderResponse struct {
+	Pieces []*Piece `json:"pieces"`
+}
+
+type OrderKeyResponse struct {
+	PublicKey []byte `json:"public_key"`
+}
+
+// SettleResponse tells a node how many settlements of its report were
+// accounted. The others were invalid, expired or settled before, and are not
+// worth submitting again.
+type SettleResponse struct {
+	Accepted int `json:"accepted"`
+	Rejected int `json:"rejected"`
+}
+
+// BandwidthRequest selects bandwidth rollups, zero fields match all of them.
+// From and To are the first and last day included.
+type BandwidthRequest struct {
+	NodeID NodeID    `json:"node_id"`
+	Bucket string    `json:"bucket,omitempty"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+}
+
+type BandwidthResponse struct {
+	Rollups []*BandwidthRollup `json:"rollups"`
+}
+
+// StorageUsageRequest selects the tally of one bucket, or of all of them if
+// Bucket is empty.
+type StorageUsageRequest struct {
+	Bucket string `json:"bucket,omitempty"`
+}
+
+type StorageUsageResponse struct {
+	Tallies []*StorageTally `json:"tallies"`
+}
+
+// ExitTransfersRequest asks for up to Limit pieces an exiting node should
+// transfer next.
+type ExitTransfersRequest struct {
+	Limit int `json:"limit"`
+}
+
+type ExitTransfersResponse struct {
+	Transfers []*ExitTransfer `json:"transfers"`
+}
+
+type ExitReport struct {
+	Results []*ExitResult `json:"results"`
+}
+
+// LostPiecesRequest reports pieces a storage node found corrupted and no
+// longer serves.
+type LostPiecesRequest struct {
+	Pieces []PieceID `json:"pieces"`
+}
+
+type RepairResponse struct {
+	Segments []*DegradedSegment `json:"segments"`
+}
@@ -1,5 +1,11 @@
 package types
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 const ONE_BYTE = 1
 const ONE_KILOBYTE = 1024 * ONE_BYTE
 const ONE_MEGABYTE = 1024 * ONE_KILOBYTE
@@ -8,3 +14,35 @@ const ONE_TERABYTE = 1024 * ONE_GIGABYTE
 const ONE_PETABYTE = 1024 * ONE_TERABYTE
 
 const SEGMENT_SIZE = 64 * ONE_MEGABYTE
+
+// Segments are erasure coded into DATA_SHARDS + PARITY_SHARDS pieces, any
+// DATA_SHARDS of them are enough to read the segment.
+const DATA_SHARDS = 29
+const PARITY_SHARDS = 51
+
+// ParseSize parses a size in bytes with an optional K, M, G or T suffix.
+func ParseSize(s string) (int64, error) {
+	units := map[string]int64{
+		"K": ONE_KILOBYTE,
+		"M": ONE_MEGABYTE,
+		"G": ONE_GIGABYTE,
+		"T": ONE_TERABYTE,
+	}
+
+	unit := int64(1)
+
+	if len(s) > 0 {
+		if u, ok := units[strings.ToUpper(s[len(s)-1:])]; ok {
+			unit = u
+			s = s[:len(s)-1]
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	return n * unit, nil
+}
@@ -1,6 +1,14 @@
 package types
 
-import "github.com/google/uuid"
+import (
+	"encoding/hex"
+	"mime"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type ObjectID uuid.UUID
 
@@ -32,6 +40,11 @@ func NewPieceID() PieceID {
 	return PieceID(uuid.New())
 }
 
+func ParsePieceID(s string) (PieceID, error) {
+	id, err := uuid.Parse(s)
+	return PieceID(id), err
+}
+
 type NodeID uuid.UUID
 
 func (n NodeID) String() string {
@@ -44,8 +57,32 @@ func NewNodeID() NodeID {
 
 type Node struct {
 	ID       NodeID `json:"id"`
-	HttpAddr string
-	GRPCAddr string
+	HttpAddr string `json:"http_addr"`
+	GRPCAddr string `json:"grpc_addr,omitempty"`
+
+	// Capacity is the number of bytes the node stores pieces in and Free how
+	// many of them were left when the node last reported. Nodes that don't
+	// report a capacity are not limited.
+	Capacity uint64 `json:"capacity,omitempty"`
+	Free     uint64 `json:"free,omitempty"`
+
+	// RequiresOrders is set by nodes that only accept piece traffic carrying
+	// an order signed by the metadata server.
+	RequiresOrders bool `json:"requires_orders,omitempty"`
+
+	// PublicKey is the Ed25519 identity of the node, the ID is derived from
+	// it. The node signs piece receipts and usage reports with it.
+	PublicKey []byte `json:"public_key,omitempty"`
+
+	// Exiting is set once the node announced it leaves the network. It gets
+	// no new pieces while its pieces are transferred to other nodes.
+	Exiting bool `json:"exiting,omitempty"`
+}
+
+// HasRoom reports whether the node had room for size more bytes when it last
+// reported its capacity.
+func (n *Node) HasRoom(size uint64) bool {
+	return n.Capacity == 0 || (n.Free > 0 && n.Free >= size)
 }
 
 type Piece struct {
@@ -53,6 +90,54 @@ type Piece struct {
 	Hash     []byte  `json:"hash"`
 	Position uint    `json:"position"`
 	NodeID   NodeID  `json:"addr"`
+
+	// Order is the signed order that lets the client access the piece on its
+	// node. The metadata server sets it on the pieces it hands out, it is
+	// never stored.
+	Order string `json:"order,omitempty"`
+}
+
+// PieceReceipt is what a storage node answers an upload with. Nodes with an
+// identity sign it, see package identity.
+type PieceReceipt struct {
+	PieceID   PieceID `json:"piece_id"`
+	Hash      []byte  `json:"hash"`
+	Size      int64   `json:"size"`
+	Signature []byte  `json:"signature,omitempty"`
+}
+
+type PieceInfo struct {
+	ID        PieceID   `json:"id"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// ExpiresAt is when the node deletes the piece, zero if it never does.
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// Hash, Order and Satellite are only known to the node storing the
+	// piece: the hash it was written with, the order it was uploaded with
+	// and the key of the metadata server that signed it.
+	Hash      []byte `json:"hash,omitempty"`
+	Order     string `json:"order,omitempty"`
+	Satellite []byte `json:"satellite,omitempty"`
+}
+
+// UnixTime and UnixSeconds convert piece expiration times from and to unix
+// seconds on the wire, where zero means the piece never expires.
+func UnixTime(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(sec, 0)
+}
+
+func UnixSeconds(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.Unix()
 }
 
 type Segment struct {
@@ -61,6 +146,20 @@ type Segment struct {
 	Size     uint64    `json:"size"`
 	Position uint      `json:"position"`
 	Pieces   []*Piece  `json:"pieces"`
+
+	// ContentKey is the keyed Blake3 hash of the segment plaintext. Segments
+	// with a content key are shared between all objects holding the same data.
+	ContentKey []byte `json:"content_key,omitempty"`
+
+	// Compression is the algorithm the segment data was compressed with
+	// before erasure coding and EncodedSize the size of the compressed data.
+	// Size is always the uncompressed size.
+	Compression string `json:"compression,omitempty"`
+	EncodedSize uint64 `json:"encoded_size,omitempty"`
+
+	// ExpiresAt is copied from the object on upload and sent along with
+	// every piece, storage nodes delete the pieces once it passed.
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
 type Object struct {
@@ -68,9 +167,64 @@ type Object struct {
 	Name string   `json:"name"`
 	Size uint64   `json:"size"`
 
+	// Compression is the algorithm segments are compressed with on upload,
+	// segments that do not compress well are stored as is.
+	Compression string `json:"compression,omitempty"`
+
+	// ContentType is the media type of the object, served by the gateways.
+	ContentType string `json:"content_type,omitempty"`
+
+	// ContentHash is the Blake3 hash of the object contents, computed while
+	// they are uploaded. Composed objects have none.
+	ContentHash []byte `json:"content_hash,omitempty"`
+
+	// CreatedAt and ModifiedAt are set by the metadata server. ModifiedAt
+	// changes when the metadata of the object is updated.
+	CreatedAt  time.Time `json:"created_at"`
+	ModifiedAt time.Time `json:"modified_at"`
+
+	// Metadata holds key value pairs set by clients, the data store doesn't
+	// interpret them.
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// ExpiresAt is set at upload for temporary objects, zero if the object
+	// never expires. Expired objects are hidden and eventually purged.
+	ExpiresAt time.Time `json:"expires_at"`
+
 	Segments []*Segment `json:"segments"`
 }
 
+// Expired reports whether the object expired at now.
+func (o *Object) Expired(now time.Time) bool {
+	return !o.ExpiresAt.IsZero() && !now.Before(o.ExpiresAt)
+}
+
+// ETag identifies the contents of the object by its content hash. Composed
+// objects have none and are identified by their ID instead: updating an
+// object only changes its content type and metadata, new contents are always
+// written as a new object with a new ID.
+func (o *Object) ETag() string {
+	if o.ContentHash != nil {
+		return `"` + hex.EncodeToString(o.ContentHash) + `"`
+	}
+
+	return `"` + hex.EncodeToString(o.ID[:]) + `"`
+}
+
+// MediaType is the content type stored with the object, or else guessed from
+// its name.
+func (o *Object) MediaType() string {
+	if o.ContentType != "" {
+		return o.ContentType
+	}
+
+	if t := mime.TypeByExtension(path.Ext(o.Name)); t != "" {
+		return t
+	}
+
+	return "application/octet-stream"
+}
+
 func NewObject(name string) Object {
 	return Object{
 		ID:   ObjectID(uuid.New()),
@@ -86,3 +240,140 @@ func NewSegment(objectID ObjectID, size uint64, position uint) Segment {
 		Position: position,
 	}
 }
+
+// NewSegments splits an object of the given size into SEGMENT_SIZE segments.
+func NewSegments(objectID ObjectID, size uint64) []*Segment {
+	var segments []*Segment
+
+	for offset := uint64(0); offset < size; offset += SEGMENT_SIZE {
+		segment := NewSegment(objectID, min(SEGMENT_SIZE, size-offset), uint(len(segments)))
+		segments = append(segments, &segment)
+	}
+
+	return segments
+}
+
+// PieceSize is the size of each of the pieces the segment is stored in.
+func (s *Segment) PieceSize() int64 {
+	size := s.Size
+
+	if s.EncodedSize > 0 {
+		size = s.EncodedSize
+	}
+
+	return int64((size + DATA_SHARDS - 1) / DATA_SHARDS)
+}
+
+type Bucket struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BucketOf returns the bucket of an object name, the part before the first
+// slash.
+func BucketOf(name string) string {
+	bucket, _, _ := strings.Cut(name, "/")
+	return bucket
+}
+
+// DirPrefix turns a directory name into the prefix of the object names below
+// it. The root, "" or ".", has the empty prefix.
+func DirPrefix(name string) string {
+	if name == "" || name == "." {
+		return ""
+	}
+
+	if strings.HasSuffix(name, "/") {
+		return name
+	}
+
+	return name + "/"
+}
+
+// StorageTally is what the objects of a bucket store. Bytes is the size of
+// their segments, counted once per object even where objects share them.
+type StorageTally struct {
+	Bucket   string `json:"bucket"`
+	Objects  int64  `json:"objects"`
+	Segments int64  `json:"segments"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// Limits caps what a bucket may use, zero means unlimited. Storage is in
+// bytes, Bandwidth in bytes uploaded and downloaded per calendar month.
+type Limits struct {
+	Storage   int64 `json:"storage"`
+	Bandwidth int64 `json:"bandwidth"`
+}
+
+// Settlement is the traffic a storage node served for one order.
+type Settlement struct {
+	Order string `json:"order"`
+	Bytes int64  `json:"bytes"`
+}
+
+// UsageReport is a batch of settlements a storage node submits, signed with
+// its key.
+type UsageReport struct {
+	NodeID      NodeID        `json:"node_id"`
+	Settlements []*Settlement `json:"settlements"`
+	Signature   []byte        `json:"signature"`
+}
+
+// BandwidthRollup is the traffic one node served for one bucket on one day.
+// Ingress counts uploaded bytes, Egress downloaded ones.
+type BandwidthRollup struct {
+	NodeID  NodeID    `json:"node_id"`
+	Bucket  string    `json:"bucket"`
+	Day     time.Time `json:"day"`
+	Ingress int64     `json:"ingress"`
+	Egress  int64     `json:"egress"`
+}
+
+// ExitStatus is the progress of a storage node leaving the network. Pieces
+// that could not be transferred are counted as failed, they are lost once the
+// node leaves. The exit is finished when no piece is left to transfer.
+type ExitStatus struct {
+	NodeID      NodeID    `json:"node_id"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+	Pieces      int       `json:"pieces"`
+	Transferred int       `json:"transferred"`
+	Failed      int       `json:"failed"`
+}
+
+// ExitTransfer asks an exiting node to send one of its pieces to Target. The
+// piece carries the order to put it there, if Target requires one.
+type ExitTransfer struct {
+	Piece     *Piece    `json:"piece"`
+	Size      int64     `json:"size"`
+	Target    *Node     `json:"target"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ExitResult is the outcome of a transfer, the receipt the target signed for
+// the piece or why the transfer failed.
+type ExitResult struct {
+	PieceID PieceID       `json:"piece_id"`
+	Receipt *PieceReceipt `json:"receipt,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// DegradedSegment is a segment that lost pieces to corruption on storage
+// nodes and needs to be repaired. Pieces is how many pieces it has in all.
+type DegradedSegment struct {
+	ObjectName string    `json:"object_name"`
+	SegmentID  SegmentID `json:"segment_id"`
+	Position   uint      `json:"position"`
+	Pieces     int       `json:"pieces"`
+	Lost       int       `json:"lost"`
+}
+
+// ShareKey is the public half of a key that signs share links. Revoked keys
+// are kept so links signed with them stay invalid.
+type ShareKey struct {
+	ID        string    `json:"id"`
+	PublicKey []byte    `json:"public_key"`
+	CreatedAt time.Time `json:"created_at"`
+	Revoked   bool      `json:"revoked"`
+}